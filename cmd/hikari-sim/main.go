@@ -0,0 +1,52 @@
+// Command hikari-sim simulates LIFX devices on the local network so that hikari
+// can be developed, demoed and tested without real bulbs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/sim"
+)
+
+func main() {
+	addr := flag.String("addr", sim.DefaultAddr, "UDP address to listen on")
+	configPath := flag.String("config", "", "Path of a simulator config file, defaults to a bulb, a strip and a matrix")
+	flag.Parse()
+
+	cfg := sim.DefaultConfig()
+	if *configPath != "" {
+		f, err := os.Open(*configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg, err = sim.ReadConfig(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", *configPath, err)
+		}
+	}
+
+	s, err := sim.NewServer(*addr, cfg.Devices)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, d := range s.Devices() {
+		fmt.Printf("%s  %s\n", d.Serial, d.Label)
+	}
+	fmt.Printf("Listening on %s\n", s.Addr())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		s.Close()
+	}()
+
+	if err := s.Serve(); err != nil {
+		log.Fatal(err)
+	}
+}
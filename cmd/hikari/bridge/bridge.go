@@ -0,0 +1,417 @@
+// Package bridge publishes devices to an MQTT broker, announcing them to Home Assistant
+// through MQTT discovery, and applies the commands received from it.
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/mqtt"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+const (
+	payloadOnline  = "online"
+	payloadOffline = "offline"
+	stateOn        = "ON"
+	stateOff       = "OFF"
+	manufacturer   = "LIFX"
+	minKelvin      = 1500
+	maxKelvin      = 9000
+	// queueSize is the number of commands queued for a device, further commands are dropped.
+	queueSize = 16
+	// workerIdle is how long the worker of a device waits for a command before exiting.
+	workerIdle = time.Minute
+)
+
+// Publisher is a connection to an MQTT broker.
+type Publisher interface {
+	Publish(topic string, payload []byte, retain bool) error
+	Subscribe(filters ...string) error
+	// Done is closed when the connection is lost.
+	Done() <-chan struct{}
+	Err() error
+}
+
+// Bridge publishes the state and availability of lights to retained topics under the topic prefix,
+// e.g. hikari/d073d5000001/state, and applies commands published to their set topic, e.g. hikari/d073d5000001/set.
+// Both use the Home Assistant MQTT JSON light schema.
+type Bridge struct {
+	c               controller.Controller
+	health          device.HealthFunc
+	policy          controller.RetryPolicy
+	period          time.Duration
+	prefix          string
+	discoveryPrefix string
+
+	mu        sync.Mutex
+	published map[ldevice.Serial]*published
+
+	queuesMu sync.Mutex
+	// queues hold the commands waiting to be applied to each device, keyed by the serial in their topic.
+	queues map[string]chan mqtt.Message
+}
+
+// published holds what was last published for a device, to only publish changes.
+type published struct {
+	config []byte
+	state  []byte
+	online bool
+}
+
+// State is the state of a light in the Home Assistant JSON schema, with brightness as a percentage and color temperature in kelvin.
+type State struct {
+	State      string   `json:"state"`
+	Brightness int      `json:"brightness"`
+	ColorMode  string   `json:"color_mode"`
+	Color      *HSColor `json:"color,omitempty"`
+	ColorTemp  uint16   `json:"color_temp,omitempty"`
+}
+
+// HSColor is a hue in degrees and a saturation percentage.
+type HSColor struct {
+	H float64 `json:"h"`
+	S float64 `json:"s"`
+}
+
+// Command is a command for a light in the Home Assistant JSON schema. Unset fields are left unchanged.
+type Command struct {
+	State      string   `json:"state"`
+	Brightness *float64 `json:"brightness"`
+	Color      *HSColor `json:"color"`
+	ColorTemp  *uint16  `json:"color_temp"`
+	// Transition is the transition in seconds.
+	Transition *float64 `json:"transition"`
+}
+
+// New returns a Bridge for the devices of c, refreshed every device refresh period,
+// with the topic prefixes and retry policy from cfg.
+func New(c controller.Controller, cfg config.Config) *Bridge {
+	b := &Bridge{
+		c:               c,
+		policy:          controller.PolicyFrom(cfg),
+		period:          cfg.DeviceRefreshPeriod.Std(),
+		prefix:          cfg.MQTTTopicPrefix,
+		discoveryPrefix: cfg.MQTTDiscoveryPrefix,
+		published:       make(map[ldevice.Serial]*published),
+		queues:          make(map[string]chan mqtt.Message),
+	}
+	if hr, ok := c.(controller.HealthReporter); ok {
+		b.health = hr.Health
+	}
+	return b
+}
+
+// Will returns the message marking the bridge offline, to be published by the broker when the connection is lost.
+func (b *Bridge) Will() *mqtt.Message {
+	return &mqtt.Message{Topic: b.statusTopic(), Payload: []byte(payloadOffline), Retain: true}
+}
+
+// Run marks the bridge online, subscribes to the set topics and publishes the devices
+// until ctx is done, when the bridge is marked offline, or the connection is lost.
+// Every device is published again when running on a new connection.
+func (b *Bridge) Run(ctx context.Context, p Publisher) error {
+	b.mu.Lock()
+	clear(b.published)
+	b.mu.Unlock()
+
+	if err := p.Publish(b.statusTopic(), []byte(payloadOnline), true); err != nil {
+		return err
+	}
+	if err := p.Subscribe(b.topic("+", "set")); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(b.period)
+	defer ticker.Stop()
+	for {
+		if err := b.Refresh(p); err != nil {
+			return err
+		}
+		select {
+		case <-ticker.C:
+		case <-p.Done():
+			return fmt.Errorf("connection lost: %w", p.Err())
+		case <-ctx.Done():
+			return p.Publish(b.statusTopic(), []byte(payloadOffline), true)
+		}
+	}
+}
+
+// Refresh publishes the discovery config, availability and state of every light which changed since the last refresh.
+// Lights which are no longer discovered are marked offline.
+func (b *Bridge) Refresh(p Publisher) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	seen := make(map[ldevice.Serial]bool)
+	for _, d := range b.c.GetDevices() {
+		if d.Type == ldevice.DeviceTypeSwitch {
+			continue
+		}
+		seen[d.Serial] = true
+		last, ok := b.published[d.Serial]
+		if !ok {
+			last = &published{}
+			b.published[d.Serial] = last
+		}
+
+		config, err := json.Marshal(b.discoveryConfig(d))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(config, last.config) {
+			if err := p.Publish(b.discoveryTopic(d.Serial), config, true); err != nil {
+				return err
+			}
+			last.config = config
+		}
+
+		online := !device.Offline(b.health, d.Serial)
+		if online != last.online || !ok {
+			if err := b.publishAvailability(p, d.Serial, online); err != nil {
+				return err
+			}
+			last.online = online
+		}
+		if !online {
+			continue
+		}
+
+		state, err := json.Marshal(NewState(d))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(state, last.state) {
+			if err := p.Publish(b.topic(d.Serial.String(), "state"), state, true); err != nil {
+				return err
+			}
+			last.state = state
+		}
+	}
+
+	for serial, last := range b.published {
+		if !seen[serial] && last.online {
+			if err := b.publishAvailability(p, serial, false); err != nil {
+				return err
+			}
+			last.online = false
+		}
+	}
+	return nil
+}
+
+// Handle queues a command received on the set topic of a device without waiting for it to be applied,
+// as it runs on the goroutine reading from the broker. Commands are applied in order by a worker per device,
+// so that a device which does not acknowledge them does not hold up the others. Failures are logged.
+func (b *Bridge) Handle(msg mqtt.Message) {
+	serial, ok := b.commandSerial(msg.Topic)
+	if !ok {
+		log.Printf("%s: not a command topic", msg.Topic)
+		return
+	}
+
+	b.queuesMu.Lock()
+	defer b.queuesMu.Unlock()
+	q, ok := b.queues[serial]
+	if !ok {
+		q = make(chan mqtt.Message, queueSize)
+		b.queues[serial] = q
+		go b.work(serial, q)
+	}
+	select {
+	case q <- msg:
+	default:
+		log.Printf("%s: too many pending commands, dropping command", msg.Topic)
+	}
+}
+
+// work applies the commands queued for a device until none is received for workerIdle.
+func (b *Bridge) work(serial string, q chan mqtt.Message) {
+	idle := time.NewTimer(workerIdle)
+	defer idle.Stop()
+	for {
+		select {
+		case msg := <-q:
+			if err := b.apply(msg); err != nil {
+				log.Printf("%s: %v", msg.Topic, err)
+			}
+			idle.Reset(workerIdle)
+		case <-idle.C:
+			b.queuesMu.Lock()
+			if len(q) > 0 {
+				b.queuesMu.Unlock()
+				idle.Reset(workerIdle)
+				continue
+			}
+			delete(b.queues, serial)
+			b.queuesMu.Unlock()
+			return
+		}
+	}
+}
+
+// commandSerial returns the serial in the set topic of a device.
+func (b *Bridge) commandSerial(topic string) (string, bool) {
+	rest, isDevice := strings.CutPrefix(topic, b.prefix+"/")
+	serial, isSet := strings.CutSuffix(rest, "/set")
+	return serial, isDevice && isSet
+}
+
+func (b *Bridge) apply(msg mqtt.Message) error {
+	serial, ok := b.commandSerial(msg.Topic)
+	if !ok {
+		return errors.New("not a command topic")
+	}
+	var cmd Command
+	if err := json.Unmarshal(msg.Payload, &cmd); err != nil {
+		return fmt.Errorf("invalid command: %w", err)
+	}
+	devices := device.Filter(b.c.GetDevices(), serial)
+	if len(devices) != 1 || devices[0].Serial.String() != serial {
+		return fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, serial)
+	}
+	d := devices[0]
+
+	values := make(map[string]string)
+	if cmd.Brightness != nil {
+		values["brightness"] = fmt.Sprint(*cmd.Brightness)
+	}
+	if cmd.Color != nil {
+		values["hue"] = fmt.Sprint(cmd.Color.H)
+		values["saturation"] = fmt.Sprint(cmd.Color.S)
+	}
+	if cmd.ColorTemp != nil {
+		values["kelvin"] = fmt.Sprint(*cmd.ColorTemp)
+		values["saturation"] = "0"
+	}
+
+	// The color is set before powering on so that the light does not flash its previous color.
+	if len(values) > 0 && cmd.State != stateOff {
+		if cmd.Transition != nil {
+			values["duration"] = fmt.Sprint(int(math.Round(*cmd.Transition)))
+		}
+		if err := b.send(d, "set_color", values); err != nil {
+			return err
+		}
+	}
+	switch {
+	case cmd.State == stateOn && !d.PoweredOn:
+		return b.send(d, "power_on", nil)
+	case cmd.State == stateOff:
+		return b.send(d, "power_off", nil)
+	}
+	return nil
+}
+
+// send delivers the command from the registry with the given params to the device.
+func (b *Bridge) send(d ldevice.Device, id string, values map[string]string) error {
+	cmd, ok := command.Find(id)
+	if !ok {
+		return fmt.Errorf("unknown command %q", id)
+	}
+	params, err := cmd.ParseParams(values)
+	if err != nil {
+		return err
+	}
+	msg, err := cmd.Handler(params...)
+	if err != nil {
+		return err
+	}
+	return controller.Deliver(context.Background(), b.c, d.Serial, b.policy, msg)
+}
+
+func (b *Bridge) publishAvailability(p Publisher, serial ldevice.Serial, online bool) error {
+	payload := payloadOffline
+	if online {
+		payload = payloadOnline
+	}
+	return p.Publish(b.topic(serial.String(), "availability"), []byte(payload), true)
+}
+
+// NewState returns the state of the light, in color temperature mode when it is unsaturated.
+func NewState(d ldevice.Device) State {
+	s := State{
+		State:      stateOff,
+		Brightness: int(math.Round(d.Color.Brightness)),
+		ColorMode:  "hs",
+		Color:      &HSColor{H: d.Color.Hue, S: d.Color.Saturation},
+		ColorTemp:  uint16(d.Color.Kelvin),
+	}
+	if d.PoweredOn {
+		s.State = stateOn
+	}
+	if d.Color.Saturation < 1 {
+		s.ColorMode = "color_temp"
+	}
+	return s
+}
+
+// discoveryConfig returns the Home Assistant MQTT discovery config of the light.
+func (b *Bridge) discoveryConfig(d ldevice.Device) map[string]any {
+	serial := d.Serial.String()
+	name := d.Label
+	if name == "" {
+		name = serial
+	}
+	return map[string]any{
+		"name":      nil,
+		"unique_id": "hikari_" + serial,
+		"schema":    "json",
+		"availability": []map[string]string{
+			{"topic": b.statusTopic()},
+			{"topic": b.topic(serial, "availability")},
+		},
+		"availability_mode":     "all",
+		"state_topic":           b.topic(serial, "state"),
+		"command_topic":         b.topic(serial, "set"),
+		"brightness":            true,
+		"brightness_scale":      100,
+		"supported_color_modes": []string{"hs", "color_temp"},
+		"color_temp_kelvin":     true,
+		"min_kelvin":            minKelvin,
+		"max_kelvin":            maxKelvin,
+		"device": map[string]any{
+			"identifiers":    []string{serial},
+			"connections":    [][]string{{"mac", mac(d.Serial)}},
+			"name":           name,
+			"manufacturer":   manufacturer,
+			"model":          d.RegistryName,
+			"sw_version":     fmt.Sprint(d.FirmwareVersion),
+			"suggested_area": d.Group,
+		},
+	}
+}
+
+func (b *Bridge) topic(serial, suffix string) string {
+	return b.prefix + "/" + serial + "/" + suffix
+}
+
+func (b *Bridge) statusTopic() string {
+	return b.prefix + "/status"
+}
+
+func (b *Bridge) discoveryTopic(serial ldevice.Serial) string {
+	return b.discoveryPrefix + "/light/hikari_" + serial.String() + "/config"
+}
+
+// mac formats the serial, which is the MAC address of the device, e.g. d0:73:d5:00:00:01.
+func mac(serial ldevice.Serial) string {
+	parts := make([]string, 6)
+	for i, v := range serial[:6] {
+		parts[i] = fmt.Sprintf("%02x", v)
+	}
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,219 @@
+package bridge
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/mqtt"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	kitchen = testdevice.Kitchen
+	lounge  = testdevice.Lounge
+	button  = testdevice.Button
+)
+
+// recorder is a Publisher recording the published messages.
+type recorder struct {
+	messages []mqtt.Message
+	done     chan struct{}
+}
+
+func (r *recorder) Publish(topic string, payload []byte, retain bool) error {
+	r.messages = append(r.messages, mqtt.Message{Topic: topic, Payload: payload, Retain: retain})
+	return nil
+}
+
+func (r *recorder) Subscribe(filters ...string) error { return nil }
+func (r *recorder) Done() <-chan struct{}             { return r.done }
+func (r *recorder) Err() error                        { return nil }
+
+// topics returns the topics published to since the last call.
+func (r *recorder) topics() []string {
+	var topics []string
+	for _, m := range r.messages {
+		topics = append(topics, m.Topic+" "+string(m.Payload))
+	}
+	r.messages = nil
+	return topics
+}
+
+func TestRefresh(t *testing.T) {
+	f := controller.NewFake(kitchen, button)
+	b := New(f, config.Default())
+	p := &recorder{}
+
+	if err := b.Refresh(p); err != nil {
+		t.Fatal(err)
+	}
+	got := p.messages
+	if len(got) != 3 {
+		t.Fatalf("Expected discovery, availability and state to be published, got %v", p.topics())
+	}
+	if got[0].Topic != "homeassistant/light/hikari_d073d5000001/config" || !got[0].Retain {
+		t.Errorf("Discovery does not match: got %s (retain %t)", got[0].Topic, got[0].Retain)
+	}
+	var discovery struct {
+		UniqueID     string `json:"unique_id"`
+		CommandTopic string `json:"command_topic"`
+		Device       struct {
+			Name        string     `json:"name"`
+			Model       string     `json:"model"`
+			Connections [][]string `json:"connections"`
+		} `json:"device"`
+	}
+	json.Unmarshal(got[0].Payload, &discovery)
+	if discovery.UniqueID != "hikari_d073d5000001" || discovery.CommandTopic != "hikari/d073d5000001/set" ||
+		discovery.Device.Name != "Kitchen" || discovery.Device.Model != "LIFX A19" ||
+		discovery.Device.Connections[0][1] != "d0:73:d5:00:00:01" {
+		t.Errorf("Discovery payload does not match: got %s", got[0].Payload)
+	}
+	if want := []string{
+		"hikari/d073d5000001/availability online",
+		`hikari/d073d5000001/state {"state":"ON","brightness":100,"color_mode":"color_temp","color":{"h":0,"s":0},"color_temp":3500}`,
+	}; !slices.Equal(p.topics()[1:], want) {
+		t.Errorf("Published topics do not match: want %v", want)
+	}
+
+	testCases := []struct {
+		name    string
+		devices []ldevice.Device
+		want    []string
+	}{
+		{
+			name:    "unchanged",
+			devices: []ldevice.Device{kitchen},
+		},
+		{
+			name: "power change",
+			devices: []ldevice.Device{func() ldevice.Device {
+				d := kitchen
+				d.PoweredOn = false
+				d.Color = ldevice.Color{Hue: 120, Saturation: 100, Brightness: 80, Kelvin: 2700}
+				return d
+			}()},
+			want: []string{`hikari/d073d5000001/state {"state":"OFF","brightness":80,"color_mode":"hs","color":{"h":120,"s":100},"color_temp":2700}`},
+		},
+		{
+			name: "lost device",
+			want: []string{"hikari/d073d5000001/availability offline"},
+		},
+		{
+			name:    "rediscovered device",
+			devices: []ldevice.Device{kitchen},
+			want: []string{
+				"hikari/d073d5000001/availability online",
+				`hikari/d073d5000001/state {"state":"ON","brightness":100,"color_mode":"color_temp","color":{"h":0,"s":0},"color_temp":3500}`,
+			},
+		},
+	}
+
+	// Steps are run in order, each starting from the state published by the previous one.
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f.SetDevices(tc.devices...)
+			if err := b.Refresh(p); err != nil {
+				t.Fatal(err)
+			}
+			if got := p.topics(); !slices.Equal(got, tc.want) {
+				t.Errorf("Published topics do not match: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandle(t *testing.T) {
+	testCases := map[string]struct {
+		topic    string
+		payload  string
+		wantSent []uint16
+		wantErr  string
+	}{
+		"power on": {
+			topic:    "hikari/d073d5000001/set",
+			payload:  `{"state":"ON"}`,
+			wantSent: []uint16{uint16(packets.PayloadTypeDeviceSetPower)},
+		},
+		"power off": {
+			topic:    "hikari/d073d5000001/set",
+			payload:  `{"state":"OFF","transition":2}`,
+			wantSent: []uint16{uint16(packets.PayloadTypeDeviceSetPower)},
+		},
+		"brightness and color temperature before power on": {
+			topic:    "hikari/d073d5000001/set",
+			payload:  `{"state":"ON","brightness":20,"color_temp":4000,"transition":1.5}`,
+			wantSent: []uint16{uint16(packets.PayloadTypeLightSetColor), uint16(packets.PayloadTypeDeviceSetPower)},
+		},
+		"color": {
+			topic:    "hikari/d073d5000001/set",
+			payload:  `{"color":{"h":240,"s":100}}`,
+			wantSent: []uint16{uint16(packets.PayloadTypeLightSetColor)},
+		},
+		"unknown device": {
+			topic:   "hikari/d073d50000ff/set",
+			payload: `{"state":"ON"}`,
+			wantErr: `device not found matching "d073d50000ff"`,
+		},
+		"invalid brightness": {
+			topic:   "hikari/d073d5000001/set",
+			payload: `{"brightness":150}`,
+			wantErr: "brightness: value out of range (0-100)",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			off := kitchen
+			off.PoweredOn = false
+			r := controller.NewRecorder(controller.NewFake(off))
+			cfg := config.Default()
+			cfg.SendTimeout = config.Duration(10 * time.Millisecond)
+			b := New(r, cfg)
+
+			err := b.apply(mqtt.Message{Topic: tc.topic, Payload: []byte(tc.payload)})
+			if err != nil && err.Error() != tc.wantErr || err == nil && tc.wantErr != "" {
+				t.Fatalf("Error does not match: got %v, want %q", err, tc.wantErr)
+			}
+			var sent []uint16
+			for _, c := range r.Calls() {
+				sent = append(sent, c.Payload.PayloadType())
+			}
+			if !slices.Equal(sent, tc.wantSent) {
+				t.Errorf("Sent messages do not match: got %v, want %v", sent, tc.wantSent)
+			}
+		})
+	}
+}
+
+func TestHandleUnresponsiveDevice(t *testing.T) {
+	f := controller.NewFake(kitchen, lounge)
+	f.Drop(kitchen.Serial, -1)
+	cfg := config.Default()
+	cfg.SendTimeout = config.Duration(time.Second)
+	cfg.SendRetries = 0
+	b := New(f, cfg)
+
+	// Kitchen does not acknowledge its command for a second, which must not delay the command to Lounge.
+	start := time.Now()
+	b.Handle(mqtt.Message{Topic: "hikari/" + kitchen.Serial.String() + "/set", Payload: []byte(`{"state":"OFF"}`)})
+	b.Handle(mqtt.Message{Topic: "hikari/" + lounge.Serial.String() + "/set", Payload: []byte(`{"state":"OFF"}`)})
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Handle blocked for %s", elapsed)
+	}
+
+	for deadline := time.Now().Add(500 * time.Millisecond); ; time.Sleep(10 * time.Millisecond) {
+		if d := f.GetDevices()[1]; !d.PoweredOn {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected Lounge to be powered off while Kitchen is not responding")
+		}
+	}
+}
@@ -0,0 +1,801 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/bridge"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/input"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/mqtt"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/multizone"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/routine"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/scene"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/schedule"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/server"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+)
+
+const (
+	defaultDiscoveryTimeout = 2 * time.Second
+	discoveryPollInterval   = 100 * time.Millisecond
+	effectPollInterval      = 200 * time.Millisecond
+	defaultListen           = ":8080"
+	shutdownTimeout         = 5 * time.Second
+	mqttKeepAlive           = 30 * time.Second
+	mqttReconnectDelay      = 5 * time.Second
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+	// exitTimeout is returned when a device did not acknowledge a command.
+	exitTimeout = 3
+	// exitOffline is returned when a target device was not found or went offline.
+	exitOffline = 4
+	// exitMismatch is returned when the state read back from a device differs from the command.
+	exitMismatch = 5
+)
+
+// newController returns the controller commands talk to devices through.
+var newController = func() (controller.Controller, error) {
+	return controller.New()
+}
+
+// errUsage is returned when a subcommand is called with flags it does not accept.
+var errUsage = errors.New("invalid usage")
+
+// stdout and stderr are where commands print their output and errors.
+var stdout, stderr io.Writer = os.Stdout, os.Stderr
+
+// aliases maps short subcommand names to command IDs.
+var aliases = map[string]string{
+	"on":         "power_on",
+	"off":        "power_off",
+	"color":      "set_color",
+	"brightness": "set_brightness",
+}
+
+// Run executes the subcommand in args[0] and returns the process exit code.
+func Run(cfg config.Config, args []string) int {
+	name, args := args[0], args[1:]
+
+	var err error
+	switch name {
+	case "help", "-h", "--help":
+		usage(stdout)
+		return exitOK
+	case "list":
+		err = runList(args)
+	case "scenes":
+		err = runScenes(args)
+	case "serve":
+		err = runServe(cfg, args)
+	case "mqtt":
+		err = runMQTT(cfg, args)
+	case "schedule":
+		err = runSchedule(cfg, args)
+	case "zones":
+		err = runZones(cfg, args)
+	default:
+		cmd, ok := lookup(name)
+		if !ok {
+			fmt.Fprintf(stderr, "Unknown command %q\n\n", name)
+			usage(stderr)
+			return exitUsage
+		}
+		err = runCommand(cmd, cfg, args)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		if errors.Is(err, errUsage) {
+			return exitUsage
+		}
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// exitCode returns the exit code reporting why a command was not delivered.
+func exitCode(err error) int {
+	switch controller.StatusOf(err) {
+	case controller.StatusTimedOut:
+		return exitTimeout
+	case controller.StatusOffline:
+		return exitOffline
+	}
+	if errors.Is(err, controller.ErrMismatch) {
+		return exitMismatch
+	}
+	return exitError
+}
+
+func lookup(name string) (command.Item, bool) {
+	if id, ok := aliases[name]; ok {
+		name = id
+	}
+	cmd, ok := command.Find(name)
+	if !ok || !runsFromArgs(cmd) {
+		return command.Item{}, false
+	}
+	return cmd, true
+}
+
+// runsFromArgs reports whether all the params of the command can be given on the command line,
+// which excludes the matrix grid of set_pixels.
+func runsFromArgs(cmd command.Item) bool {
+	for _, p := range cmd.ParamTypes {
+		if p.InputType == input.InputMatrixSelect {
+			return false
+		}
+	}
+	return true
+}
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", defaultDiscoveryTimeout, "Time to wait for device discovery")
+	asJSON := fs.Bool("json", false, "Print devices as a JSON array")
+	asNDJSON := fs.Bool("ndjson", false, "Print devices as newline-delimited JSON")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *asJSON && *asNDJSON {
+		return errors.New("--json and --ndjson are mutually exclusive")
+	}
+
+	c, err := newController()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	devices := discover(c, device.TargetAll, *timeout)
+	slices.SortFunc(devices, func(a, b ldevice.Device) int {
+		return strings.Compare(a.Label, b.Label)
+	})
+
+	switch {
+	case *asJSON:
+		return writeJSON(stdout, devices)
+	case *asNDJSON:
+		return writeNDJSON(stdout, devices)
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tLABEL\tGROUP\tLOCATION\tPOWER\tIP")
+	for _, d := range devices {
+		power := "off"
+		if d.PoweredOn {
+			power = "on"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Serial, d.Label, d.Group, d.Location, power, d.Address.IP)
+	}
+	return w.Flush()
+}
+
+// runZones prints the colors of the zones of the target strips and beams.
+func runZones(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("zones", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", defaultDiscoveryTimeout, "Time to wait for device discovery")
+	targets, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(targets) != 1 {
+		return errors.New("zones expects exactly one target")
+	}
+
+	c, err := newController()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	devices := discover(c, targets[0], *timeout)
+	if len(devices) == 0 {
+		return fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, targets[0])
+	}
+	slices.SortFunc(devices, func(a, b ldevice.Device) int {
+		return strings.Compare(a.Label, b.Label)
+	})
+
+	var errs []error
+	for _, d := range devices {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.SendTimeout.Std())
+		zones, err := multizone.Get(ctx, c, d.Serial)
+		cancel()
+		if errors.Is(err, controller.ErrUnhandled) {
+			err = errors.New("not a multizone device")
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", deviceName(d), err))
+			continue
+		}
+
+		fmt.Fprintf(stdout, "%s (%d zones)\n", deviceName(d), len(zones))
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ZONE\tHUE\tSATURATION\tBRIGHTNESS\tKELVIN")
+		for i, z := range zones {
+			fmt.Fprintf(w, "%d\t%.0f\t%.0f\t%.0f\t%d\n", i,
+				float64(z.Hue)*360/math.MaxUint16,
+				float64(z.Saturation)*100/math.MaxUint16,
+				float64(z.Brightness)*100/math.MaxUint16,
+				z.Kelvin,
+			)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func writeJSON(w io.Writer, devices []ldevice.Device) error {
+	records := make([]device.Record, len(devices))
+	for i, d := range devices {
+		records[i] = device.NewRecord(d)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+func writeNDJSON(w io.Writer, devices []ldevice.Device) error {
+	enc := json.NewEncoder(w)
+	for _, d := range devices {
+		if err := enc.Encode(device.NewRecord(d)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCommand(cmd command.Item, cfg config.Config, args []string) error {
+	if cmd.Type == command.CommandTypeScene {
+		if err := command.OpenSceneLibrary(); err != nil {
+			return err
+		}
+	}
+
+	fs := flag.NewFlagSet(cmd.ID, flag.ContinueOnError)
+	timeout := fs.Duration("timeout", defaultDiscoveryTimeout, "Time to wait for device discovery")
+	for _, p := range cmd.ParamTypes {
+		if fs.Lookup(p.Name) != nil {
+			return fmt.Errorf("%s: param %q clashes with the --%s flag", cmd.ID, p.Name, p.Name)
+		}
+		fs.String(p.Name, "", p.Description)
+	}
+
+	targets, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(targets) != 1 {
+		return fmt.Errorf("%s expects exactly one target", cmd.ID)
+	}
+
+	values := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "timeout" {
+			values[f.Name] = f.Value.String()
+		}
+	})
+	params, err := cmd.ParseParams(values)
+	if err != nil {
+		return err
+	}
+
+	c, err := newController()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	devices := discover(c, targets[0], *timeout)
+	if len(devices) == 0 {
+		return fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, targets[0])
+	}
+
+	policy := controller.PolicyFrom(cfg)
+	deliver := func(serial ldevice.Serial, msg *protocol.Message) error {
+		return controller.Deliver(context.Background(), c, serial, policy, msg)
+	}
+	switch cmd.Type {
+	case command.CommandTypeEffect:
+		return runEffect(c, cmd, devices, params)
+	case command.CommandTypeScene, command.CommandTypeZones, command.CommandTypeFirmware:
+		return runOnDevices(c, deliver, cmd, devices, params)
+	case command.CommandTypeRoutine:
+		return runRoutine(c, policy, cmd, devices, params)
+	}
+
+	if _, err := cmd.Handler(params...); err != nil {
+		return err
+	}
+	var expect *controller.Expectation
+	if cfg.Verify && cmd.Expect != nil {
+		if e := cmd.Expect(params...); !e.IsZero() {
+			expect = &e
+		}
+	}
+	return forEach(devices, func(d ldevice.Device) error {
+		msg, err := cmd.Handler(params...)
+		if err != nil {
+			return err
+		}
+		if err := deliver(d.Serial, msg); err != nil || expect == nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), expect.Transition+policy.Timeout)
+		defer cancel()
+		return controller.Verify(ctx, c, d.Serial, *expect)
+	})
+}
+
+// runEffect starts a matrix effect on every matrix device and blocks until
+// all effects complete or the process is interrupted.
+func runEffect(c controller.Controller, cmd command.Item, devices []ldevice.Device, params []command.ParamItem) error {
+	var errs []error
+	var stoppers []*atomic.Bool
+	for _, d := range devices {
+		if d.LightType != ldevice.LightTypeMatrix {
+			errs = append(errs, fmt.Errorf("%s: not a matrix device", deviceName(d)))
+			continue
+		}
+		serial := d.Serial
+		send := func(msg *protocol.Message) error {
+			return c.Send(serial, msg)
+		}
+		stopped, err := cmd.StartMatrixEffect(d.MatrixProperties, send, params...)
+		if err != nil {
+			return err
+		}
+		stoppers = append(stoppers, stopped)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	ticker := time.NewTicker(effectPollInterval)
+	defer ticker.Stop()
+
+	for slices.ContainsFunc(stoppers, func(s *atomic.Bool) bool { return !s.Load() }) {
+		select {
+		case <-sig:
+			for _, s := range stoppers {
+				s.Store(true)
+			}
+		case <-ticker.C:
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runRoutine runs a routine on the devices and blocks until it is over or the process is interrupted,
+// in which case the devices are left at their current color.
+func runRoutine(c controller.Controller, policy controller.RetryPolicy, cmd command.Item, devices []ldevice.Device, params []command.ParamItem) error {
+	ramp, err := cmd.RoutineHandler(params...)
+	if err != nil {
+		return err
+	}
+	// Routines are not persisted as nothing resumes them once the command exits.
+	r, err := routine.NewRunner(c, policy, "")
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = forEach(devices, func(d ldevice.Device) error {
+		return r.Start(d, ramp)
+	})
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	ticker := time.NewTicker(effectPollInterval)
+	defer ticker.Stop()
+
+	running := func(d ldevice.Device) bool {
+		_, ok := r.Get(d.Serial)
+		return ok
+	}
+	for slices.ContainsFunc(devices, running) {
+		select {
+		case <-sig:
+			for _, d := range devices {
+				r.Cancel(d.Serial)
+			}
+		case <-ticker.C:
+		}
+	}
+	return err
+}
+
+// runOnDevices runs a scene, zones or firmware effect command on the devices concurrently.
+func runOnDevices(c controller.Controller, send command.SendFunc, cmd command.Item, devices []ldevice.Device, params []command.ParamItem) error {
+	run, done, err := cmd.DeviceHandler(c, send, params...)
+	if err != nil {
+		return err
+	}
+	err = forEach(devices, run)
+	if done != nil {
+		err = errors.Join(err, done())
+	}
+	return err
+}
+
+// forEach runs fn for all devices concurrently and joins the errors, prefixed by the device name.
+func forEach(devices []ldevice.Device, fn func(ldevice.Device) error) error {
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(d); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", deviceName(d), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// runServe serves devices and commands over HTTP until the process is interrupted.
+func runServe(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := fs.String("listen", defaultListen, "Address to listen on")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("serve takes no arguments, got %q", args)
+	}
+	if err := command.OpenSceneLibrary(); err != nil {
+		return err
+	}
+
+	c, err := newController()
+	if err != nil {
+		return err
+	}
+	tracker := controller.NewTracker(c, cfg.PingInterval.Std(), cfg.OfflineAfter.Std())
+	defer tracker.Close()
+	srv := server.New(tracker, cfg)
+	defer srv.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hs := &http.Server{Addr: *listen, Handler: srv}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		hs.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(stderr, "Listening on %s\n", *listen)
+	if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// runMQTT bridges devices to the MQTT broker until the process is interrupted, reconnecting when the connection is lost.
+func runMQTT(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("mqtt", flag.ContinueOnError)
+	broker := fs.String("broker", cfg.MQTTBroker, "Address of the MQTT broker, e.g. localhost:1883")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return fmt.Errorf("mqtt takes no arguments, got %q", args)
+	}
+	if *broker == "" {
+		return errors.New("mqtt expects a broker, set with --broker or mqtt_broker")
+	}
+
+	clientID, err := mqttClientID(cfg.MQTTTopicPrefix)
+	if err != nil {
+		return err
+	}
+
+	c, err := newController()
+	if err != nil {
+		return err
+	}
+	tracker := controller.NewTracker(c, cfg.PingInterval.Std(), cfg.OfflineAfter.Std())
+	defer tracker.Close()
+	b := bridge.New(tracker, cfg)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := mqtt.Options{
+		ClientID:  clientID,
+		Username:  cfg.MQTTUsername,
+		Password:  cfg.MQTTPassword,
+		KeepAlive: mqttKeepAlive,
+		Will:      b.Will(),
+	}
+	for {
+		client, err := mqtt.Dial(ctx, *broker, opts, b.Handle)
+		if err == nil {
+			fmt.Fprintf(stderr, "Connected to %s\n", *broker)
+			err = b.Run(ctx, client)
+			client.Close()
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "MQTT: %v, reconnecting in %s\n", err, mqttReconnectDelay)
+		select {
+		case <-time.After(mqttReconnectDelay):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// mqttClientID returns a client ID made of the topic prefix and a random suffix,
+// as brokers disconnect a client when another one connects with the same ID.
+func mqttClientID(prefix string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate MQTT client ID: %w", err)
+	}
+	return fmt.Sprintf("%s-%x", prefix, suffix), nil
+}
+
+// runSchedule runs the schedules of the config until the process is interrupted, or lists them.
+func runSchedule(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"run"}
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("schedule takes at most one argument, got %q", args)
+	}
+	path, err := schedule.DefaultStatePath()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		s, err := schedule.New(nil, cfg, path)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tAT\tCOMMAND\tTARGET\tNEXT\tLAST RUN")
+		for _, st := range s.Status(time.Now()) {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", st.Name, st.At, st.Command, st.Target, formatNext(st.Next), formatLast(st.Last))
+		}
+		return tw.Flush()
+	case "run":
+	default:
+		return fmt.Errorf("unknown schedule command %q", args[0])
+	}
+
+	if len(cfg.Schedules) == 0 {
+		return errors.New("no schedules, add them to the schedules of the config file")
+	}
+	if err := command.OpenSceneLibrary(); err != nil {
+		return err
+	}
+	c, err := newController()
+	if err != nil {
+		return err
+	}
+	tracker := controller.NewTracker(c, cfg.PingInterval.Std(), cfg.OfflineAfter.Std())
+	defer tracker.Close()
+	s, err := schedule.New(tracker, cfg, path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	routinesPath, err := routine.DefaultPath("schedule")
+	if err != nil {
+		return err
+	}
+	// Routines left running when the scheduler last exited are resumed.
+	routines, err := routine.NewRunner(tracker, controller.PolicyFrom(cfg), routinesPath)
+	if err != nil {
+		return err
+	}
+	defer routines.Close()
+	s.UseRoutines(routines)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	for _, st := range s.Status(time.Now()) {
+		fmt.Fprintf(stderr, "%s: %s %s %s, next %s\n", st.Name, st.At, st.Command, st.Target, formatNext(st.Next))
+	}
+	return s.Run(ctx)
+}
+
+func formatNext(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.DateTime)
+}
+
+func formatLast(r *schedule.Result) string {
+	if r == nil {
+		return "never"
+	}
+	return r.Time.Format(time.DateTime) + " " + r.String()
+}
+
+// runScenes manages the scene library, which also holds presets.
+func runScenes(args []string) error {
+	if err := command.OpenSceneLibrary(); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		for _, name := range scene.Names() {
+			fmt.Fprintln(stdout, name)
+		}
+		return nil
+	case "presets":
+		for _, name := range scene.PresetNames() {
+			fmt.Fprintln(stdout, name)
+		}
+		return nil
+	case "export":
+		if len(args) < 2 || args[1] == "-" {
+			return scene.Export(stdout)
+		}
+		f, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		if err := scene.Export(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	case "import":
+		if len(args) < 2 {
+			return errors.New("import expects a file, use - for stdin")
+		}
+		r := os.Stdin
+		if args[1] != "-" {
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		scenes, presets, err := scene.Import(r)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Imported %d scenes and %d presets\n", scenes, presets)
+		return nil
+	}
+	return fmt.Errorf("unknown scenes command %q", args[0])
+}
+
+// discover polls the controller until a device matching target is found or the timeout expires.
+// Targeting multiple devices always waits for the full timeout.
+func discover(c controller.Controller, target string, timeout time.Duration) []ldevice.Device {
+	deadline := time.Now().Add(timeout)
+	multi := device.IsMulti(target)
+	for {
+		devices := device.Filter(c.GetDevices(), target)
+		if (len(devices) > 0 && !multi) || time.Now().After(deadline) {
+			return devices
+		}
+		time.Sleep(discoveryPollInterval)
+	}
+}
+
+// parseArgs parses flags and returns positional arguments, allowing
+// flags to appear before or after them.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %w", errUsage, err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func deviceName(d ldevice.Device) string {
+	if d.Label != "" {
+		return d.Label
+	}
+	return d.Serial.String()
+}
+
+func usage(w io.Writer) {
+	names := make(map[string]string, len(aliases))
+	for alias, id := range aliases {
+		names[id] = alias
+	}
+
+	fmt.Fprint(w, `Usage:
+  hikari                                    Launch the TUI
+  hikari list [--json|--ndjson]             List discovered devices
+  hikari scenes [command] [file]            Manage the scene library: list, presets, export or import
+  hikari serve [--listen :8080]             Serve devices and commands over HTTP
+  hikari mqtt [--broker localhost:1883]     Bridge devices to an MQTT broker and Home Assistant
+  hikari schedule [run|list]                Run the schedules of the config, or list their next runs
+  hikari zones <target>                     Print the zone colors of strips and beams
+  hikari <command> <target> [--param value] Send a command to the target devices
+
+A target is "all", "group:<name>", "location:<name>", a device serial or a device label.
+
+Commands wait for every device to acknowledge them and exit with status 3 when a device
+did not acknowledge in time, 4 when a device was not found and 1 on any other error.
+With --verify, power and color commands read back the state of the devices and exit
+with status 5 when it differs.
+
+Commands:
+`)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range command.Commands() {
+		if !runsFromArgs(c) {
+			continue
+		}
+		name := c.ID
+		if alias, ok := names[c.ID]; ok {
+			name = alias
+		}
+		var params []string
+		for _, p := range c.ParamTypes {
+			params = append(params, "--"+p.Name)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", name, c.Description, strings.Join(params, " "))
+	}
+	tw.Flush()
+}
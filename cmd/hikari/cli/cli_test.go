@@ -0,0 +1,379 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	kitchen = testdevice.Kitchen
+	lounge  = testdevice.Lounge
+)
+
+func TestParseArgs(t *testing.T) {
+	testCases := map[string]struct {
+		args           []string
+		wantPositional []string
+		wantTimeout    time.Duration
+		wantErr        bool
+	}{
+		"no args": {
+			wantTimeout: defaultDiscoveryTimeout,
+		},
+		"flags before target": {
+			args:           []string{"--timeout", "1s", "Kitchen"},
+			wantPositional: []string{"Kitchen"},
+			wantTimeout:    time.Second,
+		},
+		"flags after target": {
+			args:           []string{"Kitchen", "--timeout=3s"},
+			wantPositional: []string{"Kitchen"},
+			wantTimeout:    3 * time.Second,
+		},
+		"flags between targets": {
+			args:           []string{"Kitchen", "--timeout", "1s", "Lounge"},
+			wantPositional: []string{"Kitchen", "Lounge"},
+			wantTimeout:    time.Second,
+		},
+		"unknown flag": {
+			args:    []string{"Kitchen", "--brightness", "50"},
+			wantErr: true,
+		},
+		"invalid flag value": {
+			args:    []string{"--timeout", "soon"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			fs.SetOutput(io.Discard)
+			timeout := fs.Duration("timeout", defaultDiscoveryTimeout, "")
+
+			positional, err := parseArgs(fs, tc.args)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error does not match: got %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !slices.Equal(positional, tc.wantPositional) {
+				t.Errorf("Positional args do not match: got %q, want %q", positional, tc.wantPositional)
+			}
+			if *timeout != tc.wantTimeout {
+				t.Errorf("Timeout does not match: got %s, want %s", *timeout, tc.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	testCases := map[string]struct {
+		command    string
+		values     map[string]string
+		wantFound  bool
+		wantErr    bool
+		wantParams map[string]any
+	}{
+		"alias": {
+			command:    "color",
+			values:     map[string]string{"hue": "120", "kelvin": "2700"},
+			wantFound:  true,
+			wantParams: map[string]any{"hue": 120.0, "kelvin": uint16(2700)},
+		},
+		"command ID": {
+			command:    "set_brightness",
+			values:     map[string]string{"brightness": "40", "duration": "2"},
+			wantFound:  true,
+			wantParams: map[string]any{"brightness": 40.0, "duration": 2 * time.Second},
+		},
+		"invalid value": {
+			command:   "color",
+			values:    map[string]string{"hue": "400"},
+			wantFound: true,
+			wantErr:   true,
+		},
+		"unknown param": {
+			command:   "on",
+			values:    map[string]string{"hue": "120"},
+			wantFound: true,
+			wantErr:   true,
+		},
+		"missing required param": {
+			command:   "brightness",
+			values:    map[string]string{"duration": "2"},
+			wantFound: true,
+			wantErr:   true,
+		},
+		"matrix grid command": {
+			command: "set_pixels",
+		},
+		"removed alias": {
+			command: "pixels",
+		},
+		"unknown command": {
+			command: "dim",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cmd, ok := lookup(tc.command)
+			if ok != tc.wantFound {
+				t.Fatalf("Command found does not match: got %t, want %t", ok, tc.wantFound)
+			}
+			if !ok {
+				return
+			}
+
+			params, err := cmd.ParseParams(tc.values)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error does not match: got %v, want error %t", err, tc.wantErr)
+			}
+			for _, p := range params {
+				want, ok := tc.wantParams[p.Name]
+				if !ok {
+					want = nil
+				}
+				if got := paramValue(p); got != want {
+					t.Errorf("Param %s does not match: got %v, want %v", p.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// paramValue returns the value of a parsed param, nil if it was not given.
+func paramValue(p command.ParamItem) any {
+	switch v := command.SetParamValue[any](p).(type) {
+	case *float64:
+		if v != nil {
+			return *v
+		}
+	case *uint16:
+		if v != nil {
+			return *v
+		}
+	case time.Duration:
+		if v != 0 {
+			return v
+		}
+	}
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	testCases := map[string]struct {
+		args  []string
+		setup func(f *controller.Fake, cfg *config.Config)
+		// wantPowered are the devices expected to be powered on after the command.
+		wantPowered []ldevice.Serial
+		wantCode    int
+		wantStderr  string
+		check       func(t *testing.T, stdout string)
+	}{
+		"target by label": {
+			args:        []string{"off", "Kitchen", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{lounge.Serial},
+		},
+		"target by serial": {
+			args:        []string{"off", lounge.Serial.String(), "--timeout", "0"},
+			wantPowered: []ldevice.Serial{kitchen.Serial},
+		},
+		"target by group": {
+			args:        []string{"off", "group:Downstairs", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{lounge.Serial},
+		},
+		"target all": {
+			args: []string{"off", "all", "--timeout", "0"},
+		},
+		"unknown target": {
+			args:        []string{"off", "Garage", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitOffline,
+			wantStderr:  "device not found",
+		},
+		"missing target": {
+			args:        []string{"off"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitError,
+			wantStderr:  "expects exactly one target",
+		},
+		"unacknowledged command": {
+			args: []string{"off", "Kitchen", "--timeout", "0"},
+			setup: func(f *controller.Fake, cfg *config.Config) {
+				f.Drop(kitchen.Serial, -1)
+				cfg.SendRetries = 0
+				cfg.SendTimeout = config.Duration(10 * time.Millisecond)
+			},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitTimeout,
+			wantStderr:  "timed out",
+		},
+		"verified mismatch": {
+			args: []string{"off", "Kitchen", "--timeout", "0"},
+			setup: func(f *controller.Fake, cfg *config.Config) {
+				f.Apply = func(*ldevice.Device, packets.Payload) {}
+				cfg.Verify = true
+			},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitMismatch,
+			wantStderr:  "power on, want off",
+		},
+		"invalid param": {
+			args:        []string{"brightness", "Kitchen", "--brightness", "120", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitError,
+			wantStderr:  "brightness",
+		},
+		"unknown command": {
+			args:        []string{"pixels", "Kitchen"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitUsage,
+			wantStderr:  `Unknown command "pixels"`,
+		},
+		"unknown flag": {
+			args:        []string{"off", "Kitchen", "--colour", "red"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitUsage,
+			wantStderr:  "invalid usage: flag provided but not defined: -colour",
+		},
+		"invalid flag value": {
+			args:        []string{"list", "--timeout", "soon"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitUsage,
+			wantStderr:  "invalid usage",
+		},
+		"list": {
+			args:        []string{"list", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			check: func(t *testing.T, stdout string) {
+				lines := strings.Split(strings.TrimSpace(stdout), "\n")
+				if len(lines) != 3 || !strings.HasPrefix(lines[1], kitchen.Serial.String()) || !strings.HasPrefix(lines[2], lounge.Serial.String()) {
+					t.Errorf("Table does not match: got\n%s", stdout)
+				}
+			},
+		},
+		"list json": {
+			args:        []string{"list", "--json", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			check: func(t *testing.T, stdout string) {
+				var records []device.Record
+				if err := json.Unmarshal([]byte(stdout), &records); err != nil {
+					t.Fatal(err)
+				}
+				want := []device.Record{device.NewRecord(kitchen), device.NewRecord(lounge)}
+				if len(records) != len(want) {
+					t.Fatalf("Records do not match: got %d, want %d", len(records), len(want))
+				}
+				for i := range want {
+					if records[i].Serial != want[i].Serial || records[i].Label != want[i].Label || records[i].Group != want[i].Group {
+						t.Errorf("Record %d does not match: got %+v, want %+v", i, records[i], want[i])
+					}
+				}
+			},
+		},
+		"list ndjson": {
+			args:        []string{"list", "--ndjson", "--timeout", "0"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			check: func(t *testing.T, stdout string) {
+				lines := strings.Split(strings.TrimSpace(stdout), "\n")
+				if len(lines) != 2 {
+					t.Fatalf("Lines do not match: got %d, want 2", len(lines))
+				}
+				for i, d := range []ldevice.Device{kitchen, lounge} {
+					var r device.Record
+					if err := json.Unmarshal([]byte(lines[i]), &r); err != nil {
+						t.Fatal(err)
+					}
+					if r.Serial != d.Serial.String() || r.Label != d.Label {
+						t.Errorf("Record %d does not match: got %+v, want %s %s", i, r, d.Serial, d.Label)
+					}
+				}
+			},
+		},
+		"list json and ndjson": {
+			args:        []string{"list", "--json", "--ndjson"},
+			wantPowered: []ldevice.Serial{kitchen.Serial, lounge.Serial},
+			wantCode:    exitError,
+			wantStderr:  "mutually exclusive",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := controller.NewFake(kitchen, lounge)
+			cfg := config.Default()
+			if tc.setup != nil {
+				tc.setup(f, &cfg)
+			}
+			outBuf, errBuf := fakeCLI(t, f)
+
+			if code := Run(cfg, tc.args); code != tc.wantCode {
+				t.Errorf("Exit code does not match: got %d, want %d (stderr %q)", code, tc.wantCode, errBuf)
+			}
+			if !strings.Contains(errBuf.String(), tc.wantStderr) {
+				t.Errorf("Stderr does not match: got %q, want it to contain %q", errBuf, tc.wantStderr)
+			}
+			if tc.check != nil {
+				tc.check(t, outBuf.String())
+			}
+
+			var powered []ldevice.Serial
+			for _, d := range f.GetDevices() {
+				if d.PoweredOn {
+					powered = append(powered, d.Serial)
+				}
+			}
+			if !slices.Equal(powered, tc.wantPowered) {
+				t.Errorf("Powered devices do not match: got %v, want %v", powered, tc.wantPowered)
+			}
+		})
+	}
+}
+
+// fakeCLI makes the CLI talk to f and returns the buffers it prints to.
+func fakeCLI(t *testing.T, f *controller.Fake) (*bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	origController, origStdout, origStderr := newController, stdout, stderr
+	t.Cleanup(func() {
+		newController, stdout, stderr = origController, origStdout, origStderr
+	})
+
+	var outBuf, errBuf bytes.Buffer
+	newController = func() (controller.Controller, error) { return f, nil }
+	stdout, stderr = &outBuf, &errBuf
+	return &outBuf, &errBuf
+}
+
+func TestMQTTClientID(t *testing.T) {
+	a, err := mqttClientID("hikari")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := mqttClientID("hikari")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(a, "hikari-") || len(a) != len("hikari-")+8 {
+		t.Errorf("Client ID does not match: got %q, want hikari- and 8 hex digits", a)
+	}
+	if a == b {
+		t.Errorf("Expected client IDs to differ, got %q twice", a)
+	}
+}
@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -9,9 +11,14 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/firmware"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/input"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
 	hlist "github.com/alessio-palumbo/hikari/cmd/hikari/list"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/multizone"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/routine"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/scene"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
 	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
 	"github.com/alessio-palumbo/lifxlan-go/pkg/matrix"
@@ -31,6 +38,10 @@ var commands = []Command{
 		Handler: func(params ...ParamItem) (*protocol.Message, error) {
 			return messages.SetPowerOn(), nil
 		},
+		Expect: func(params ...ParamItem) controller.Expectation {
+			on := true
+			return controller.Expectation{PoweredOn: &on}
+		},
 		ParamTypes: []paramType{},
 	},
 	{
@@ -41,6 +52,10 @@ var commands = []Command{
 		Handler: func(params ...ParamItem) (*protocol.Message, error) {
 			return messages.SetPowerOff(), nil
 		},
+		Expect: func(params ...ParamItem) controller.Expectation {
+			on := false
+			return controller.Expectation{PoweredOn: &on}
+		},
 		ParamTypes: []paramType{},
 	},
 	{
@@ -55,6 +70,15 @@ var commands = []Command{
 			return messages.SetColor(SetParamValue[*float64](params[0]), SetParamValue[*float64](params[1]), SetParamValue[*float64](params[2]),
 				SetParamValue[*uint16](params[3]), SetParamValue[time.Duration](params[4]), enums.LightWaveformLIGHTWAVEFORMSAW), nil
 		},
+		Expect: func(params ...ParamItem) controller.Expectation {
+			return controller.Expectation{
+				Hue:        SetParamValue[*float64](params[0]),
+				Saturation: SetParamValue[*float64](params[1]),
+				Brightness: SetParamValue[*float64](params[2]),
+				Kelvin:     SetParamValue[*uint16](params[3]),
+				Transition: SetParamValue[time.Duration](params[4]),
+			}
+		},
 		ParamTypes: []paramType{
 			{Name: "hue", InputType: input.InputText, Required: false, Description: "Hue (0-360)", Validator: HueValidator},
 			{Name: "saturation", InputType: input.InputText, Required: false, Description: "Saturation (0-100)", Validator: PercentageValidator},
@@ -76,11 +100,69 @@ var commands = []Command{
 				SetParamValue[time.Duration](params[1]), enums.LightWaveformLIGHTWAVEFORMSAW,
 			), nil
 		},
+		Expect: func(params ...ParamItem) controller.Expectation {
+			return controller.Expectation{
+				Brightness: SetParamValue[*float64](params[0]),
+				Transition: SetParamValue[time.Duration](params[1]),
+			}
+		},
 		ParamTypes: []paramType{
 			{Name: "brightness", InputType: input.InputText, Required: true, Description: "Brightness (0-100)", Validator: PercentageValidator},
 			{Name: "duration", InputType: input.InputText, Required: false, Description: "Transition seconds", Validator: DurationValidator},
 		},
 	},
+	{
+		ID:          "waveform",
+		Name:        "Waveform",
+		Type:        CommandTypeSetter,
+		Description: "Breathe, pulse or strobe the device color",
+		Handler: func(params ...ParamItem) (*protocol.Message, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, err
+			}
+
+			hue, saturation := SetParamValue[*float64](params[1]), SetParamValue[*float64](params[2])
+			brightness, kelvin := SetParamValue[*float64](params[3]), SetParamValue[*uint16](params[4])
+			if hue == nil && saturation == nil && brightness == nil && kelvin == nil {
+				return nil, fmt.Errorf("one of hue, saturation, brightness or kelvin must be set")
+			}
+			p := &packets.LightSetWaveformOptional{
+				Transient:     SetParamValue[bool](params[8]),
+				Period:        uint32(SetParamValue[int64](params[5])),
+				Cycles:        float32(SetParamValue[float64](params[6])),
+				SkewRatio:     skewRatio(SetParamValue[float64](params[7])),
+				Waveform:      SetParamValue[enums.LightWaveform](params[0]),
+				SetHue:        hue != nil,
+				SetSaturation: saturation != nil,
+				SetBrightness: brightness != nil,
+				SetKelvin:     kelvin != nil,
+			}
+			if hue != nil {
+				p.Color.Hue = uint16(math.Round(*hue / 360 * math.MaxUint16))
+			}
+			if saturation != nil {
+				p.Color.Saturation = uint16(math.Round(*saturation / 100 * math.MaxUint16))
+			}
+			if brightness != nil {
+				p.Color.Brightness = uint16(math.Round(*brightness / 100 * math.MaxUint16))
+			}
+			if kelvin != nil {
+				p.Color.Kelvin = *kelvin
+			}
+			return protocol.NewMessage(p), nil
+		},
+		ParamTypes: []paramType{
+			{Name: "waveform", InputType: input.InputSingleSelectInline, InputOptions: optionWaveforms, Required: false, Description: "Shape of the waveform", Validator: WaveformValidator, Default: enums.LightWaveformLIGHTWAVEFORMSINE},
+			{Name: "hue", InputType: input.InputText, Required: false, Description: "Hue (0-360)", Validator: HueValidator},
+			{Name: "saturation", InputType: input.InputText, Required: false, Description: "Saturation (0-100)", Validator: PercentageValidator},
+			{Name: "brightness", InputType: input.InputText, Required: false, Description: "Brightness (0-100)", Validator: PercentageValidator},
+			{Name: "kelvin", InputType: input.InputText, Required: false, Description: "Kelvin (1500-9000)", Validator: KelvinValidator},
+			{Name: "period", InputType: input.InputText, Required: false, Description: "Ms per cycle", Validator: PeriodValidator, Default: int64(1000)},
+			{Name: "cycles", InputType: input.InputText, Required: false, Description: "Times the waveform repeats", Validator: PositiveNumberValidator, Default: float64(3)},
+			{Name: "skew_ratio", InputType: input.InputText, Required: false, Description: "Time at the color (0-100)", Validator: PercentageValidator, Default: float64(50)},
+			{Name: "transient", InputType: input.InputSingleSelectInline, InputOptions: optionBool, Required: false, Description: "Return to the original color", Validator: BoolValidator, Default: true},
+		},
+	},
 	{
 		ID:          "set_pixels",
 		Name:        "Set Pixels",
@@ -115,6 +197,86 @@ var commands = []Command{
 			{Name: "pixels", InputType: input.InputMatrixSelect, Required: false, Description: "Toggle pixels", Validator: MatrixValidator},
 		},
 	},
+	{
+		ID:          "set_zones",
+		Name:        "Set Zones",
+		Type:        CommandTypeZones,
+		Description: "Set a zone or a range of zones of a strip",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			hue, saturation := SetParamValue[*float64](params[2]), SetParamValue[*float64](params[3])
+			brightness, kelvin := SetParamValue[*float64](params[4]), SetParamValue[*uint16](params[5])
+			if hue == nil && saturation == nil && brightness == nil && kelvin == nil {
+				return nil, nil, fmt.Errorf("one of hue, saturation, brightness or kelvin must be set")
+			}
+			return func(d ldevice.Device) error {
+				zones, start, end, err := readZones(q, d, params[0], params[1])
+				if err != nil {
+					return err
+				}
+				for i := start; i <= end; i++ {
+					if hue != nil {
+						zones[i].Hue = uint16(math.Round(*hue / 360 * math.MaxUint16))
+					}
+					if saturation != nil {
+						zones[i].Saturation = uint16(math.Round(*saturation / 100 * math.MaxUint16))
+					}
+					if brightness != nil {
+						zones[i].Brightness = uint16(math.Round(*brightness / 100 * math.MaxUint16))
+					}
+					if kelvin != nil {
+						zones[i].Kelvin = *kelvin
+					}
+				}
+				return sendAll(d.Serial, send, multizone.Set(start, zones[start:end+1], SetParamValue[time.Duration](params[6])))
+			}, nil, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "start", InputType: input.InputText, Required: false, Description: "First zone (default 0)", Validator: ZoneValidator},
+			{Name: "end", InputType: input.InputText, Required: false, Description: "Last zone (default last)", Validator: ZoneValidator},
+			{Name: "hue", InputType: input.InputText, Required: false, Description: "Hue (0-360)", Validator: HueValidator},
+			{Name: "saturation", InputType: input.InputText, Required: false, Description: "Saturation (0-100)", Validator: PercentageValidator},
+			{Name: "brightness", InputType: input.InputText, Required: false, Description: "Brightness (0-100)", Validator: PercentageValidator},
+			{Name: "kelvin", InputType: input.InputText, Required: false, Description: "Kelvin (1500-9000)", Validator: KelvinValidator},
+			{Name: "duration", InputType: input.InputText, Required: false, Description: "Transition seconds", Validator: DurationValidator},
+		},
+	},
+	{
+		ID:          "zone_gradient",
+		Name:        "Zone Gradient",
+		Type:        CommandTypeZones,
+		Description: "Blend colors across the zones of a strip",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			brightness := uint16(math.Round(SetParamValue[float64](params[1]) * math.MaxUint16 / 100))
+			var stops []packets.LightHsbk
+			for c := range strings.SplitSeq(SetParamValue[string](params[0]), ",") {
+				stops = append(stops, packets.LightHsbk{
+					Hue: colorNamesToHue[c], Saturation: math.MaxUint16, Brightness: brightness, Kelvin: 3500,
+				})
+			}
+			return func(d ldevice.Device) error {
+				_, start, end, err := readZones(q, d, params[2], params[3])
+				if err != nil {
+					return err
+				}
+				return sendAll(d.Serial, send, multizone.Set(start, multizone.Gradient(stops, end-start+1), SetParamValue[time.Duration](params[4])))
+			}, nil, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "colors", InputType: input.InputMultiSelect, InputOptions: optionColors, Required: true, Description: "Colors of the gradient", Validator: ColorListValidator},
+			{Name: "brightness", InputType: input.InputText, Required: false, Description: "Brightness (0-100)", Validator: PercentageValidator, Default: float64(100)},
+			{Name: "start", InputType: input.InputText, Required: false, Description: "First zone (default 0)", Validator: ZoneValidator},
+			{Name: "end", InputType: input.InputText, Required: false, Description: "Last zone (default last)", Validator: ZoneValidator},
+			{Name: "duration", InputType: input.InputText, Required: false, Description: "Transition seconds", Validator: DurationValidator},
+		},
+	},
 	{
 		ID:          "waterfall_effect",
 		Name:        "Waterfall Effect",
@@ -285,6 +447,212 @@ var commands = []Command{
 			{Name: "color", InputType: input.InputSingleSelect, InputOptions: optionColors, Required: false, Description: "Color of the frames", Validator: ColorListValidator},
 		},
 	},
+	{
+		ID:          "firmware_effect",
+		Name:        "Firmware Effect",
+		Type:        CommandTypeFirmware,
+		Description: "Start an effect running on the device itself",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			settings := firmware.Settings{
+				Effect:    SetParamValue[firmware.Effect](params[0]),
+				Speed:     time.Duration(SetParamValue[float64](params[1]) * float64(time.Second)),
+				Direction: SetParamValue[string](params[2]),
+				SkyType:   SetParamValue[string](params[4]),
+			}
+			if palette := SetParamValue[string](params[3]); palette != "" {
+				for c := range strings.SplitSeq(palette, ",") {
+					settings.Palette = append(settings.Palette, packets.LightHsbk{
+						Hue: colorNamesToHue[c], Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500,
+					})
+				}
+			}
+			return func(d ldevice.Device) error {
+				ctx, cancel := context.WithTimeout(context.Background(), zoneQueryTimeout)
+				defer cancel()
+				msg, err := firmware.Start(ctx, q, d, settings)
+				if err != nil {
+					return err
+				}
+				return send(d.Serial, msg)
+			}, nil, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "effect", InputType: input.InputSingleSelectInline, InputOptions: optionFirmwareEffects, Required: true, Description: "move for strips, morph, flame or sky for matrix devices", Validator: FirmwareEffectValidator},
+			{Name: "speed", InputType: input.InputText, Required: false, Description: "Seconds per cycle (default 5)", Validator: PositiveNumberValidator, Default: float64(5)},
+			{Name: "direction", InputType: input.InputSingleSelectInline, InputOptions: firmware.Directions, Required: false, Description: "Direction of move", Validator: MoveDirectionValidator, Default: firmware.DirectionRight},
+			{Name: "palette", InputType: input.InputMultiSelect, InputOptions: optionColors, Required: false, Description: "Colors of morph", Validator: ColorListValidator},
+			{Name: "sky", InputType: input.InputSingleSelectInline, InputOptions: firmware.SkyTypes, Required: false, Description: "Kind of sky", Validator: SkyTypeValidator, Default: firmware.SkyClouds},
+		},
+	},
+	{
+		ID:          "stop_firmware_effect",
+		Name:        "Stop Firmware Effect",
+		Type:        CommandTypeFirmware,
+		Description: "Stop the effect running on the device itself",
+		DeviceHandler: func(q scene.Querier, send SendFunc, _ ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			return func(d ldevice.Device) error {
+				ctx, cancel := context.WithTimeout(context.Background(), zoneQueryTimeout)
+				defer cancel()
+				msg, err := firmware.Stop(ctx, q, d)
+				if err != nil {
+					return err
+				}
+				return send(d.Serial, msg)
+			}, nil, nil
+		},
+	},
+	{
+		ID:          "routine",
+		Name:        "Routine",
+		Type:        CommandTypeRoutine,
+		Description: "Ramp brightness and kelvin over a long period",
+		RoutineHandler: func(params ...ParamItem) (routine.Ramp, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return routine.Ramp{}, err
+			}
+			return routine.Ramp{
+				FromBrightness: SetParamValue[float64](params[0]),
+				FromKelvin:     SetParamValue[uint16](params[1]),
+				ToBrightness:   SetParamValue[float64](params[2]),
+				ToKelvin:       SetParamValue[uint16](params[3]),
+				Duration:       SetParamValue[time.Duration](params[4]),
+				Curve:          SetParamValue[string](params[5]),
+				PowerOff:       SetParamValue[string](params[6]) == atEndPowerOff,
+			}, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "from_brightness", InputType: input.InputText, Required: false, Description: "Brightness (0-100)", Validator: PercentageValidator, Default: float64(1)},
+			{Name: "from_kelvin", InputType: input.InputText, Required: false, Description: "Kelvin (1500-9000)", Validator: KelvinValidator, Default: uint16(2000)},
+			{Name: "to_brightness", InputType: input.InputText, Required: false, Description: "Brightness (0-100)", Validator: PercentageValidator, Default: float64(80)},
+			{Name: "to_kelvin", InputType: input.InputText, Required: false, Description: "Kelvin (1500-9000)", Validator: KelvinValidator, Default: uint16(4000)},
+			{Name: "length", InputType: input.InputText, CharLimit: rampLengthCharLimit, Required: true, Description: "Ramp length (e.g. 30m)", Validator: RampLengthValidator},
+			{Name: "curve", InputType: input.InputSingleSelectInline, InputOptions: routine.Curves, Required: false, Description: "Shape of the ramp", Validator: CurveValidator, Default: routine.CurveLinear},
+			{Name: "at_end", InputType: input.InputSingleSelectInline, InputOptions: optionAtEnd, Required: false, Description: "Power state once over", Validator: AtEndValidator, Default: atEndStayOn},
+		},
+	},
+	{
+		ID:          "save_scene",
+		Name:        "Save Scene",
+		Type:        CommandTypeScene,
+		Description: "Snapshot power and colors of the devices",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			draft := scene.NewDraft(SetParamValue[string](params[0]))
+			return func(d ldevice.Device) error {
+				ctx, cancel := context.WithTimeout(context.Background(), sceneCaptureTimeout)
+				defer cancel()
+				return draft.Capture(ctx, q, d)
+			}, draft.Save, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "name", InputType: input.InputText, CharLimit: sceneNameCharLimit, Required: true, Description: "Scene name", Validator: SceneNameValidator},
+		},
+	},
+	{
+		ID:          "recall_scene",
+		Name:        "Recall Scene",
+		Type:        CommandTypeScene,
+		Description: "Restore a saved scene on the devices",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			name := SetParamValue[string](params[0])
+			s, ok := scene.Get(name)
+			if !ok {
+				return nil, nil, fmt.Errorf("scene %s not found", name)
+			}
+			duration := SetParamValue[time.Duration](params[1])
+			return func(d ldevice.Device) error {
+				state, ok := s.Device(d.Serial.String(), d.Label)
+				if !ok {
+					return fmt.Errorf("not in scene %s", name)
+				}
+				return state.Recall(duration, func(msg *protocol.Message) error {
+					return send(d.Serial, msg)
+				})
+			}, nil, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "name", InputType: input.InputSingleSelect, InputOptionsFunc: scene.Names, Required: true, Description: "Scene name", Validator: SceneValidator},
+			{Name: "duration", InputType: input.InputText, Required: false, Description: "Transition seconds", Validator: DurationValidator, Default: time.Second},
+		},
+	},
+	{
+		ID:          "save_preset",
+		Name:        "Save Preset",
+		Type:        CommandTypeScene,
+		Description: "Save a color to recall on any device",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			// Color components that are not set are taken from the device.
+			hue, saturation := SetParamValue[*float64](params[1]), SetParamValue[*float64](params[2])
+			brightness, kelvin := SetParamValue[*float64](params[3]), SetParamValue[*uint16](params[4])
+			draft := scene.NewPresetDraft(SetParamValue[string](params[0]))
+			return func(d ldevice.Device) error {
+				c := scene.HSBK{Hue: d.Color.Hue, Saturation: d.Color.Saturation, Brightness: d.Color.Brightness, Kelvin: uint16(d.Color.Kelvin)}
+				if hue != nil {
+					c.Hue = *hue
+				}
+				if saturation != nil {
+					c.Saturation = *saturation
+				}
+				if brightness != nil {
+					c.Brightness = *brightness
+				}
+				if kelvin != nil {
+					c.Kelvin = *kelvin
+				}
+				draft.Add(c)
+				return nil
+			}, draft.Save, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "name", InputType: input.InputText, CharLimit: sceneNameCharLimit, Required: true, Description: "Preset name", Validator: SceneNameValidator},
+			{Name: "hue", InputType: input.InputText, Required: false, Description: "Hue (0-360)", Validator: HueValidator},
+			{Name: "saturation", InputType: input.InputText, Required: false, Description: "Saturation (0-100)", Validator: PercentageValidator},
+			{Name: "brightness", InputType: input.InputText, Required: false, Description: "Brightness (0-100)", Validator: PercentageValidator},
+			{Name: "kelvin", InputType: input.InputText, Required: false, Description: "Kelvin (1500-9000)", Validator: KelvinValidator},
+		},
+	},
+	{
+		ID:          "recall_preset",
+		Name:        "Recall Preset",
+		Type:        CommandTypeScene,
+		Description: "Apply a saved color to the devices",
+		DeviceHandler: func(q scene.Querier, send SendFunc, params ...ParamItem) (func(ldevice.Device) error, func() error, error) {
+			if err := ValidateRequired(params...); err != nil {
+				return nil, nil, err
+			}
+
+			name := SetParamValue[string](params[0])
+			p, ok := scene.GetPreset(name)
+			if !ok {
+				return nil, nil, fmt.Errorf("preset %s not found", name)
+			}
+			duration := SetParamValue[time.Duration](params[1])
+			return func(d ldevice.Device) error {
+				return p.Recall(duration, func(msg *protocol.Message) error {
+					return send(d.Serial, msg)
+				})
+			}, nil, nil
+		},
+		ParamTypes: []paramType{
+			{Name: "name", InputType: input.InputSingleSelect, InputOptionsFunc: scene.PresetNames, Required: true, Description: "Preset name", Validator: PresetValidator},
+			{Name: "duration", InputType: input.InputText, Required: false, Description: "Transition seconds", Validator: DurationValidator, Default: time.Second},
+		},
+	},
 }
 
 type commandType int
@@ -292,8 +660,31 @@ type commandType int
 const (
 	CommandTypeSetter commandType = iota
 	CommandTypeEffect
+	CommandTypeScene
+	CommandTypeRoutine
+	CommandTypeZones
+	CommandTypeFirmware
 )
 
+func (t commandType) String() string {
+	switch t {
+	case CommandTypeEffect:
+		return "effect"
+	case CommandTypeScene:
+		return "scene"
+	case CommandTypeRoutine:
+		return "routine"
+	case CommandTypeZones:
+		return "zones"
+	case CommandTypeFirmware:
+		return "firmware"
+	}
+	return "setter"
+}
+
+// SendFunc sends a message to the device with the given serial.
+type SendFunc func(serial ldevice.Serial, msg *protocol.Message) error
+
 // Command represents a backend command with metadata
 type Command struct {
 	ID                  string
@@ -302,8 +693,14 @@ type Command struct {
 	Description         string
 	Handler             func(args ...ParamItem) (*protocol.Message, error)
 	MatrixEffectHandler func(m *matrix.Matrix, send matrix.SendFunc, args ...ParamItem) (func() error, error)
-	EffectStopper       *atomic.Bool
-	ParamTypes          []paramType
+	// DeviceHandler runs scene, zone and firmware effect commands,
+	// whose messages depend on the state or the kind of every device they run on.
+	// The returned done, when not nil, completes the command once it ran on every device, e.g. saving a captured scene.
+	DeviceHandler  func(q scene.Querier, send SendFunc, args ...ParamItem) (run func(d ldevice.Device) error, done func() error, err error)
+	RoutineHandler func(args ...ParamItem) (routine.Ramp, error)
+	Expect         func(args ...ParamItem) controller.Expectation
+	EffectStopper  *atomic.Bool
+	ParamTypes     []paramType
 }
 
 // Item implements list.Item interface.
@@ -337,6 +734,25 @@ func (i Item) StartMatrixEffect(mProps ldevice.MatrixProperties, send matrix.Sen
 	return stopped, nil
 }
 
+// Find returns the command registered with the given ID.
+func Find(id string) (Item, bool) {
+	for _, c := range commands {
+		if c.ID == id {
+			return Item(c), true
+		}
+	}
+	return Item{}, false
+}
+
+// Commands returns all registered commands in display order.
+func Commands() []Item {
+	items := make([]Item, len(commands))
+	for i, c := range commands {
+		items[i] = Item(c)
+	}
+	return items
+}
+
 func NewList() list.Model {
 	padFunc := utils.RightPadder(commands, func(c Command) int { return len(c.Name) })
 	renderFunc := func(w io.Writer, m list.Model, index int, listItem list.Item) {
@@ -369,6 +785,49 @@ func NewList() list.Model {
 	return l
 }
 
+// readZones returns the zone colors of a strip along with the range of zones to set,
+// defaulting to all of them when start or end are not set.
+func readZones(q scene.Querier, d ldevice.Device, startParam, endParam ParamItem) ([]packets.LightHsbk, int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), zoneQueryTimeout)
+	defer cancel()
+	zones, err := multizone.Get(ctx, q, d.Serial)
+	if errors.Is(err, controller.ErrUnhandled) {
+		return nil, 0, 0, fmt.Errorf("not a multizone device")
+	}
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to read zones: %w", err)
+	}
+
+	start, end := 0, len(zones)-1
+	if v := SetParamValue[*int64](startParam); v != nil {
+		start = int(*v)
+	}
+	if v := SetParamValue[*int64](endParam); v != nil {
+		end = int(*v)
+	}
+	if start > end || end >= len(zones) {
+		return nil, 0, 0, fmt.Errorf("zones %d-%d out of range (0-%d)", start, end, len(zones)-1)
+	}
+	return zones, start, end, nil
+}
+
+// sendAll sends msgs to the device in order, stopping at the first error.
+func sendAll(serial ldevice.Serial, send SendFunc, msgs []*protocol.Message) error {
+	for _, msg := range msgs {
+		if err := send(serial, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skewRatio converts a percentage of each cycle spent at the waveform color to the protocol skew ratio,
+// e.g. the duty cycle of a pulse.
+func skewRatio(percent float64) int16 {
+	// Rounding before the offset maps 50% to 0, a symmetric waveform.
+	return int16(math.Round(percent/100*math.MaxUint16) + math.MinInt16)
+}
+
 func parseFloat64Input(s string) (*float64, error) {
 	v, err := strconv.ParseFloat(s, 64)
 	if err != nil {
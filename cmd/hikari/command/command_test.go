@@ -0,0 +1,117 @@
+package command
+
+import (
+	"math"
+	"testing"
+
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestWaveform(t *testing.T) {
+	testCases := map[string]struct {
+		values       map[string]string
+		wantParseErr bool
+		wantErr      bool
+		want         packets.LightSetWaveformOptional
+	}{
+		"defaults": {
+			values: map[string]string{"hue": "120"},
+			want: packets.LightSetWaveformOptional{
+				Transient: true,
+				Color:     packets.LightHsbk{Hue: 21845},
+				Period:    1000,
+				Cycles:    3,
+				SkewRatio: 0,
+				Waveform:  enums.LightWaveformLIGHTWAVEFORMSINE,
+				SetHue:    true,
+			},
+		},
+		"skew ratio 0%": {
+			values: map[string]string{"waveform": "pulse", "brightness": "100", "skew_ratio": "0"},
+			want: packets.LightSetWaveformOptional{
+				Transient:     true,
+				Color:         packets.LightHsbk{Brightness: math.MaxUint16},
+				Period:        1000,
+				Cycles:        3,
+				SkewRatio:     math.MinInt16,
+				Waveform:      enums.LightWaveformLIGHTWAVEFORMPULSE,
+				SetBrightness: true,
+			},
+		},
+		"skew ratio 100%": {
+			values: map[string]string{"waveform": "pulse", "brightness": "100", "skew_ratio": "100"},
+			want: packets.LightSetWaveformOptional{
+				Transient:     true,
+				Color:         packets.LightHsbk{Brightness: math.MaxUint16},
+				Period:        1000,
+				Cycles:        3,
+				SkewRatio:     math.MaxInt16,
+				Waveform:      enums.LightWaveformLIGHTWAVEFORMPULSE,
+				SetBrightness: true,
+			},
+		},
+		"all fields": {
+			values: map[string]string{
+				"waveform": "saw", "hue": "240", "saturation": "50", "brightness": "25", "kelvin": "2700",
+				"period": "250", "cycles": "1.5", "skew_ratio": "25", "transient": "false",
+			},
+			want: packets.LightSetWaveformOptional{
+				Color:         packets.LightHsbk{Hue: 43690, Saturation: 32768, Brightness: 16384, Kelvin: 2700},
+				Period:        250,
+				Cycles:        1.5,
+				SkewRatio:     -16384,
+				Waveform:      enums.LightWaveformLIGHTWAVEFORMSAW,
+				SetHue:        true,
+				SetSaturation: true,
+				SetBrightness: true,
+				SetKelvin:     true,
+			},
+		},
+		"kelvin only": {
+			values: map[string]string{"kelvin": "6500"},
+			want: packets.LightSetWaveformOptional{
+				Transient: true,
+				Color:     packets.LightHsbk{Kelvin: 6500},
+				Period:    1000,
+				Cycles:    3,
+				Waveform:  enums.LightWaveformLIGHTWAVEFORMSINE,
+				SetKelvin: true,
+			},
+		},
+		"no color": {
+			values:  map[string]string{"period": "500"},
+			wantErr: true,
+		},
+		"period too long": {
+			values:       map[string]string{"hue": "120", "period": "4294967296"},
+			wantParseErr: true,
+		},
+	}
+
+	cmd, ok := Find("waveform")
+	if !ok {
+		t.Fatal("Command waveform not found")
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			params, err := cmd.ParseParams(tc.values)
+			if (err != nil) != tc.wantParseErr {
+				t.Fatalf("Parse error does not match: got %v, want error %t", err, tc.wantParseErr)
+			}
+			if tc.wantParseErr {
+				return
+			}
+			msg, err := cmd.Handler(params...)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error does not match: got %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := *msg.Payload.(*packets.LightSetWaveformOptional); got != tc.want {
+				t.Errorf("Payload does not match:\n got %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
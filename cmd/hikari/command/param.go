@@ -3,16 +3,24 @@ package command
 import (
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/firmware"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/input"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
 	hlist "github.com/alessio-palumbo/hikari/cmd/hikari/list"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/routine"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/scene"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
 	"github.com/alessio-palumbo/lifxlan-go/pkg/device"
 	"github.com/alessio-palumbo/lifxlan-go/pkg/matrix"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -21,8 +29,23 @@ import (
 const (
 	defaultPadding = 5
 
-	paramInputWidth = 20
-	paramCharLimit  = 5
+	paramCharLimit = 5
+
+	sceneNameCharLimit  = 20
+	sceneCaptureTimeout = 2 * time.Second
+	zoneQueryTimeout    = 2 * time.Second
+
+	rampLengthCharLimit = 8
+	maxRampLength       = 24 * time.Hour
+
+	atEndStayOn   = "stay_on"
+	atEndPowerOff = "power_off"
+
+	waveformSaw      = "saw"
+	waveformSine     = "sine"
+	waveformHalfSine = "half_sine"
+	waveformTriangle = "triangle"
+	waveformPulse    = "pulse"
 
 	chainModeSingle     = "single_device"
 	chainModeSequential = "chain_sequential"
@@ -34,10 +57,18 @@ const (
 	directionOutIn    = "out-in"
 )
 
+// paramInputWidth is the width of param inputs, see ApplyConfig.
+var paramInputWidth = config.Default().ParamInputWidth
+
 var (
 	optionModes     = []string{chainModeSingle, chainModeSequential, chainModeSynced}
 	optionColors    = []string{"red", "orange", "green", "yellow", "cyan", "blue", "magenta", "purple"}
 	optionDirection = []string{directionInwards, directionOutwards, directionInOut, directionOutIn}
+	optionAtEnd     = []string{atEndStayOn, atEndPowerOff}
+	optionWaveforms = []string{waveformSine, waveformHalfSine, waveformTriangle, waveformSaw, waveformPulse}
+	optionBool      = []string{"true", "false"}
+
+	optionFirmwareEffects = []string{string(firmware.Move), string(firmware.Morph), string(firmware.Flame), string(firmware.Sky)}
 )
 
 var colorNamesToHue = map[string]uint16{
@@ -52,14 +83,18 @@ var colorNamesToHue = map[string]uint16{
 }
 
 // paramType defines a parameter for a command.
+// InputOptionsFunc takes precedence over InputOptions for options only known at runtime.
+// CharLimit overrides the default text input limit.
 type paramType struct {
-	Name         string
-	InputType    input.InputType
-	InputOptions []string
-	Required     bool
-	Description  string
-	Default      any
-	Validator    func(value string) (any, error)
+	Name             string
+	InputType        input.InputType
+	InputOptions     []string
+	InputOptionsFunc func() []string
+	CharLimit        int
+	Required         bool
+	Description      string
+	Default          any
+	Validator        func(value string) (any, error)
 }
 
 type ParamItem struct {
@@ -114,15 +149,30 @@ func (p *ParamItem) UpdateValue(msg tea.KeyMsg) tea.Cmd {
 func (p *ParamItem) SetEdit(v bool, mProps ...device.MatrixProperties) {
 	if v {
 		p.Editing = true
-		switch p.InputType {
+		options := p.InputOptions
+		if p.InputOptionsFunc != nil {
+			options = p.InputOptionsFunc()
+		}
+		charLimit := paramCharLimit
+		if p.CharLimit > 0 {
+			charLimit = p.CharLimit
+		}
+
+		inputType := p.InputType
+		// Fall back to free text when there are no options to pick from.
+		if p.InputOptionsFunc != nil && len(options) == 0 {
+			inputType = input.InputText
+		}
+
+		switch inputType {
 		case input.InputText:
-			p.Input = input.NewInputText(paramInputWidth, paramCharLimit, p.Description)
+			p.Input = input.NewInputText(paramInputWidth, charLimit, p.Description)
 		case input.InputSingleSelect:
-			p.Input = input.NewInputSingleSelect(p.InputOptions, paramInputWidth)
+			p.Input = input.NewInputSingleSelect(options, paramInputWidth)
 		case input.InputSingleSelectInline:
-			p.Input = input.NewInputSingleSelectInline(p.InputOptions, paramInputWidth)
+			p.Input = input.NewInputSingleSelectInline(options, paramInputWidth)
 		case input.InputMultiSelect:
-			p.Input = input.NewMultiSelect(p.InputOptions, paramInputWidth)
+			p.Input = input.NewMultiSelect(options, paramInputWidth)
 		case input.InputMatrixSelect:
 			p.Input = input.NewMatrixSelect(mProps[0].Width, mProps[0].Height)
 		}
@@ -234,6 +284,32 @@ func newParamsList(params []paramType) list.Model {
 	return l
 }
 
+// ParseParams builds the params for a command from raw string values keyed by param name,
+// running them through the same validators used when editing params in the TUI.
+func (i Item) ParseParams(values map[string]string) ([]ParamItem, error) {
+	params := make([]ParamItem, len(i.ParamTypes))
+	for idx := range i.ParamTypes {
+		p := ParamItem{paramType: &i.ParamTypes[idx]}
+		if v, ok := values[p.Name]; ok && v != "" {
+			value, err := p.ValidateValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", p.Name, err)
+			}
+			p.value = value
+		}
+		params[idx] = p
+	}
+	for name := range values {
+		if !slices.ContainsFunc(i.ParamTypes, func(p paramType) bool { return p.Name == name }) {
+			return nil, fmt.Errorf("unknown param %s", name)
+		}
+	}
+	if err := ValidateRequired(params...); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
 func ValidateRequired(params ...ParamItem) error {
 	for _, p := range params {
 		if p.Required && p.value == nil {
@@ -320,6 +396,18 @@ func PositiveIntegerValidator(v string) (any, error) {
 	return m, nil
 }
 
+// PeriodValidator accepts a waveform period in ms, which the protocol carries in 32 bits.
+func PeriodValidator(v string) (any, error) {
+	m, err := parseInt64Input(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value, must be a number")
+	}
+	if *m < 1 || *m > math.MaxUint32 {
+		return nil, fmt.Errorf("value out of range (1-%d)", uint32(math.MaxUint32))
+	}
+	return m, nil
+}
+
 func ColorListValidator(v string) (any, error) {
 	for s := range strings.SplitSeq(v, ",") {
 		if _, ok := colorNamesToHue[s]; !ok {
@@ -356,6 +444,230 @@ func DirectionValidator(v string) (any, error) {
 	}
 }
 
+func SceneNameValidator(v string) (any, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == 0 {
+		return nil, fmt.Errorf("value must not be empty")
+	}
+	return v, nil
+}
+
+func SceneValidator(v string) (any, error) {
+	if _, ok := scene.Get(v); !ok {
+		return nil, fmt.Errorf("scene %s not found", v)
+	}
+	return v, nil
+}
+
+func PresetValidator(v string) (any, error) {
+	if _, ok := scene.GetPreset(v); !ok {
+		return nil, fmt.Errorf("preset %s not found", v)
+	}
+	return v, nil
+}
+
+func ZoneValidator(v string) (any, error) {
+	z, err := parseInt64Input(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value, must be a number")
+	}
+	if *z < 0 || *z > math.MaxUint16 {
+		return nil, fmt.Errorf("value out of range (0-%d)", math.MaxUint16)
+	}
+	return z, nil
+}
+
+func PositiveNumberValidator(v string) (any, error) {
+	n, err := parseFloat64Input(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value, must be a number")
+	}
+	if *n <= 0 {
+		return nil, fmt.Errorf("value must be greater than 0")
+	}
+	return n, nil
+}
+
+func BoolValidator(v string) (any, error) {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value, must be true or false")
+	}
+	return b, nil
+}
+
+func WaveformValidator(v string) (any, error) {
+	switch v {
+	case waveformSaw:
+		return enums.LightWaveformLIGHTWAVEFORMSAW, nil
+	case waveformSine:
+		return enums.LightWaveformLIGHTWAVEFORMSINE, nil
+	case waveformHalfSine:
+		return enums.LightWaveformLIGHTWAVEFORMHALFSINE, nil
+	case waveformTriangle:
+		return enums.LightWaveformLIGHTWAVEFORMTRIANGLE, nil
+	case waveformPulse:
+		return enums.LightWaveformLIGHTWAVEFORMPULSE, nil
+	}
+	return nil, fmt.Errorf("invalid waveform: %s", v)
+}
+
+func FirmwareEffectValidator(v string) (any, error) {
+	if !slices.Contains(firmware.Effects, firmware.Effect(v)) {
+		return nil, fmt.Errorf("invalid effect: %s", v)
+	}
+	return firmware.Effect(v), nil
+}
+
+func MoveDirectionValidator(v string) (any, error) {
+	if !slices.Contains(firmware.Directions, v) {
+		return nil, fmt.Errorf("invalid direction: %s", v)
+	}
+	return v, nil
+}
+
+func SkyTypeValidator(v string) (any, error) {
+	if !slices.Contains(firmware.SkyTypes, v) {
+		return nil, fmt.Errorf("invalid sky: %s", v)
+	}
+	return v, nil
+}
+
+// RampLengthValidator parses a length such as 30m or 1h30m, unlike DurationValidator which takes seconds.
+func RampLengthValidator(v string) (any, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value, must be a duration such as 30m")
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+	if d > maxRampLength {
+		return nil, fmt.Errorf("duration too long")
+	}
+	return d, nil
+}
+
+func CurveValidator(v string) (any, error) {
+	if !slices.Contains(routine.Curves, v) {
+		return nil, fmt.Errorf("invalid curve: %s", v)
+	}
+	return v, nil
+}
+
+func AtEndValidator(v string) (any, error) {
+	if !slices.Contains(optionAtEnd, v) {
+		return nil, fmt.Errorf("invalid value: %s", v)
+	}
+	return v, nil
+}
+
+// ApplyConfig sets the param input width and the param defaults of all commands from the configuration.
+func ApplyConfig(c config.Config) error {
+	paramInputWidth = c.ParamInputWidth
+
+	for i := range commands {
+		for j := range commands[i].ParamTypes {
+			p := &commands[i].ParamTypes[j]
+			switch {
+			case p.Name == "duration" && c.DefaultTransition > 0:
+				// The validator only takes whole seconds, check the range on them and keep the exact duration.
+				d := c.DefaultTransition.Std()
+				if _, err := p.Validator(strconv.FormatInt(int64(d/time.Second), 10)); err != nil {
+					return fmt.Errorf("default_transition: %w", err)
+				}
+				p.Default = d
+			case p.Name == "send_interval" && c.DefaultSendInterval > 0:
+				ms := c.DefaultSendInterval.Std().Milliseconds()
+				if _, err := p.Validator(strconv.FormatInt(ms, 10)); err != nil {
+					return fmt.Errorf("default_send_interval: %w", err)
+				}
+				p.Default = ms
+			}
+		}
+	}
+
+	for id, values := range c.CommandDefaults {
+		i := slices.IndexFunc(commands, func(c Command) bool { return c.ID == id })
+		if i < 0 {
+			return fmt.Errorf("command_defaults: unknown command %s", id)
+		}
+		for name, v := range values {
+			j := slices.IndexFunc(commands[i].ParamTypes, func(p paramType) bool { return p.Name == name })
+			if j < 0 {
+				return fmt.Errorf("command_defaults: unknown param %s for %s", name, id)
+			}
+			p := &commands[i].ParamTypes[j]
+			value, err := ParamItem{paramType: p}.ValidateValue(v)
+			if err != nil {
+				return fmt.Errorf("command_defaults: %s %s: %w", id, name, err)
+			}
+			p.Default = value
+		}
+	}
+	return nil
+}
+
+// OpenSceneLibrary loads the scene library from its default path,
+// validating scenes and presets against the same ranges accepted when setting colors.
+func OpenSceneLibrary() error {
+	path, err := scene.DefaultPath()
+	if err != nil {
+		return err
+	}
+	return scene.Open(path, ValidateScene, ValidatePreset)
+}
+
+// ValidateScene checks a scene against the same ranges accepted when setting colors.
+func ValidateScene(s scene.Scene) error {
+	if _, err := SceneNameValidator(s.Name); err != nil {
+		return fmt.Errorf("name: %w", err)
+	}
+	for serial, d := range s.Devices {
+		if err := validateHSBK(d.Color); err != nil {
+			return fmt.Errorf("device %s: %w", serial, err)
+		}
+		if d.Matrix == nil {
+			continue
+		}
+		for i, tile := range d.Matrix.Tiles {
+			for _, c := range tile {
+				if err := validateHSBK(c); err != nil {
+					return fmt.Errorf("device %s tile %d: %w", serial, i, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ValidatePreset checks a preset against the same ranges accepted when setting colors.
+func ValidatePreset(p scene.Preset) error {
+	if _, err := SceneNameValidator(p.Name); err != nil {
+		return fmt.Errorf("name: %w", err)
+	}
+	return validateHSBK(p.Color)
+}
+
+func validateHSBK(c scene.HSBK) error {
+	values := []struct {
+		name      string
+		value     string
+		validator func(string) (any, error)
+	}{
+		{"hue", strconv.FormatFloat(c.Hue, 'f', -1, 64), HueValidator},
+		{"saturation", strconv.FormatFloat(c.Saturation, 'f', -1, 64), PercentageValidator},
+		{"brightness", strconv.FormatFloat(c.Brightness, 'f', -1, 64), PercentageValidator},
+		{"kelvin", strconv.Itoa(int(c.Kelvin)), KelvinValidator},
+	}
+	for _, v := range values {
+		if _, err := v.validator(v.value); err != nil {
+			return fmt.Errorf("%s: %w", v.name, err)
+		}
+	}
+	return nil
+}
+
 func MatrixValidator(v string) (any, error) {
 	lines := strings.Split(strings.TrimSpace(v), "\n")
 	height := len(lines)
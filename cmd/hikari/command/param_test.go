@@ -0,0 +1,114 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+)
+
+func TestApplyConfig(t *testing.T) {
+	testCases := map[string]struct {
+		setup            func(c *config.Config)
+		wantErr          bool
+		wantTransition   time.Duration
+		wantSendInterval int64
+	}{
+		"defaults": {
+			wantSendInterval: 100,
+		},
+		"transition and send interval": {
+			setup: func(c *config.Config) {
+				c.DefaultTransition = config.Duration(1500 * time.Millisecond)
+				c.DefaultSendInterval = config.Duration(50 * time.Millisecond)
+			},
+			wantTransition:   1500 * time.Millisecond,
+			wantSendInterval: 50,
+		},
+		"sub-millisecond send interval": {
+			setup: func(c *config.Config) {
+				c.DefaultSendInterval = config.Duration(500 * time.Microsecond)
+			},
+			wantErr: true,
+		},
+		"transition too long": {
+			setup: func(c *config.Config) {
+				c.DefaultTransition = config.Duration(25 * time.Hour)
+			},
+			wantErr: true,
+		},
+		"command default": {
+			setup: func(c *config.Config) {
+				c.CommandDefaults = map[string]map[string]string{"set_color": {"duration": "3"}}
+			},
+			wantTransition:   3 * time.Second,
+			wantSendInterval: 100,
+		},
+		"invalid command default": {
+			setup: func(c *config.Config) {
+				c.CommandDefaults = map[string]map[string]string{"set_color": {"kelvin": "100"}}
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			restoreDefaults(t)
+			c := config.Default()
+			if tc.setup != nil {
+				tc.setup(&c)
+			}
+
+			err := ApplyConfig(c)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error does not match: got %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := SetParamValue[time.Duration](defaultParam(t, "set_color", "duration")); got != tc.wantTransition {
+				t.Errorf("Transition does not match: got %s, want %s", got, tc.wantTransition)
+			}
+			if got := SetParamValue[int64](defaultParam(t, "waterfall_effect", "send_interval")); got != tc.wantSendInterval {
+				t.Errorf("Send interval does not match: got %d, want %d", got, tc.wantSendInterval)
+			}
+		})
+	}
+}
+
+// restoreDefaults restores the param defaults of all commands once the test is over.
+func restoreDefaults(t *testing.T) {
+	t.Helper()
+	width := paramInputWidth
+	defaults := make([][]any, len(commands))
+	for i, c := range commands {
+		for _, p := range c.ParamTypes {
+			defaults[i] = append(defaults[i], p.Default)
+		}
+	}
+	t.Cleanup(func() {
+		paramInputWidth = width
+		for i := range commands {
+			for j := range commands[i].ParamTypes {
+				commands[i].ParamTypes[j].Default = defaults[i][j]
+			}
+		}
+	})
+}
+
+// defaultParam returns an unset param of the command, which takes its default value.
+func defaultParam(t *testing.T, id, name string) ParamItem {
+	t.Helper()
+	c, ok := Find(id)
+	if !ok {
+		t.Fatalf("Command %s not found", id)
+	}
+	for i := range c.ParamTypes {
+		if c.ParamTypes[i].Name == name {
+			return ParamItem{paramType: &c.ParamTypes[i]}
+		}
+	}
+	t.Fatalf("Param %s of %s not found", name, id)
+	return ParamItem{}
+}
@@ -0,0 +1,349 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	appDir     = "hikari"
+	configFile = "config.json"
+	envPrefix  = "HIKARI_"
+	envConfig  = envPrefix + "CONFIG"
+)
+
+// Config holds the user configurable behaviour of hikari.
+type Config struct {
+	// DeviceRefreshPeriod is how often devices are refreshed while browsing the device list.
+	DeviceRefreshPeriod Duration `json:"device_refresh_period"`
+	// StaleThreshold is the age after which devices are refreshed outside of the device list.
+	StaleThreshold Duration `json:"stale_threshold"`
+	// PingInterval is how often devices are pinged to track whether they are online.
+	PingInterval Duration `json:"ping_interval"`
+	// OfflineAfter is the time after which a device which did not respond is considered offline.
+	OfflineAfter Duration `json:"offline_after"`
+	// SendMessageSpinner is the minimum time the spinner is shown for when starting or stopping effects,
+	// whose frames are not acknowledged.
+	SendMessageSpinner Duration `json:"send_message_spinner"`
+	// SendTimeout is the time to wait for a device to acknowledge a command before resending it.
+	SendTimeout Duration `json:"send_timeout"`
+	// SendRetries is the number of times an unacknowledged command is resent.
+	SendRetries int `json:"send_retries"`
+	// SendBackoff is the pause before the first resend, doubled on each following one.
+	SendBackoff Duration `json:"send_backoff"`
+	// Verify reads back the state of devices after power and color commands and reports mismatches.
+	Verify bool `json:"verify"`
+	// ListWidth is the width of the lists in the TUI.
+	ListWidth int `json:"list_width"`
+	// ParamInputWidth is the width of the param inputs in the TUI.
+	ParamInputWidth int `json:"param_input_width"`
+	// DefaultTransition is the default transition duration of commands with a duration param.
+	DefaultTransition Duration `json:"default_transition"`
+	// DefaultSendInterval is the default pause between frames of matrix effects.
+	DefaultSendInterval Duration `json:"default_send_interval"`
+	// CommandDefaults holds param defaults keyed by command ID and param name.
+	// Values use the same format accepted when editing params, e.g. {"set_color": {"kelvin": "2700"}}.
+	CommandDefaults map[string]map[string]string `json:"command_defaults"`
+	// Theme is the name of a built-in theme or of a theme file, see style.Load.
+	Theme string `json:"theme"`
+	// Keys remaps TUI key bindings keyed by action, e.g. {"device_list.quit": ["ctrl+q"]}.
+	Keys map[string][]string `json:"keys"`
+	// MQTTBroker is the address of the MQTT broker devices are bridged to, e.g. localhost:1883.
+	MQTTBroker string `json:"mqtt_broker"`
+	// MQTTUsername is the user name to connect to the MQTT broker with.
+	MQTTUsername string `json:"mqtt_username"`
+	// MQTTPassword is the password to connect to the MQTT broker with.
+	MQTTPassword string `json:"mqtt_password"`
+	// MQTTTopicPrefix prefixes the state and command topics of devices.
+	MQTTTopicPrefix string `json:"mqtt_topic_prefix"`
+	// MQTTDiscoveryPrefix is the topic prefix Home Assistant listens to for discovery.
+	MQTTDiscoveryPrefix string `json:"mqtt_discovery_prefix"`
+	// Latitude and Longitude locate the lights in degrees, positive north and east, to compute sunrise and sunset.
+	// They are unset when both are zero.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Schedules are the commands run by hikari schedule.
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Schedule runs a command with the given params on the target devices whenever At fires.
+// At is a cron expression, e.g. "30 7 * * mon-fri", or "sunrise" or "sunset" with an optional offset, e.g. "sunset-30m".
+type Schedule struct {
+	Name    string            `json:"name"`
+	At      string            `json:"at"`
+	Command string            `json:"command"`
+	Target  string            `json:"target"`
+	Params  map[string]string `json:"params,omitempty"`
+}
+
+// Default returns the built-in configuration.
+func Default() Config {
+	return Config{
+		DeviceRefreshPeriod: Duration(2 * time.Second),
+		StaleThreshold:      Duration(5 * time.Second),
+		PingInterval:        Duration(5 * time.Second),
+		OfflineAfter:        Duration(30 * time.Second),
+		SendMessageSpinner:  Duration(300 * time.Millisecond),
+		SendTimeout:         Duration(500 * time.Millisecond),
+		SendRetries:         2,
+		SendBackoff:         Duration(100 * time.Millisecond),
+		ListWidth:           40,
+		ParamInputWidth:     20,
+		MQTTTopicPrefix:     "hikari",
+		MQTTDiscoveryPrefix: "homeassistant",
+	}
+}
+
+// setting is a config value that can be overridden by an environment variable and a flag.
+type setting struct {
+	name  string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"device_refresh_period", "How often devices are refreshed", durationSetter(func(c *Config) *Duration { return &c.DeviceRefreshPeriod })},
+	{"stale_threshold", "Age after which devices are refreshed outside of the device list", durationSetter(func(c *Config) *Duration { return &c.StaleThreshold })},
+	{"ping_interval", "How often devices are pinged to track whether they are online", durationSetter(func(c *Config) *Duration { return &c.PingInterval })},
+	{"offline_after", "Time after which a device which did not respond is considered offline", durationSetter(func(c *Config) *Duration { return &c.OfflineAfter })},
+	{"send_message_spinner", "Minimum time the spinner is shown for when starting or stopping effects", durationSetter(func(c *Config) *Duration { return &c.SendMessageSpinner })},
+	{"send_timeout", "Time to wait for a command to be acknowledged before resending it", durationSetter(func(c *Config) *Duration { return &c.SendTimeout })},
+	{"send_retries", "Number of times an unacknowledged command is resent", intSetter(func(c *Config) *int { return &c.SendRetries })},
+	{"send_backoff", "Pause before the first resend, doubled on each following one", durationSetter(func(c *Config) *Duration { return &c.SendBackoff })},
+	{"verify", "Read back the state of devices after power and color commands", boolSetter(func(c *Config) *bool { return &c.Verify })},
+	{"list_width", "Width of the lists", intSetter(func(c *Config) *int { return &c.ListWidth })},
+	{"param_input_width", "Width of the param inputs", intSetter(func(c *Config) *int { return &c.ParamInputWidth })},
+	{"default_transition", "Default transition duration of commands", durationSetter(func(c *Config) *Duration { return &c.DefaultTransition })},
+	{"default_send_interval", "Default pause between frames of matrix effects", durationSetter(func(c *Config) *Duration { return &c.DefaultSendInterval })},
+	{"theme", "Theme name (dark, light, high-contrast, monochrome) or theme file", stringSetter(func(c *Config) *string { return &c.Theme })},
+	{"mqtt_broker", "Address of the MQTT broker", stringSetter(func(c *Config) *string { return &c.MQTTBroker })},
+	{"mqtt_username", "User name of the MQTT broker", stringSetter(func(c *Config) *string { return &c.MQTTUsername })},
+	{"mqtt_password", "Password of the MQTT broker", stringSetter(func(c *Config) *string { return &c.MQTTPassword })},
+	{"mqtt_topic_prefix", "Prefix of the MQTT device topics", stringSetter(func(c *Config) *string { return &c.MQTTTopicPrefix })},
+	{"mqtt_discovery_prefix", "Home Assistant MQTT discovery prefix", stringSetter(func(c *Config) *string { return &c.MQTTDiscoveryPrefix })},
+	{"latitude", "Latitude of the lights in degrees, to compute sunrise and sunset", floatSetter(func(c *Config) *float64 { return &c.Latitude })},
+	{"longitude", "Longitude of the lights in degrees, to compute sunrise and sunset", floatSetter(func(c *Config) *float64 { return &c.Longitude })},
+}
+
+// Load registers the config flags on fs, parses args and returns the configuration built from
+// the defaults, the config file, HIKARI_* environment variables and flags, in increasing order of precedence.
+// The config file is read from --config, HIKARI_CONFIG or the user config directory.
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	path := fs.String("config", "", "Path of the config file")
+	flagValues := make(map[string]string)
+	for _, s := range settings {
+		set := func(v string) error {
+			flagValues[s.name] = v
+			return nil
+		}
+		if isBool(s.name) {
+			fs.BoolFunc(flagName(s.name), s.usage, set)
+		} else {
+			fs.Func(flagName(s.name), s.usage, set)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *path == "" {
+		*path = os.Getenv(envConfig)
+	}
+	explicit := *path != ""
+	if !explicit {
+		var err error
+		if *path, err = DefaultPath(); err != nil {
+			return Config{}, err
+		}
+	}
+
+	c := Default()
+	if err := c.readFile(*path, explicit); err != nil {
+		return Config{}, err
+	}
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(envName(s.name)); ok {
+			if err := s.set(&c, v); err != nil {
+				return Config{}, fmt.Errorf("%s: %w", envName(s.name), err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flagValues[s.name]; ok {
+			if err := s.set(&c, v); err != nil {
+				return Config{}, fmt.Errorf("--%s: %w", flagName(s.name), err)
+			}
+		}
+	}
+	return c, c.validate()
+}
+
+// DefaultPath returns the path of the config file in the user config directory,
+// e.g. $XDG_CONFIG_HOME/hikari/config.json on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDir, configFile), nil
+}
+
+// readFile merges the config file at path into c. A missing file is only an error if it was explicitly requested.
+func (c *Config) readFile(path string, explicit bool) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (c Config) validate() error {
+	switch {
+	case c.DeviceRefreshPeriod <= 0:
+		return errors.New("device_refresh_period must be positive")
+	case c.StaleThreshold <= 0:
+		return errors.New("stale_threshold must be positive")
+	case c.PingInterval <= 0:
+		return errors.New("ping_interval must be positive")
+	case c.OfflineAfter <= 0:
+		return errors.New("offline_after must be positive")
+	case c.SendMessageSpinner < 0:
+		return errors.New("send_message_spinner must not be negative")
+	case c.SendTimeout <= 0:
+		return errors.New("send_timeout must be positive")
+	case c.SendRetries < 0:
+		return errors.New("send_retries must not be negative")
+	case c.SendBackoff < 0:
+		return errors.New("send_backoff must not be negative")
+	case c.ListWidth <= 0:
+		return errors.New("list_width must be positive")
+	case c.ParamInputWidth <= 0:
+		return errors.New("param_input_width must be positive")
+	case c.DefaultTransition < 0:
+		return errors.New("default_transition must not be negative")
+	case c.DefaultSendInterval < 0:
+		return errors.New("default_send_interval must not be negative")
+	case c.MQTTTopicPrefix == "":
+		return errors.New("mqtt_topic_prefix must be set")
+	case c.MQTTDiscoveryPrefix == "":
+		return errors.New("mqtt_discovery_prefix must be set")
+	case c.MQTTPassword != "" && c.MQTTUsername == "":
+		return errors.New("mqtt_password requires mqtt_username")
+	case c.Latitude < -90 || c.Latitude > 90:
+		return errors.New("latitude must be between -90 and 90")
+	case c.Longitude < -180 || c.Longitude > 180:
+		return errors.New("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+func flagName(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(name)
+}
+
+func durationSetter(field func(c *Config) *Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
+
+func stringSetter(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func boolSetter(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// isBool reports whether the setting holds a boolean, whose flag can be given without a value, e.g. --verify.
+func isBool(name string) bool {
+	t := reflect.TypeFor[Config]()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == name {
+			return f.Type.Kind() == reflect.Bool
+		}
+	}
+	return false
+}
+
+func intSetter(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func floatSetter(field func(c *Config) *float64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+// Duration is a time.Duration encoded in JSON as a string such as "1.5s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Std returns the value as a time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
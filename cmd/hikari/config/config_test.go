@@ -0,0 +1,128 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := map[string]struct {
+		file    string
+		env     map[string]string
+		args    []string
+		want    Config
+		wantErr bool
+	}{
+		"defaults without file": {
+			want: Default(),
+		},
+		"file overrides defaults": {
+			file: `{"list_width": 60, "default_transition": "2s", "command_defaults": {"set_color": {"kelvin": "2700"}}}`,
+			want: func() Config {
+				c := Default()
+				c.ListWidth = 60
+				c.DefaultTransition = Duration(2 * time.Second)
+				c.CommandDefaults = map[string]map[string]string{"set_color": {"kelvin": "2700"}}
+				return c
+			}(),
+		},
+		"env overrides file": {
+			file: `{"list_width": 60}`,
+			env:  map[string]string{"HIKARI_LIST_WIDTH": "80"},
+			want: func() Config {
+				c := Default()
+				c.ListWidth = 80
+				return c
+			}(),
+		},
+		"flags override env": {
+			file: `{"list_width": 60}`,
+			env:  map[string]string{"HIKARI_LIST_WIDTH": "80", "HIKARI_STALE_THRESHOLD": "10s"},
+			args: []string{"--list-width", "100"},
+			want: func() Config {
+				c := Default()
+				c.ListWidth = 100
+				c.StaleThreshold = Duration(10 * time.Second)
+				return c
+			}(),
+		},
+		"bool flag without value": {
+			env:  map[string]string{"HIKARI_VERIFY": "false"},
+			args: []string{"--verify"},
+			want: func() Config {
+				c := Default()
+				c.Verify = true
+				return c
+			}(),
+		},
+		"coordinates and schedules": {
+			file: `{"schedules": [{"name": "evening", "at": "sunset-30m", "command": "recall_scene", "target": "all", "params": {"name": "evening"}}]}`,
+			args: []string{"--latitude", "-33.87", "--longitude", "151.21"},
+			want: func() Config {
+				c := Default()
+				c.Latitude = -33.87
+				c.Longitude = 151.21
+				c.Schedules = []Schedule{{Name: "evening", At: "sunset-30m", Command: "recall_scene", Target: "all", Params: map[string]string{"name": "evening"}}}
+				return c
+			}(),
+		},
+		"mqtt password without username": {
+			env:     map[string]string{"HIKARI_MQTT_PASSWORD": "secret"},
+			wantErr: true,
+		},
+		"latitude out of range": {
+			env:     map[string]string{"HIKARI_LATITUDE": "91"},
+			wantErr: true,
+		},
+		"invalid env value": {
+			env:     map[string]string{"HIKARI_DEVICE_REFRESH_PERIOD": "soon"},
+			wantErr: true,
+		},
+		"invalid file value": {
+			file:    `{"list_width": 0}`,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			t.Setenv("HIKARI_CONFIG", "")
+			for _, s := range settings {
+				t.Setenv(envName(s.name), "")
+				os.Unsetenv(envName(s.name))
+			}
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			args := tc.args
+			if tc.file != "" {
+				path := filepath.Join(dir, "config.json")
+				if err := os.WriteFile(path, []byte(tc.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"--config", path}, args...)
+			}
+
+			got, err := Load(flag.NewFlagSet("test", flag.ContinueOnError), args)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got config %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Config does not match: got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
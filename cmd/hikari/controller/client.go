@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/lan"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+const maxMessageSize = 2048
+
+type response struct {
+	header  lan.Header
+	payload packets.Payload
+}
+
+// client sends messages to LIFX devices over UDP and matches their responses.
+// The lifxlan-go controller only sends messages without waiting for replies and keeps the state it discovers,
+// so acknowledged sends and queries of state it does not track, e.g. zones and tile colors, go through a client
+// of their own. Responses are routed back to the caller by sequence number, the source telling them apart from
+// the replies to the lifxlan-go controller.
+type client struct {
+	conn   *net.UDPConn
+	source uint32
+
+	mu       sync.Mutex
+	sequence uint8
+	pending  map[uint8]chan response
+}
+
+// newClient returns a client listening on an ephemeral UDP port.
+func newClient() (*client, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{
+		conn: conn,
+		// Source 0 and 1 are reserved and cause devices to broadcast responses.
+		source:  rand.Uint32N(1<<31) + 2,
+		pending: make(map[uint8]chan response),
+	}
+	go c.read()
+	return c, nil
+}
+
+// Close closes the underlying connection.
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// request sends payload to the device at addr and waits for count responses of type respType.
+func (c *client) request(ctx context.Context, addr *net.UDPAddr, target [8]byte, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	responses, seq, err := c.send(addr, lan.Header{Target: target, ResRequired: true}, payload, count)
+	if err != nil {
+		return nil, err
+	}
+	defer c.release(seq)
+
+	var payloads []packets.Payload
+	for len(payloads) < count {
+		select {
+		case r := <-responses:
+			switch r.header.Type {
+			case respType:
+				payloads = append(payloads, r.payload)
+			case uint16(packets.PayloadTypeDeviceStateUnhandled):
+				return nil, ErrUnhandled
+			}
+		case <-ctx.Done():
+			return payloads, ctx.Err()
+		}
+	}
+	return payloads, nil
+}
+
+// sendAck sends payload to the device at addr and waits for its acknowledgement.
+func (c *client) sendAck(ctx context.Context, addr *net.UDPAddr, target [8]byte, payload packets.Payload) error {
+	responses, seq, err := c.send(addr, lan.Header{Target: target, AckRequired: true}, payload, 1)
+	if err != nil {
+		return err
+	}
+	defer c.release(seq)
+
+	for {
+		select {
+		case r := <-responses:
+			if r.header.Type == uint16(packets.PayloadTypeDeviceAcknowledgement) {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *client) send(addr *net.UDPAddr, h lan.Header, payload packets.Payload, count int) (chan response, uint8, error) {
+	responses := make(chan response, count+1)
+
+	c.mu.Lock()
+	seq, err := c.nextSequence()
+	if err != nil {
+		c.mu.Unlock()
+		return nil, 0, err
+	}
+	c.pending[seq] = responses
+	c.mu.Unlock()
+
+	h.Source = c.source
+	h.Sequence = seq
+	b, err := lan.Encode(h, payload)
+	if err == nil {
+		_, err = c.conn.WriteToUDP(b, addr)
+	}
+	if err != nil {
+		c.release(seq)
+		return nil, 0, err
+	}
+	return responses, seq, nil
+}
+
+// nextSequence returns the next free sequence number. It must be called with mu held.
+// The protocol sequence is a single byte, which caps the requests in flight at 256.
+func (c *client) nextSequence() (uint8, error) {
+	for range 256 {
+		c.sequence++
+		if _, ok := c.pending[c.sequence]; !ok {
+			return c.sequence, nil
+		}
+	}
+	return 0, fmt.Errorf("too many requests in flight")
+}
+
+func (c *client) release(seq uint8) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+func (c *client) read() {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		h, payload, err := lan.Decode(buf[:n])
+		if err != nil || h.Source != c.source {
+			continue
+		}
+
+		c.mu.Lock()
+		responses, ok := c.pending[h.Sequence]
+		c.mu.Unlock()
+		if !ok {
+			continue
+		}
+		select {
+		case responses <- response{header: h, payload: payload}:
+		default:
+		}
+	}
+}
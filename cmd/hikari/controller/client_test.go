@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/lan"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/sim"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestClient(t *testing.T) {
+	s, err := sim.NewServer("127.0.0.1:0", sim.DefaultConfig().Devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+
+	c, err := newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	red := packets.LightHsbk{Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	testCases := map[string]struct {
+		serial   string
+		payload  packets.Payload
+		respType packets.Payload
+		count    int
+		ack      bool
+		wantErr  error
+	}{
+		"single response": {
+			serial:   "d073d5000001",
+			payload:  &packets.LightGet{},
+			respType: &packets.LightState{},
+			count:    1,
+		},
+		"several responses": {
+			serial:   "d073d5000003",
+			payload:  &packets.TileGet64{Length: 5, Rect: packets.TileBufferRect{Width: 8}},
+			respType: &packets.TileState64{},
+			count:    5,
+		},
+		"acknowledged": {
+			serial:  "d073d5000001",
+			payload: &packets.LightSetColor{Color: red},
+			ack:     true,
+		},
+		"unhandled": {
+			serial:   "d073d5000001",
+			payload:  &packets.MultiZoneExtendedGetColorZones{},
+			respType: &packets.MultiZoneExtendedStateMultiZone{},
+			count:    1,
+			wantErr:  ErrUnhandled,
+		},
+		"more responses than the device sends": {
+			serial:   "d073d5000001",
+			payload:  &packets.LightGet{},
+			respType: &packets.LightState{},
+			count:    2,
+			wantErr:  context.DeadlineExceeded,
+		},
+		"unknown device": {
+			serial:   "d073d50000ff",
+			payload:  &packets.LightGet{},
+			respType: &packets.LightState{},
+			count:    1,
+			wantErr:  context.DeadlineExceeded,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			target, err := lan.ParseSerial(tc.serial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			if tc.ack {
+				if err := c.sendAck(ctx, s.Addr(), target, tc.payload); !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			responses, err := c.request(ctx, s.Addr(), target, tc.payload, tc.respType.PayloadType(), tc.count)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if len(responses) != tc.count {
+				t.Fatalf("Responses do not match: got %d, want %d", len(responses), tc.count)
+			}
+			for _, r := range responses {
+				if r.PayloadType() != tc.respType.PayloadType() {
+					t.Errorf("Response type does not match: got %d, want %d", r.PayloadType(), tc.respType.PayloadType())
+				}
+			}
+		})
+	}
+}
+
+func TestClientConcurrentRequests(t *testing.T) {
+	s, err := sim.NewServer("127.0.0.1:0", sim.DefaultConfig().Devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+
+	c, err := newClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	// Each request must get the label of the device it targets, however the responses interleave.
+	serials := map[string]string{"d073d5000001": "Sim Bulb", "d073d5000002": "Sim Strip", "d073d5000003": "Sim Tiles"}
+	var wg sync.WaitGroup
+	for range 20 {
+		for serial, label := range serials {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				target, err := lan.ParseSerial(serial)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+				responses, err := c.request(ctx, s.Addr(), target, &packets.DeviceGetLabel{}, uint16(packets.PayloadTypeDeviceStateLabel), 1)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got := cString(responses[0].(*packets.DeviceStateLabel).Label[:]); got != label {
+					t.Errorf("Label of %s does not match: got %s, want %s", serial, got, label)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
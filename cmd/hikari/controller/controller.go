@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/lan"
+	ctrl "github.com/alessio-palumbo/lifxlan-go/pkg/controller"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	// ErrDeviceNotFound is returned when a message targets a device that was not discovered.
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrUnhandled is returned when a device does not support the requested message.
+	ErrUnhandled = errors.New("message not supported by device")
+)
+
+// Controller discovers LIFX devices and sends messages to them.
+// The TUI, the CLI and the servers only talk to devices through it, so that devices can be faked or recorded.
+type Controller interface {
+	// GetDevices returns the devices discovered so far.
+	GetDevices() []ldevice.Device
+	// Send sends msg to the device without waiting for a response.
+	Send(serial ldevice.Serial, msg *protocol.Message) error
+	// SendAck sends msg to the device and waits for its acknowledgement.
+	SendAck(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error
+	// Query sends payload to the device and waits for count responses of type respType.
+	Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error)
+	// Close releases the resources of the controller.
+	Close() error
+}
+
+// LAN is the default Controller. Devices are discovered and sent messages by the lifxlan-go controller,
+// while acknowledged sends and queries go through a client matching responses to requests.
+type LAN struct {
+	c  *ctrl.Controller
+	lc *client
+}
+
+// New returns a LAN controller discovering devices on the local network.
+func New() (*LAN, error) {
+	c, err := ctrl.New()
+	if err != nil {
+		return nil, err
+	}
+	lc, err := newClient()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &LAN{c: c, lc: lc}, nil
+}
+
+// GetDevices returns the devices discovered so far.
+func (l *LAN) GetDevices() []ldevice.Device {
+	return l.c.GetDevices()
+}
+
+// Send sends msg to the device without waiting for a response.
+func (l *LAN) Send(serial ldevice.Serial, msg *protocol.Message) error {
+	return l.c.Send(serial, msg)
+}
+
+// SendAck sends msg to the device and waits for its acknowledgement.
+func (l *LAN) SendAck(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error {
+	addr, target, err := l.lookup(serial)
+	if err != nil {
+		return err
+	}
+	return l.lc.sendAck(ctx, addr, target, msg.Payload)
+}
+
+// Query sends payload to the device and waits for count responses of type respType.
+func (l *LAN) Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	addr, target, err := l.lookup(serial)
+	if err != nil {
+		return nil, err
+	}
+	return l.lc.request(ctx, addr, target, payload, respType, count)
+}
+
+// Close stops discovery and closes the connections of the controller.
+func (l *LAN) Close() error {
+	return errors.Join(l.lc.Close(), l.c.Close())
+}
+
+// lookup returns the UDP address and the protocol target of a discovered device.
+func (l *LAN) lookup(serial ldevice.Serial) (*net.UDPAddr, [8]byte, error) {
+	for _, d := range l.c.GetDevices() {
+		if d.Serial != serial || d.Address == nil {
+			continue
+		}
+		target, err := lan.ParseSerial(serial.String())
+		if err != nil {
+			return nil, target, err
+		}
+		port := d.Address.Port
+		if port == 0 {
+			port = lan.DefaultPort
+		}
+		return &net.UDPAddr{IP: d.Address.IP, Port: port}, target, nil
+	}
+	return nil, [8]byte{}, ErrDeviceNotFound
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+)
+
+// Counts are the numbers of messages sent through a Counter by outcome.
+type Counts struct {
+	// Sent is the number of messages sent, including resends.
+	Sent uint64
+	// Acked is the number of messages acknowledged.
+	Acked uint64
+	// Retries is the number of messages resent by Deliver after their acknowledgement was lost.
+	Retries uint64
+	// Timeouts is the number of messages whose acknowledgement was not received in time.
+	Timeouts uint64
+	// Errors is the number of messages which failed to be sent for any other reason.
+	Errors uint64
+}
+
+// Counter is a Controller counting the messages sent through the Controller it wraps.
+type Counter struct {
+	Controller
+	sent     atomic.Uint64
+	acked    atomic.Uint64
+	retries  atomic.Uint64
+	timeouts atomic.Uint64
+	errors   atomic.Uint64
+}
+
+// NewCounter returns a Counter wrapping c.
+func NewCounter(c Controller) *Counter {
+	return &Counter{Controller: c}
+}
+
+// Send sends msg through the wrapped controller and counts it.
+func (c *Counter) Send(serial ldevice.Serial, msg *protocol.Message) error {
+	c.sent.Add(1)
+	err := c.Controller.Send(serial, msg)
+	if err != nil {
+		c.errors.Add(1)
+	}
+	return err
+}
+
+// SendAck sends msg through the wrapped controller and counts it along with its acknowledgement.
+func (c *Counter) SendAck(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error {
+	c.sent.Add(1)
+	err := c.Controller.SendAck(ctx, serial, msg)
+	switch {
+	case err == nil:
+		c.acked.Add(1)
+	case errors.Is(err, context.DeadlineExceeded):
+		c.timeouts.Add(1)
+	case !errors.Is(err, context.Canceled):
+		c.errors.Add(1)
+	}
+	return err
+}
+
+// Counts returns the numbers of messages sent so far.
+func (c *Counter) Counts() Counts {
+	return Counts{
+		Sent:     c.sent.Load(),
+		Acked:    c.acked.Load(),
+		Retries:  c.retries.Load(),
+		Timeouts: c.timeouts.Load(),
+		Errors:   c.errors.Load(),
+	}
+}
+
+func (c *Counter) retried() {
+	c.retries.Add(1)
+}
+
+// retryCounter is implemented by controllers counting the messages resent by Deliver.
+type retryCounter interface {
+	retried()
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestCounter(t *testing.T) {
+	policy := RetryPolicy{Retries: 2, Timeout: 10 * time.Millisecond, Backoff: time.Millisecond}
+
+	testCases := map[string]struct {
+		serial ldevice.Serial
+		drops  int
+		want   Counts
+	}{
+		"delivered": {
+			serial: bulb.Serial,
+			want:   Counts{Sent: 1, Acked: 1},
+		},
+		"delivered after retries": {
+			serial: bulb.Serial,
+			drops:  2,
+			want:   Counts{Sent: 3, Acked: 1, Retries: 2, Timeouts: 2},
+		},
+		"timed out": {
+			serial: bulb.Serial,
+			drops:  -1,
+			want:   Counts{Sent: 3, Retries: 2, Timeouts: 3},
+		},
+		"offline": {
+			serial: unknown,
+			want:   Counts{Sent: 1, Errors: 1},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := NewFake(bulb)
+			f.Drop(tc.serial, tc.drops)
+			c := NewCounter(f)
+
+			Deliver(context.Background(), c, tc.serial, policy, protocol.NewMessage(&packets.DeviceSetPower{Level: 65535}))
+			if got := c.Counts(); got != tc.want {
+				t.Errorf("Counts do not match: got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+)
+
+// ErrTimeout is returned when a message is not acknowledged after all retries.
+var ErrTimeout = errors.New("timed out")
+
+// RetryPolicy controls how acknowledged messages are retried when their acknowledgement is lost.
+type RetryPolicy struct {
+	// Retries is the number of times a message is resent after the first attempt.
+	Retries int
+	// Timeout is the time to wait for the acknowledgement of each attempt.
+	Timeout time.Duration
+	// Backoff is the pause before the first retry, doubled on each following retry.
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy resends a message twice, waiting 500ms for each acknowledgement.
+var DefaultRetryPolicy = RetryPolicy{Retries: 2, Timeout: 500 * time.Millisecond, Backoff: 100 * time.Millisecond}
+
+// PolicyFrom returns the retry policy set by the send settings of the config.
+func PolicyFrom(cfg config.Config) RetryPolicy {
+	return RetryPolicy{
+		Retries: cfg.SendRetries,
+		Timeout: cfg.SendTimeout.Std(),
+		Backoff: cfg.SendBackoff.Std(),
+	}
+}
+
+// Status is the delivery status of a message.
+type Status int
+
+const (
+	StatusDelivered Status = iota
+	StatusTimedOut
+	StatusOffline
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusDelivered:
+		return "delivered"
+	case StatusTimedOut:
+		return "timed out"
+	case StatusOffline:
+		return "offline"
+	}
+	return "failed"
+}
+
+// StatusOf returns the delivery status of a message from the error returned by Deliver.
+func StatusOf(err error) Status {
+	switch {
+	case err == nil:
+		return StatusDelivered
+	case errors.Is(err, ErrTimeout):
+		return StatusTimedOut
+	case errors.Is(err, ErrDeviceNotFound), errors.Is(err, ErrOffline):
+		return StatusOffline
+	}
+	return StatusFailed
+}
+
+// Deliver sends the messages to the device in order, waiting for the acknowledgement of each.
+// A message which is not acknowledged in time is resent according to the policy, backing off between attempts.
+func Deliver(ctx context.Context, c Controller, serial ldevice.Serial, p RetryPolicy, msgs ...*protocol.Message) error {
+	for _, msg := range msgs {
+		if err := deliver(ctx, c, serial, p, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deliver(ctx context.Context, c Controller, serial ldevice.Serial, p RetryPolicy, msg *protocol.Message) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+		err := c.SendAck(attemptCtx, serial, msg)
+		cancel()
+
+		switch {
+		case err == nil:
+			return nil
+		case !errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil:
+			return err
+		case attempt > p.Retries:
+			return fmt.Errorf("%w after %d attempts", ErrTimeout, attempt)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if rc, ok := c.(retryCounter); ok {
+			rc.retried()
+		}
+	}
+}
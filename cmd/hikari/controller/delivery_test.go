@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestDeliver(t *testing.T) {
+	policy := RetryPolicy{Retries: 2, Timeout: 10 * time.Millisecond, Backoff: time.Millisecond}
+
+	testCases := map[string]struct {
+		serial       ldevice.Serial
+		drops        int
+		wantStatus   Status
+		wantAttempts int
+		wantPowered  bool
+	}{
+		"delivered": {
+			serial:       bulb.Serial,
+			wantStatus:   StatusDelivered,
+			wantAttempts: 1,
+			wantPowered:  true,
+		},
+		"delivered after retries": {
+			serial:       bulb.Serial,
+			drops:        2,
+			wantStatus:   StatusDelivered,
+			wantAttempts: 3,
+			wantPowered:  true,
+		},
+		"timed out": {
+			serial:       bulb.Serial,
+			drops:        -1,
+			wantStatus:   StatusTimedOut,
+			wantAttempts: 3,
+		},
+		"offline": {
+			serial:       unknown,
+			wantStatus:   StatusOffline,
+			wantAttempts: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := NewFake(withPower(bulb, false))
+			f.Drop(tc.serial, tc.drops)
+			r := NewRecorder(f)
+
+			err := Deliver(context.Background(), r, tc.serial, policy, protocol.NewMessage(&packets.DeviceSetPower{Level: 65535}))
+			if got := StatusOf(err); got != tc.wantStatus {
+				t.Errorf("Status does not match: got %s (%v), want %s", got, err, tc.wantStatus)
+			}
+			if got := len(r.Calls()); got != tc.wantAttempts {
+				t.Errorf("Attempts do not match: got %d, want %d", got, tc.wantAttempts)
+			}
+			if got := f.GetDevices()[0].PoweredOn; got != tc.wantPowered {
+				t.Errorf("Power does not match: got %t, want %t", got, tc.wantPowered)
+			}
+		})
+	}
+}
+
+func TestDeliverCancelled(t *testing.T) {
+	f := NewFake(bulb)
+	f.Drop(bulb.Serial, -1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Deliver(ctx, f, bulb.Serial, DefaultRetryPolicy, protocol.NewMessage(&packets.DeviceSetPower{}))
+	if got := StatusOf(err); got != StatusFailed {
+		t.Errorf("Status does not match: got %s (%v), want %s", got, err, StatusFailed)
+	}
+}
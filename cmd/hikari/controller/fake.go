@@ -0,0 +1,293 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+const (
+	tileColors       = 64
+	maxExtendedZones = 82
+)
+
+// Fake is an in-memory Controller serving a fixed set of devices.
+// Messages setting power, color or label update the devices and queries are answered from their state.
+// Devices given zones with SetZones also answer extended multizone messages, like strips.
+// Strips and matrix devices run the firmware effects they are sent.
+type Fake struct {
+	// Apply updates a device with the payload of a message. It applies power, color and label changes by default
+	// and can be replaced to simulate devices clamping values or ignoring messages.
+	Apply func(d *ldevice.Device, payload packets.Payload)
+
+	mu      sync.Mutex
+	devices []ldevice.Device
+	drops   map[ldevice.Serial]int
+	zones   map[ldevice.Serial][]packets.LightHsbk
+	effects map[ldevice.Serial]packets.Payload
+}
+
+// NewFake returns a Fake serving devices.
+func NewFake(devices ...ldevice.Device) *Fake {
+	return &Fake{
+		Apply:   apply,
+		devices: slices.Clone(devices),
+		drops:   make(map[ldevice.Serial]int),
+		zones:   make(map[ldevice.Serial][]packets.LightHsbk),
+		effects: make(map[ldevice.Serial]packets.Payload),
+	}
+}
+
+// SetZones makes the device a strip with the given zone colors.
+func (f *Fake) SetZones(serial ldevice.Serial, zones []packets.LightHsbk) {
+	f.mu.Lock()
+	f.zones[serial] = slices.Clone(zones)
+	f.mu.Unlock()
+}
+
+// Zones returns the zone colors of the device, nil if it has no zones.
+func (f *Fake) Zones(serial ldevice.Serial) []packets.LightHsbk {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.zones[serial])
+}
+
+// Drop loses the next n acknowledged messages sent to the device, or all of them if n is negative,
+// so that their acknowledgement times out.
+func (f *Fake) Drop(serial ldevice.Serial, n int) {
+	f.mu.Lock()
+	f.drops[serial] = n
+	f.mu.Unlock()
+}
+
+// SetDevices replaces the devices of the fake, e.g. to simulate discovery.
+func (f *Fake) SetDevices(devices ...ldevice.Device) {
+	f.mu.Lock()
+	f.devices = slices.Clone(devices)
+	f.mu.Unlock()
+}
+
+// GetDevices returns the current state of the devices.
+func (f *Fake) GetDevices() []ldevice.Device {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.devices)
+}
+
+// Send applies msg to the device.
+func (f *Fake) Send(serial ldevice.Serial, msg *protocol.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, err := f.device(serial)
+	if err != nil {
+		return err
+	}
+	f.Apply(d, msg.Payload)
+	f.applyZones(serial, msg.Payload)
+	f.applyEffect(d, msg.Payload)
+	return nil
+}
+
+// SendAck applies msg to the device, acknowledging it immediately unless it is dropped.
+func (f *Fake) SendAck(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.drop(serial) {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return f.Send(serial, msg)
+}
+
+// Query answers payload from the state of the device.
+func (f *Fake) Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, err := f.device(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []packets.Payload
+	switch p := payload.(type) {
+	case *packets.LightGet:
+		s := &packets.LightState{Color: lightHsbk(d.Color), Power: powerLevel(d.PoweredOn)}
+		copy(s.Label[:], d.Label)
+		responses = append(responses, s)
+	case *packets.DeviceGetPower:
+		responses = append(responses, &packets.DeviceStatePower{Level: powerLevel(d.PoweredOn)})
+	case *packets.LightGetPower:
+		responses = append(responses, &packets.LightStatePower{Level: powerLevel(d.PoweredOn)})
+	case *packets.DeviceEchoRequest:
+		responses = append(responses, &packets.DeviceEchoResponse{Payload: p.Payload})
+	case *packets.DeviceGetLabel:
+		s := &packets.DeviceStateLabel{}
+		copy(s.Label[:], d.Label)
+		responses = append(responses, s)
+	case *packets.MultiZoneExtendedGetColorZones:
+		zones, ok := f.zones[serial]
+		if !ok {
+			return nil, ErrUnhandled
+		}
+		for i := 0; i == 0 || i < len(zones); i += maxExtendedZones {
+			s := &packets.MultiZoneExtendedStateMultiZone{Count: uint16(len(zones)), Index: uint16(i)}
+			s.ColorsCount = uint8(copy(s.Colors[:], zones[i:]))
+			responses = append(responses, s)
+		}
+	case *packets.MultiZoneGetEffect:
+		if _, ok := f.zones[serial]; !ok {
+			return nil, ErrUnhandled
+		}
+		s, ok := f.effects[serial].(*packets.MultiZoneStateEffect)
+		if !ok {
+			s = &packets.MultiZoneStateEffect{}
+		}
+		responses = append(responses, s)
+	case *packets.TileGetEffect:
+		if d.LightType != ldevice.LightTypeMatrix {
+			return nil, ErrUnhandled
+		}
+		s, ok := f.effects[serial].(*packets.TileStateEffect)
+		if !ok {
+			s = &packets.TileStateEffect{}
+		}
+		responses = append(responses, s)
+	case *packets.TileGet64:
+		if d.LightType != ldevice.LightTypeMatrix {
+			return nil, ErrUnhandled
+		}
+		var colors [tileColors]packets.LightHsbk
+		for i := range colors {
+			colors[i] = lightHsbk(d.Color)
+		}
+		for i := int(p.TileIndex); i < int(p.TileIndex)+int(p.Length) && i < d.MatrixProperties.ChainLength; i++ {
+			responses = append(responses, &packets.TileState64{
+				TileIndex: uint8(i),
+				Rect:      packets.TileBufferRect{Width: uint8(d.MatrixProperties.Width)},
+				Colors:    colors,
+			})
+		}
+	default:
+		return nil, ErrUnhandled
+	}
+	if len(responses) > count {
+		responses = responses[:count]
+	}
+	return responses, nil
+}
+
+// Close does nothing.
+func (f *Fake) Close() error {
+	return nil
+}
+
+// drop reports whether the next acknowledged message to the device is lost.
+func (f *Fake) drop(serial ldevice.Serial) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := f.drops[serial]
+	if n > 0 {
+		f.drops[serial]--
+	}
+	return n != 0
+}
+
+// device returns the device with the given serial. It must be called with mu held.
+func (f *Fake) device(serial ldevice.Serial) (*ldevice.Device, error) {
+	i := slices.IndexFunc(f.devices, func(d ldevice.Device) bool { return d.Serial == serial })
+	if i < 0 {
+		return nil, ErrDeviceNotFound
+	}
+	return &f.devices[i], nil
+}
+
+// applyZones updates the zones of a strip with the message payload. It must be called with mu held.
+func (f *Fake) applyZones(serial ldevice.Serial, payload packets.Payload) {
+	zones, ok := f.zones[serial]
+	if !ok {
+		return
+	}
+	switch p := payload.(type) {
+	case *packets.LightSetColor:
+		for i := range zones {
+			zones[i] = p.Color
+		}
+	case *packets.MultiZoneExtendedSetColorZones:
+		for i := range min(int(p.ColorsCount), maxExtendedZones) {
+			if z := int(p.Index) + i; z < len(zones) {
+				zones[z] = p.Colors[i]
+			}
+		}
+	}
+}
+
+// applyEffect runs the firmware effect of the message on strips and matrix devices. It must be called with mu held.
+func (f *Fake) applyEffect(d *ldevice.Device, payload packets.Payload) {
+	switch p := payload.(type) {
+	case *packets.MultiZoneSetEffect:
+		if _, ok := f.zones[d.Serial]; ok {
+			f.effects[d.Serial] = &packets.MultiZoneStateEffect{Settings: p.Settings}
+		}
+	case *packets.TileSetEffect:
+		if d.LightType == ldevice.LightTypeMatrix {
+			f.effects[d.Serial] = &packets.TileStateEffect{Settings: p.Settings}
+		}
+	}
+}
+
+// apply updates the device with the message payload, ignoring messages it does not model.
+func apply(d *ldevice.Device, payload packets.Payload) {
+	switch p := payload.(type) {
+	case *packets.DeviceSetPower:
+		d.PoweredOn = p.Level > 0
+	case *packets.LightSetPower:
+		d.PoweredOn = p.Level > 0
+	case *packets.LightSetColor:
+		d.Color = color(p.Color)
+	case *packets.DeviceSetLabel:
+		d.Label = cString(p.Label[:])
+	}
+}
+
+func powerLevel(on bool) uint16 {
+	if on {
+		return math.MaxUint16
+	}
+	return 0
+}
+
+// color converts a color in protocol units to device units.
+func color(c packets.LightHsbk) ldevice.Color {
+	return ldevice.Color{
+		Hue:        float64(c.Hue) / math.MaxUint16 * 360,
+		Saturation: float64(c.Saturation) / math.MaxUint16 * 100,
+		Brightness: float64(c.Brightness) / math.MaxUint16 * 100,
+		Kelvin:     c.Kelvin,
+	}
+}
+
+// lightHsbk converts a color in device units to protocol units.
+func lightHsbk(c ldevice.Color) packets.LightHsbk {
+	return packets.LightHsbk{
+		Hue:        uint16(math.Round(c.Hue / 360 * math.MaxUint16)),
+		Saturation: uint16(math.Round(c.Saturation / 100 * math.MaxUint16)),
+		Brightness: uint16(math.Round(c.Brightness / 100 * math.MaxUint16)),
+		Kelvin:     uint16(c.Kelvin),
+	}
+}
+
+func cString(b []byte) string {
+	if i := slices.Index(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}
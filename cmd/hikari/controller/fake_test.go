@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	bulb    = testdevice.Kitchen
+	tiles   = testdevice.Tiles
+	unknown = testdevice.Unknown
+)
+
+func TestFakeSend(t *testing.T) {
+	testCases := map[string]struct {
+		serial  ldevice.Serial
+		payload packets.Payload
+		want    ldevice.Device
+		wantErr error
+	}{
+		"power off": {
+			serial:  bulb.Serial,
+			payload: &packets.DeviceSetPower{Level: 0},
+			want:    withPower(bulb, false),
+		},
+		"set color": {
+			serial:  bulb.Serial,
+			payload: &packets.LightSetColor{Color: packets.LightHsbk{Hue: 65535, Saturation: 65535, Brightness: 65535, Kelvin: 2700}},
+			want: func() ldevice.Device {
+				d := bulb
+				d.Color = ldevice.Color{Hue: 360, Saturation: 100, Brightness: 100, Kelvin: 2700}
+				return d
+			}(),
+		},
+		"set label": {
+			serial:  bulb.Serial,
+			payload: func() packets.Payload { p := &packets.DeviceSetLabel{}; copy(p.Label[:], "Pantry"); return p }(),
+			want:    func() ldevice.Device { d := bulb; d.Label = "Pantry"; return d }(),
+		},
+		"unknown device": {
+			serial:  unknown,
+			payload: &packets.DeviceSetPower{Level: 65535},
+			want:    bulb,
+			wantErr: ErrDeviceNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := NewFake(bulb)
+			err := f.SendAck(context.Background(), tc.serial, protocol.NewMessage(tc.payload))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+			}
+			if got := f.GetDevices()[0]; got.Label != tc.want.Label || got.PoweredOn != tc.want.PoweredOn || got.Color != tc.want.Color {
+				t.Errorf("Device does not match: got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFakeQuery(t *testing.T) {
+	testCases := map[string]struct {
+		serial    ldevice.Serial
+		payload   packets.Payload
+		count     int
+		wantCount int
+		wantErr   error
+	}{
+		"light state": {
+			serial:    bulb.Serial,
+			payload:   &packets.LightGet{},
+			count:     1,
+			wantCount: 1,
+		},
+		"tile colors": {
+			serial:    tiles.Serial,
+			payload:   &packets.TileGet64{Length: 5},
+			count:     5,
+			wantCount: 5,
+		},
+		"tile colors of a bulb": {
+			serial:  bulb.Serial,
+			payload: &packets.TileGet64{Length: 1},
+			count:   1,
+			wantErr: ErrUnhandled,
+		},
+		"unsupported": {
+			serial:  bulb.Serial,
+			payload: &packets.DeviceGetVersion{},
+			count:   1,
+			wantErr: ErrUnhandled,
+		},
+		"unknown device": {
+			serial:  unknown,
+			payload: &packets.LightGet{},
+			count:   1,
+			wantErr: ErrDeviceNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := NewFake(bulb, tiles)
+			responses, err := f.Query(context.Background(), tc.serial, tc.payload, 0, tc.count)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+			}
+			if len(responses) != tc.wantCount {
+				t.Errorf("Responses do not match: got %d, want %d", len(responses), tc.wantCount)
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(NewFake(bulb))
+	_ = r.Send(bulb.Serial, protocol.NewMessage(&packets.DeviceSetPower{Level: 65535}))
+	_ = r.SendAck(context.Background(), unknown, protocol.NewMessage(&packets.DeviceSetPower{}))
+	_, _ = r.Query(context.Background(), bulb.Serial, &packets.LightGet{}, 0, 1)
+
+	want := []struct {
+		method  string
+		serial  ldevice.Serial
+		wantErr error
+	}{
+		{method: MethodSend, serial: bulb.Serial},
+		{method: MethodSendAck, serial: unknown, wantErr: ErrDeviceNotFound},
+		{method: MethodQuery, serial: bulb.Serial},
+	}
+	calls := r.Calls()
+	if len(calls) != len(want) {
+		t.Fatalf("Calls do not match: got %d, want %d", len(calls), len(want))
+	}
+	for i, w := range want {
+		if calls[i].Method != w.method || calls[i].Serial != w.serial || !errors.Is(calls[i].Err, w.wantErr) {
+			t.Errorf("Call %d does not match: got %+v, want %+v", i, calls[i], w)
+		}
+	}
+	if !r.GetDevices()[0].PoweredOn {
+		t.Error("Expected the wrapped controller to receive the message")
+	}
+
+	r.Reset()
+	if len(r.Calls()) != 0 {
+		t.Error("Expected calls to be reset")
+	}
+}
+
+func withPower(d ldevice.Device, on bool) ldevice.Device {
+	d.PoweredOn = on
+	return d
+}
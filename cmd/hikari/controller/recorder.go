@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// Methods of the Controller recorded by a Recorder.
+const (
+	MethodSend    = "send"
+	MethodSendAck = "send_ack"
+	MethodQuery   = "query"
+)
+
+// Call is a message sent through a Recorder.
+type Call struct {
+	Time    time.Time
+	Method  string
+	Serial  ldevice.Serial
+	Payload packets.Payload
+	Err     error
+}
+
+// Recorder is a Controller recording the messages sent through the Controller it wraps.
+type Recorder struct {
+	Controller
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder returns a Recorder wrapping c.
+func NewRecorder(c Controller) *Recorder {
+	return &Recorder{Controller: c}
+}
+
+// Send sends msg through the wrapped controller and records it.
+func (r *Recorder) Send(serial ldevice.Serial, msg *protocol.Message) error {
+	err := r.Controller.Send(serial, msg)
+	r.record(MethodSend, serial, msg.Payload, err)
+	return err
+}
+
+// SendAck sends msg through the wrapped controller and records it.
+func (r *Recorder) SendAck(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error {
+	err := r.Controller.SendAck(ctx, serial, msg)
+	r.record(MethodSendAck, serial, msg.Payload, err)
+	return err
+}
+
+// Query sends payload through the wrapped controller and records it.
+func (r *Recorder) Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	responses, err := r.Controller.Query(ctx, serial, payload, respType, count)
+	r.record(MethodQuery, serial, payload, err)
+	return responses, err
+}
+
+// Calls returns the recorded calls in order.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Reset drops the recorded calls.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.calls = nil
+	r.mu.Unlock()
+}
+
+func (r *Recorder) record(method string, serial ldevice.Serial, payload packets.Payload, err error) {
+	r.mu.Lock()
+	r.calls = append(r.calls, Call{Time: time.Now(), Method: method, Serial: serial, Payload: payload, Err: err})
+	r.mu.Unlock()
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// ErrOffline is returned when a message is not sent because the device is known to be offline.
+var ErrOffline = errors.New("device offline")
+
+// Health is the reachability of a device.
+type Health struct {
+	// Online reports whether the device responded recently enough.
+	Online bool
+	// LastSeen is the last time the device responded.
+	LastSeen time.Time
+	// RTT is the round trip time of the last response of the device.
+	RTT time.Duration
+}
+
+// HealthReporter is implemented by controllers tracking the reachability of devices.
+type HealthReporter interface {
+	Health(serial ldevice.Serial) (Health, bool)
+}
+
+// Tracker is a Controller tracking when each device last responded and its round trip time.
+// Devices are pinged periodically and considered offline when they did not respond for a while.
+// Devices which are no longer discovered keep being returned, so that they can be shown as offline.
+type Tracker struct {
+	Controller
+	offlineAfter time.Duration
+	now          func() time.Time
+	stop         chan struct{}
+	done         chan struct{}
+
+	mu      sync.Mutex
+	serials []ldevice.Serial
+	devices map[ldevice.Serial]ldevice.Device
+	health  map[ldevice.Serial]Health
+}
+
+// NewTracker returns a Tracker wrapping c, pinging devices every pingInterval until closed
+// and considering them offline when they did not respond for offlineAfter.
+// Devices are not pinged when pingInterval is 0.
+func NewTracker(c Controller, pingInterval, offlineAfter time.Duration) *Tracker {
+	t := &Tracker{
+		Controller:   c,
+		offlineAfter: offlineAfter,
+		now:          time.Now,
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		devices:      make(map[ldevice.Serial]ldevice.Device),
+		health:       make(map[ldevice.Serial]Health),
+	}
+	if pingInterval <= 0 {
+		close(t.done)
+		return t
+	}
+	go t.run(pingInterval)
+	return t
+}
+
+// GetDevices returns the discovered devices followed by the devices which are no longer discovered.
+// Devices are seen for the first time when they are discovered.
+func (t *Tracker) GetDevices() []ldevice.Device {
+	discovered := t.Controller.GetDevices()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, d := range discovered {
+		if _, ok := t.devices[d.Serial]; !ok {
+			t.serials = append(t.serials, d.Serial)
+			t.health[d.Serial] = Health{LastSeen: t.now()}
+		}
+		t.devices[d.Serial] = d
+	}
+
+	devices := slices.Clone(discovered)
+	for _, serial := range t.serials {
+		if !slices.ContainsFunc(discovered, func(d ldevice.Device) bool { return d.Serial == serial }) {
+			devices = append(devices, t.devices[serial])
+		}
+	}
+	return devices
+}
+
+// SendAck sends msg through the wrapped controller, marking the device as seen when it is acknowledged.
+func (t *Tracker) SendAck(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error {
+	start := t.now()
+	err := t.Controller.SendAck(ctx, serial, msg)
+	if err == nil {
+		t.seen(serial, start)
+	}
+	return err
+}
+
+// Query sends payload through the wrapped controller, marking the device as seen when it responds.
+func (t *Tracker) Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	start := t.now()
+	responses, err := t.Controller.Query(ctx, serial, payload, respType, count)
+	if err == nil || errors.Is(err, ErrUnhandled) {
+		t.seen(serial, start)
+	}
+	return responses, err
+}
+
+// Health returns the reachability of the device, false if it was never discovered.
+func (t *Tracker) Health(serial ldevice.Serial) (Health, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.health[serial]
+	h.Online = ok && t.now().Sub(h.LastSeen) <= t.offlineAfter
+	return h, ok
+}
+
+// Ping sends an echo request to every known device and waits for the responses until ctx is done.
+func (t *Tracker) Ping(ctx context.Context) {
+	t.mu.Lock()
+	serials := slices.Clone(t.serials)
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, serial := range serials {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = t.Query(ctx, serial, &packets.DeviceEchoRequest{}, uint16(packets.PayloadTypeDeviceEchoResponse), 1)
+		}()
+	}
+	wg.Wait()
+}
+
+// Close stops pinging and closes the wrapped controller.
+func (t *Tracker) Close() error {
+	select {
+	case <-t.stop:
+	default:
+		close(t.stop)
+	}
+	<-t.done
+	return t.Controller.Close()
+}
+
+func (t *Tracker) run(interval time.Duration) {
+	defer close(t.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			t.Ping(ctx)
+			cancel()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// seen records a response of the device to a message sent at start.
+func (t *Tracker) seen(serial ldevice.Serial, start time.Time) {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.devices[serial]; ok {
+		t.health[serial] = Health{LastSeen: now, RTT: now.Sub(start)}
+	}
+}
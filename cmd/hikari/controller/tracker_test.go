@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		discovered   []ldevice.Device
+		elapsed      time.Duration
+		wantDevices  int
+		wantOnline   bool
+		wantLastSeen time.Time
+	}{
+		"discovered device is online": {
+			discovered:   []ldevice.Device{bulb, tiles},
+			wantDevices:  2,
+			wantOnline:   true,
+			wantLastSeen: start,
+		},
+		"responding device stays online": {
+			discovered:   []ldevice.Device{bulb, tiles},
+			elapsed:      time.Minute,
+			wantDevices:  2,
+			wantOnline:   true,
+			wantLastSeen: start.Add(time.Minute),
+		},
+		"unresponsive device is online until the threshold": {
+			discovered:   []ldevice.Device{tiles},
+			elapsed:      10 * time.Second,
+			wantDevices:  2,
+			wantOnline:   true,
+			wantLastSeen: start,
+		},
+		"unresponsive device goes offline and is kept": {
+			discovered:   []ldevice.Device{tiles},
+			elapsed:      time.Minute,
+			wantDevices:  2,
+			wantLastSeen: start,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			now := start
+			f := NewFake(bulb, tiles)
+			tr := NewTracker(f, 0, 30*time.Second)
+			tr.now = func() time.Time { return now }
+			defer tr.Close()
+
+			tr.GetDevices()
+			// Devices which are no longer discovered do not answer pings.
+			f.SetDevices(tc.discovered...)
+			now = now.Add(tc.elapsed)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			tr.Ping(ctx)
+			cancel()
+
+			if got := len(tr.GetDevices()); got != tc.wantDevices {
+				t.Errorf("Devices do not match: got %d, want %d", got, tc.wantDevices)
+			}
+			h, ok := tr.Health(bulb.Serial)
+			if !ok {
+				t.Fatal("Expected device to be tracked")
+			}
+			if h.Online != tc.wantOnline {
+				t.Errorf("Online does not match: got %t, want %t", h.Online, tc.wantOnline)
+			}
+			if !h.LastSeen.Equal(tc.wantLastSeen) {
+				t.Errorf("Last seen does not match: got %s, want %s", h.LastSeen, tc.wantLastSeen)
+			}
+		})
+	}
+}
+
+func TestTrackerUnknownDevice(t *testing.T) {
+	tr := NewTracker(NewFake(bulb), 0, time.Second)
+	defer tr.Close()
+	if _, ok := tr.Health(bulb.Serial); ok {
+		t.Error("Expected device not to be tracked before discovery")
+	}
+}
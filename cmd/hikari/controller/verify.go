@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// ErrMismatch is returned when the state read back from a device differs from the expected one.
+var ErrMismatch = errors.New("state mismatch")
+
+// Tolerances absorbing the rounding of colors to protocol units.
+const (
+	hueTolerance     = 1.0 // degrees
+	percentTolerance = 1.0
+	kelvinTolerance  = 1
+)
+
+// Expectation is the state a device is expected to reach after a command. Nil fields are not verified.
+type Expectation struct {
+	PoweredOn  *bool
+	Hue        *float64
+	Saturation *float64
+	Brightness *float64
+	Kelvin     *uint16
+	// Transition is the duration of the transition to the state, which is read back once it is over.
+	Transition time.Duration
+}
+
+// IsZero reports whether the expectation verifies nothing.
+func (e Expectation) IsZero() bool {
+	return e.PoweredOn == nil && e.Hue == nil && e.Saturation == nil && e.Brightness == nil && e.Kelvin == nil
+}
+
+// Verify waits for the transition to be over and reads back the state of the device.
+// It returns an error wrapping ErrMismatch which lists every field differing from the expectation.
+func Verify(ctx context.Context, c Controller, serial ldevice.Serial, e Expectation) error {
+	select {
+	case <-time.After(e.Transition):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	responses, err := c.Query(ctx, serial, &packets.LightGet{}, uint16(packets.PayloadTypeLightState), 1)
+	if err != nil {
+		return fmt.Errorf("failed to read back state: %w", err)
+	}
+	if len(responses) == 0 {
+		return fmt.Errorf("failed to read back state: no response")
+	}
+	s, ok := responses[0].(*packets.LightState)
+	if !ok {
+		return fmt.Errorf("failed to read back state: unexpected response %T", responses[0])
+	}
+	got := color(s.Color)
+
+	var diffs []string
+	if e.PoweredOn != nil && *e.PoweredOn != (s.Power > 0) {
+		diffs = append(diffs, fmt.Sprintf("power %s, want %s", onOff(s.Power > 0), onOff(*e.PoweredOn)))
+	}
+	if e.Hue != nil && hueDistance(got.Hue, *e.Hue) > hueTolerance {
+		diffs = append(diffs, fmt.Sprintf("hue %.0f, want %.0f", got.Hue, *e.Hue))
+	}
+	if e.Saturation != nil && math.Abs(got.Saturation-*e.Saturation) > percentTolerance {
+		diffs = append(diffs, fmt.Sprintf("saturation %.0f, want %.0f", got.Saturation, *e.Saturation))
+	}
+	if e.Brightness != nil && math.Abs(got.Brightness-*e.Brightness) > percentTolerance {
+		diffs = append(diffs, fmt.Sprintf("brightness %.0f, want %.0f", got.Brightness, *e.Brightness))
+	}
+	if e.Kelvin != nil && math.Abs(float64(s.Color.Kelvin)-float64(*e.Kelvin)) > kelvinTolerance {
+		diffs = append(diffs, fmt.Sprintf("kelvin %d, want %d", s.Color.Kelvin, *e.Kelvin))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %s", ErrMismatch, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+// hueDistance returns the distance between two hues in degrees, wrapping at 360.
+func hueDistance(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	return min(d, 360-d)
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestVerify(t *testing.T) {
+	on, off := true, false
+	hue, brightness := 120.0, 50.0
+	kelvin := uint16(9000)
+	device := bulb
+	device.PoweredOn = true
+	device.Color = ldevice.Color{Hue: 120.4, Saturation: 100, Brightness: 50, Kelvin: 6500}
+
+	testCases := map[string]struct {
+		serial  ldevice.Serial
+		expect  Expectation
+		wantErr error
+		wantMsg string
+	}{
+		"matching power": {
+			serial: device.Serial,
+			expect: Expectation{PoweredOn: &on},
+		},
+		"matching color within rounding": {
+			serial: device.Serial,
+			expect: Expectation{Hue: &hue, Brightness: &brightness},
+		},
+		"missed power": {
+			serial:  device.Serial,
+			expect:  Expectation{PoweredOn: &off},
+			wantErr: ErrMismatch,
+			wantMsg: "state mismatch: power on, want off",
+		},
+		"clamped kelvin": {
+			serial:  device.Serial,
+			expect:  Expectation{Brightness: &brightness, Kelvin: &kelvin},
+			wantErr: ErrMismatch,
+			wantMsg: "state mismatch: kelvin 6500, want 9000",
+		},
+		"unknown device": {
+			serial:  unknown,
+			expect:  Expectation{PoweredOn: &on},
+			wantErr: ErrDeviceNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			err := Verify(context.Background(), NewFake(device), tc.serial, tc.expect)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+			}
+			if tc.wantMsg != "" && err.Error() != tc.wantMsg {
+				t.Errorf("Error message does not match: got %q, want %q", err, tc.wantMsg)
+			}
+		})
+	}
+}
+
+// wrongResponder answers every query with a power state.
+type wrongResponder struct {
+	*Fake
+}
+
+func (wrongResponder) Query(context.Context, ldevice.Serial, packets.Payload, uint16, int) ([]packets.Payload, error) {
+	return []packets.Payload{&packets.DeviceStatePower{}}, nil
+}
+
+func TestVerifyUnexpectedResponse(t *testing.T) {
+	on := true
+	err := Verify(context.Background(), wrongResponder{NewFake(bulb)}, bulb.Serial, Expectation{PoweredOn: &on})
+	if err == nil || errors.Is(err, ErrMismatch) {
+		t.Errorf("Error does not match: got %v, want an unexpected response error", err)
+	}
+}
@@ -3,15 +3,58 @@ package device
 import (
 	"fmt"
 	"io"
+	"math"
+	"time"
 
 	"github.com/alessio-palumbo/hikari/cmd/hikari/color"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/firmware"
 	hlist "github.com/alessio-palumbo/hikari/cmd/hikari/list"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
 	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/lipgloss"
 )
 
+const (
+	markedLabel  = "✔"
+	offlineLabel = "◌"
+	zoneLabel    = "█"
+	// maxZoneCells is the width of the zone bar, strips with more zones are sampled.
+	maxZoneCells = 32
+)
+
+// HealthFunc returns the reachability of the device with the given serial, false if it is not tracked.
+type HealthFunc func(serial ldevice.Serial) (controller.Health, bool)
+
+// Offline reports whether the device is tracked by health and known to be offline.
+func Offline(health HealthFunc, serial ldevice.Serial) bool {
+	if health == nil {
+		return false
+	}
+	h, ok := health(serial)
+	return ok && !h.Online
+}
+
+// LastSeen describes when a device was last seen, e.g. "last seen 3m ago".
+func LastSeen(h controller.Health) string {
+	return fmt.Sprintf("last seen %s ago", ago(time.Since(h.LastSeen)))
+}
+
+// ago formats d in its largest whole unit, e.g. 3m or 2h.
+func ago(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
+
 // Item implements the list.Item interface.
 type Item ldevice.Device
 
@@ -40,7 +83,9 @@ func (i Item) Title() string {
 	return style.SelectedBorder.Render(fmt.Sprintf("%s %s", i.StateSphere(), style.SelectedDevice.Render(i.Label)))
 }
 
-func (i Item) Info() string {
+// Info renders the details of the device along with its reachability, if tracked,
+// the colors of its zones, if any, and the firmware effect running on it, if any.
+func (i Item) Info(h controller.Health, tracked bool, zones []packets.LightHsbk, effect firmware.Effect) string {
 	title := i.Label
 	if title == "" {
 		title = i.Serial.String()
@@ -68,6 +113,14 @@ func (i Item) Info() string {
 		i.Group,
 	)
 
+	if tracked {
+		status := fmt.Sprintf("🟢 Online (RTT %s)", h.RTT.Round(time.Millisecond))
+		if !h.Online {
+			status = "🔴 Offline, " + LastSeen(h)
+		}
+		content += "\n\n" + status
+	}
+
 	if i.Type != ldevice.DeviceTypeSwitch {
 		if i.PoweredOn {
 			showKelvin := i.Color.Saturation < 1
@@ -82,6 +135,12 @@ func (i Item) Info() string {
 					i.Color.Saturation)
 			}
 		}
+		if len(zones) > 0 {
+			content += fmt.Sprintf("\n\nZones: %d\n%s", len(zones), zoneBar(zones))
+		}
+		if effect != "" && effect != firmware.Off {
+			content += fmt.Sprintf("\n\n✨ Firmware effect: %s", effect)
+		}
 	}
 
 	boxStyle := lipgloss.NewStyle().
@@ -94,25 +153,57 @@ func (i Item) Info() string {
 	return boxStyle.Render(content)
 }
 
-func NewList(devices []ldevice.Device) list.Model {
-	renderFunc := func(w io.Writer, m list.Model, index int, listItem list.Item) {
-		deviceItem, ok := listItem.(Item)
-		if !ok {
-			return
-		}
+// Selection holds the devices marked in the list, keyed by serial.
+type Selection map[ldevice.Serial]bool
 
-		var str string
-		if index == m.Index() {
-			spStyle := style.ListSelected.Render(deviceItem.StateSphere())
-			lbStyle := style.ListSelected.BorderLeft(false).Render(deviceItem.Label)
-			str = fmt.Sprintf("%s%s", spStyle, lbStyle)
-		} else {
-			spStyle := style.ListItem.Render(deviceItem.StateSphere())
-			lbStyle := style.ListItem.PaddingLeft(0).Render(deviceItem.Label)
-			str = fmt.Sprintf("%s %s", spStyle, lbStyle)
+// Toggle marks the device if unmarked and unmarks it otherwise.
+func (s Selection) Toggle(serial ldevice.Serial) {
+	if s[serial] {
+		delete(s, serial)
+		return
+	}
+	s[serial] = true
+}
+
+// ToggleAll marks all the given items unless they are all marked already, in which case it unmarks them.
+func (s Selection) ToggleAll(items []list.Item) {
+	allMarked := true
+	for _, i := range items {
+		if d, ok := i.(Item); ok && !s[d.Serial] {
+			allMarked = false
+			break
+		}
+	}
+	for _, i := range items {
+		if d, ok := i.(Item); ok {
+			if allMarked {
+				delete(s, d.Serial)
+			} else {
+				s[d.Serial] = true
+			}
 		}
+	}
+}
 
-		fmt.Fprint(w, str)
+// NewList returns the device list. Devices in selection are rendered as marked
+// and devices which health reports offline are greyed out with the time they were last seen.
+func NewList(devices []ldevice.Device, selection Selection, health HealthFunc) list.Model {
+	renderFunc := func(w io.Writer, m list.Model, index int, listItem list.Item) {
+		switch item := listItem.(type) {
+		case GroupItem:
+			renderGroupItem(w, item, index == m.Index())
+		case Item:
+			var indent string
+			if isTree(m) {
+				indent = nodeIndent + nodeIndent
+			}
+			var offline string
+			if Offline(health, item.Serial) {
+				h, _ := health(item.Serial)
+				offline = LastSeen(h)
+			}
+			renderDeviceItem(w, item, index == m.Index(), selection[item.Serial], offline, indent)
+		}
 	}
 	d := hlist.NewDelegate(renderFunc, hlist.SetDelegateSpacing(1))
 
@@ -123,6 +214,61 @@ func NewList(devices []ldevice.Device) list.Model {
 	return l
 }
 
+// renderDeviceItem renders a device, greyed out with the offline note if not empty.
+func renderDeviceItem(w io.Writer, deviceItem Item, selected, marked bool, offline, indent string) {
+	label := deviceItem.Label
+	sphere := deviceItem.StateSphere()
+	if offline != "" {
+		label = style.Offline.Render(label + " · " + offline)
+		sphere = style.Offline.PaddingRight(1).Render(offlineLabel)
+	}
+	if marked {
+		label += style.ActionActive.Render(" " + markedLabel)
+	}
+
+	var str string
+	if selected {
+		spStyle := style.ListSelected.Render(sphere)
+		lbStyle := style.ListSelected.BorderLeft(false).Render(label)
+		str = fmt.Sprintf("%s%s", spStyle, lbStyle)
+	} else {
+		spStyle := style.ListItem.Render(sphere)
+		lbStyle := style.ListItem.PaddingLeft(0).Render(label)
+		str = fmt.Sprintf("%s %s", spStyle, lbStyle)
+	}
+
+	fmt.Fprint(w, indent+str)
+}
+
+func renderGroupItem(w io.Writer, groupItem GroupItem, selected bool) {
+	fn := style.ListItem.Render
+	if selected {
+		fn = style.ListSelected.Render
+	}
+	fmt.Fprint(w, groupItem.indent()+fn(groupItem.label()))
+}
+
+// zoneBar renders the colors of the zones as a bar of at most maxZoneCells cells.
+func zoneBar(zones []packets.LightHsbk) string {
+	cells := min(len(zones), maxZoneCells)
+	var bar string
+	for c := range cells {
+		z := zones[c*len(zones)/cells]
+		var r, g, b int
+		if z.Saturation == 0 {
+			r, g, b = color.KelvinToRGB(int(z.Kelvin))
+		} else {
+			r, g, b = color.HSBToRGB(
+				float64(z.Hue)*360/math.MaxUint16,
+				float64(z.Saturation)*100/math.MaxUint16,
+				float64(z.Brightness)*100/math.MaxUint16,
+			)
+		}
+		bar += lipgloss.NewStyle().Foreground(color.RGBToLipglossColor(r, g, b)).Render(zoneLabel)
+	}
+	return bar
+}
+
 func rgbColorBlock(r, g, b int, text string) string {
 	color := color.RGBToLipglossColor(r, g, b)
 	return lipgloss.NewStyle().Foreground(color).Padding(0, 1, 0, 0).Render(text)
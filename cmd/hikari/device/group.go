@@ -0,0 +1,133 @@
+package device
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/charmbracelet/bubbles/list"
+)
+
+const (
+	unnamedNode = "(none)"
+	nodeIndent  = "  "
+)
+
+type NodeKind int
+
+const (
+	NodeLocation NodeKind = iota
+	NodeGroup
+)
+
+// GroupItem is a location or group node of the device tree. It implements the list.Item interface.
+type GroupItem struct {
+	Kind     NodeKind
+	Name     string
+	Location string
+	Members  []Item
+}
+
+func (g GroupItem) FilterValue() string {
+	return g.Name + " " + g.Location
+}
+
+func (g GroupItem) Title() string {
+	return style.SelectedBorder.Render(style.SelectedDevice.Render(g.label()))
+}
+
+// Key returns a value identifying the node across device list refreshes.
+func (g GroupItem) Key() string {
+	return fmt.Sprintf("%d/%s/%s", g.Kind, g.Location, g.Name)
+}
+
+// ListItems returns the members of the node as list items.
+func (g GroupItem) ListItems() []list.Item {
+	items := make([]list.Item, len(g.Members))
+	for i, m := range g.Members {
+		items[i] = m
+	}
+	return items
+}
+
+func (g GroupItem) label() string {
+	name := g.Name
+	if name == "" {
+		name = unnamedNode
+	}
+	return fmt.Sprintf("▾ %s (%d)", name, len(g.Members))
+}
+
+func (g GroupItem) indent() string {
+	if g.Kind == NodeGroup {
+		return nodeIndent
+	}
+	return ""
+}
+
+// Items wraps devices into list items.
+func Items(devices []ldevice.Device) []list.Item {
+	items := make([]list.Item, len(devices))
+	for i := range devices {
+		items[i] = Item(devices[i])
+	}
+	return items
+}
+
+// Tree returns devices as list items grouped by Location and Group, with each
+// location node followed by its group nodes and each group node followed by its devices.
+func Tree(devices []ldevice.Device) []list.Item {
+	sorted := make([]Item, len(devices))
+	for i := range devices {
+		sorted[i] = Item(devices[i])
+	}
+	slices.SortStableFunc(sorted, func(a, b Item) int {
+		return cmp.Or(cmp.Compare(a.Location, b.Location), cmp.Compare(a.Group, b.Group))
+	})
+
+	var items []list.Item
+	var location, group *GroupItem
+	var locationIndex, groupIndex int
+	for _, d := range sorted {
+		if location == nil || location.Name != d.Location {
+			location = &GroupItem{Kind: NodeLocation, Name: d.Location}
+			locationIndex = len(items)
+			items = append(items, *location)
+			group = nil
+		}
+		if group == nil || group.Name != d.Group {
+			group = &GroupItem{Kind: NodeGroup, Name: d.Group, Location: d.Location}
+			groupIndex = len(items)
+			items = append(items, *group)
+		}
+		location.Members = append(location.Members, d)
+		group.Members = append(group.Members, d)
+		items[locationIndex] = *location
+		items[groupIndex] = *group
+		items = append(items, d)
+	}
+	return items
+}
+
+// Key returns a value identifying a device or group list item across refreshes.
+func Key(i list.Item) string {
+	switch item := i.(type) {
+	case Item:
+		return item.Serial.String()
+	case GroupItem:
+		return item.Key()
+	}
+	return ""
+}
+
+// isTree reports whether the list holds a device tree, which always starts with a location node.
+func isTree(m list.Model) bool {
+	items := m.Items()
+	if len(items) == 0 {
+		return false
+	}
+	_, ok := items[0].(GroupItem)
+	return ok
+}
@@ -0,0 +1,87 @@
+package device
+
+import (
+	"fmt"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+// SchemaVersion is the version of the Record JSON schema.
+// It must be bumped whenever a field is renamed, removed or changes meaning.
+const SchemaVersion = 1
+
+const (
+	recordTypeLight  = "light"
+	recordTypeSwitch = "switch"
+)
+
+// Record is the machine-readable representation of a device.
+type Record struct {
+	SchemaVersion int           `json:"schema_version"`
+	Serial        string        `json:"serial"`
+	Label         string        `json:"label"`
+	IP            string        `json:"ip"`
+	ProductID     uint32        `json:"product_id"`
+	ProductName   string        `json:"product_name"`
+	Firmware      string        `json:"firmware"`
+	Location      string        `json:"location"`
+	Group         string        `json:"group"`
+	Type          string        `json:"type"`
+	LightType     string        `json:"light_type,omitempty"`
+	Matrix        *MatrixRecord `json:"matrix,omitempty"`
+	PoweredOn     bool          `json:"powered_on"`
+	Color         *ColorRecord  `json:"color,omitempty"`
+}
+
+// MatrixRecord holds the properties of a matrix device.
+type MatrixRecord struct {
+	Width       int `json:"width"`
+	Height      int `json:"height"`
+	ChainLength int `json:"chain_length"`
+}
+
+// ColorRecord holds the current color of a light.
+type ColorRecord struct {
+	Hue        float64 `json:"hue"`
+	Saturation float64 `json:"saturation"`
+	Brightness float64 `json:"brightness"`
+	Kelvin     uint16  `json:"kelvin"`
+}
+
+// NewRecord returns the Record for the given device.
+func NewRecord(d ldevice.Device) Record {
+	r := Record{
+		SchemaVersion: SchemaVersion,
+		Serial:        d.Serial.String(),
+		Label:         d.Label,
+		IP:            fmt.Sprint(d.Address.IP),
+		ProductID:     uint32(d.ProductID),
+		ProductName:   d.RegistryName,
+		Firmware:      fmt.Sprint(d.FirmwareVersion),
+		Location:      d.Location,
+		Group:         d.Group,
+		Type:          recordTypeLight,
+		PoweredOn:     d.PoweredOn,
+	}
+
+	if d.Type == ldevice.DeviceTypeSwitch {
+		r.Type = recordTypeSwitch
+		return r
+	}
+
+	r.LightType = fmt.Sprint(d.LightType)
+	if d.LightType == ldevice.LightTypeMatrix {
+		r.Matrix = &MatrixRecord{
+			Width:       int(d.MatrixProperties.Width),
+			Height:      int(d.MatrixProperties.Height),
+			ChainLength: int(d.MatrixProperties.ChainLength),
+		}
+	}
+	r.Color = &ColorRecord{
+		Hue:        d.Color.Hue,
+		Saturation: d.Color.Saturation,
+		Brightness: d.Color.Brightness,
+		Kelvin:     uint16(d.Color.Kelvin),
+	}
+	return r
+}
@@ -0,0 +1,49 @@
+package device
+
+import (
+	"strings"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+const (
+	// TargetAll matches every discovered device.
+	TargetAll = "all"
+	// TargetGroupPrefix prefixes a group name to match all devices in that group.
+	TargetGroupPrefix = "group:"
+	// TargetLocationPrefix prefixes a location name to match all devices in that location.
+	TargetLocationPrefix = "location:"
+)
+
+// Match reports whether the device is addressed by target, which can be TargetAll,
+// a group or location name with the respective prefix, a serial or a label (case-insensitive).
+func Match(d ldevice.Device, target string) bool {
+	if target == TargetAll {
+		return true
+	}
+	if name, ok := strings.CutPrefix(target, TargetGroupPrefix); ok {
+		return strings.EqualFold(d.Group, name)
+	}
+	if name, ok := strings.CutPrefix(target, TargetLocationPrefix); ok {
+		return strings.EqualFold(d.Location, name)
+	}
+	return strings.EqualFold(d.Serial.String(), target) || strings.EqualFold(d.Label, target)
+}
+
+// IsMulti reports whether target can address more than one device.
+func IsMulti(target string) bool {
+	return target == TargetAll ||
+		strings.HasPrefix(target, TargetGroupPrefix) ||
+		strings.HasPrefix(target, TargetLocationPrefix)
+}
+
+// Filter returns the devices addressed by target.
+func Filter(devices []ldevice.Device, target string) []ldevice.Device {
+	var matched []ldevice.Device
+	for _, d := range devices {
+		if Match(d, target) {
+			matched = append(matched, d)
+		}
+	}
+	return matched
+}
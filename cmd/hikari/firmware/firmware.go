@@ -0,0 +1,191 @@
+// Package firmware starts, stops and reads the effects running on the firmware of strips and matrix devices,
+// which keep running when hikari exits, unlike the effects hikari drives itself.
+package firmware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/multizone"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// ErrUnsupported is returned when an effect does not run on devices of the kind it is started or stopped on.
+var ErrUnsupported = errors.New("effect not supported")
+
+// Effect is an effect of the device firmware.
+type Effect string
+
+const (
+	Off Effect = "off"
+	// Move moves the zone colors of a strip along it.
+	Move Effect = "move"
+	// Morph blends the colors of a palette across the tiles of a matrix device.
+	Morph Effect = "morph"
+	// Flame flickers matrix devices like a fire.
+	Flame Effect = "flame"
+	// Sky renders a sunrise, a sunset or clouds on matrix devices.
+	Sky Effect = "sky"
+)
+
+// Effects are the effects that can be started, strip effects first.
+var Effects = []Effect{Move, Morph, Flame, Sky}
+
+// Directions are the directions of the Move effect.
+var Directions = []string{DirectionRight, DirectionLeft}
+
+// SkyTypes are the kinds of sky of the Sky effect.
+var SkyTypes = []string{SkySunrise, SkySunset, SkyClouds}
+
+const (
+	DirectionRight = "right"
+	DirectionLeft  = "left"
+
+	SkySunrise = "sunrise"
+	SkySunset  = "sunset"
+	SkyClouds  = "clouds"
+)
+
+// Querier requests state from devices.
+type Querier interface {
+	Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error)
+}
+
+// Settings are the parameters of an effect, only some of which apply to each effect.
+type Settings struct {
+	Effect Effect
+	// Speed is the length of a cycle of the effect.
+	Speed time.Duration
+	// Direction is the direction of Move.
+	Direction string
+	// Palette are the colors of Morph, the device default when empty.
+	Palette []packets.LightHsbk
+	// SkyType is the kind of sky of Sky.
+	SkyType string
+}
+
+// Start returns the message starting the effect on the device,
+// failing with ErrUnsupported if the effect does not run on devices of its kind.
+// Strip effects query the zones of the device, which tells strips from other lights.
+func Start(ctx context.Context, q Querier, d ldevice.Device, s Settings) (*protocol.Message, error) {
+	matrix := d.LightType == ldevice.LightTypeMatrix
+	speed := uint32(s.Speed.Milliseconds())
+
+	switch s.Effect {
+	case Move:
+		if matrix {
+			return nil, fmt.Errorf("%s: %w by matrix devices", s.Effect, ErrUnsupported)
+		}
+		if err := checkZones(ctx, q, d); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Effect, err)
+		}
+		var direction uint32
+		if s.Direction == DirectionLeft {
+			direction = 1
+		}
+		return protocol.NewMessage(&packets.MultiZoneSetEffect{Settings: packets.MultiZoneEffectSettings{
+			Type:      enums.MultiZoneEffectTypeMULTIZONEEFFECTTYPEMOVE,
+			Speed:     speed,
+			Parameter: packets.MultiZoneEffectParameter{Parameter1: direction},
+		}}), nil
+	case Morph, Flame, Sky:
+		if !matrix {
+			return nil, fmt.Errorf("%s: %w by devices without tiles", s.Effect, ErrUnsupported)
+		}
+		settings := packets.TileEffectSettings{Speed: speed}
+		switch s.Effect {
+		case Morph:
+			settings.Type = enums.TileEffectTypeTILEEFFECTTYPEMORPH
+			settings.PaletteCount = uint8(copy(settings.Palette[:], s.Palette))
+		case Flame:
+			settings.Type = enums.TileEffectTypeTILEEFFECTTYPEFLAME
+		case Sky:
+			settings.Type = enums.TileEffectTypeTILEEFFECTTYPESKY
+			settings.Parameter.Parameter0 = uint32(skyType(s.SkyType))
+		}
+		return protocol.NewMessage(&packets.TileSetEffect{Settings: settings}), nil
+	}
+	return nil, fmt.Errorf("invalid effect: %s", s.Effect)
+}
+
+// Stop returns the message stopping the effect running on the device,
+// failing with ErrUnsupported if the device has no firmware effects.
+func Stop(ctx context.Context, q Querier, d ldevice.Device) (*protocol.Message, error) {
+	if d.LightType == ldevice.LightTypeMatrix {
+		return protocol.NewMessage(&packets.TileSetEffect{Settings: packets.TileEffectSettings{
+			Type: enums.TileEffectTypeTILEEFFECTTYPEOFF,
+		}}), nil
+	}
+	if err := checkZones(ctx, q, d); err != nil {
+		return nil, err
+	}
+	return protocol.NewMessage(&packets.MultiZoneSetEffect{Settings: packets.MultiZoneEffectSettings{
+		Type: enums.MultiZoneEffectTypeMULTIZONEEFFECTTYPEOFF,
+	}}), nil
+}
+
+// checkZones fails with ErrUnsupported unless the device has several zones.
+// Single zone lights acknowledge strip effect messages without running them.
+func checkZones(ctx context.Context, q Querier, d ldevice.Device) error {
+	zones, err := multizone.Get(ctx, q, d.Serial)
+	if errors.Is(err, controller.ErrUnhandled) || err == nil && len(zones) <= 1 {
+		return fmt.Errorf("%w by devices without zones", ErrUnsupported)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read zones: %w", err)
+	}
+	return nil
+}
+
+// Get returns the effect running on the device, Off if none.
+// Devices without firmware effects fail with controller.ErrUnhandled, or time out if they do not report unhandled messages.
+func Get(ctx context.Context, q Querier, d ldevice.Device) (Effect, error) {
+	if d.LightType == ldevice.LightTypeMatrix {
+		responses, err := q.Query(ctx, d.Serial, &packets.TileGetEffect{}, uint16(packets.PayloadTypeTileStateEffect), 1)
+		if err != nil {
+			return "", err
+		}
+		state, ok := responses[0].(*packets.TileStateEffect)
+		if !ok {
+			return "", fmt.Errorf("unexpected response %T", responses[0])
+		}
+		switch state.Settings.Type {
+		case enums.TileEffectTypeTILEEFFECTTYPEMORPH:
+			return Morph, nil
+		case enums.TileEffectTypeTILEEFFECTTYPEFLAME:
+			return Flame, nil
+		case enums.TileEffectTypeTILEEFFECTTYPESKY:
+			return Sky, nil
+		}
+		return Off, nil
+	}
+
+	responses, err := q.Query(ctx, d.Serial, &packets.MultiZoneGetEffect{}, uint16(packets.PayloadTypeMultiZoneStateEffect), 1)
+	if err != nil {
+		return "", err
+	}
+	state, ok := responses[0].(*packets.MultiZoneStateEffect)
+	if !ok {
+		return "", fmt.Errorf("unexpected response %T", responses[0])
+	}
+	if state.Settings.Type == enums.MultiZoneEffectTypeMULTIZONEEFFECTTYPEMOVE {
+		return Move, nil
+	}
+	return Off, nil
+}
+
+func skyType(v string) enums.TileEffectSkyType {
+	switch v {
+	case SkySunrise:
+		return enums.TileEffectSkyTypeTILEEFFECTSKYTYPESUNRISE
+	case SkySunset:
+		return enums.TileEffectSkyTypeTILEEFFECTSKYTYPESUNSET
+	}
+	return enums.TileEffectSkyTypeTILEEFFECTSKYTYPECLOUDS
+}
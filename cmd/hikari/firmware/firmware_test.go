@@ -0,0 +1,151 @@
+package firmware
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	strip = testdevice.Strip
+	tiles = testdevice.Tiles
+	bulb  = testdevice.Kitchen
+	// lounge reports a single zone, as some bulbs answer zone queries.
+	lounge = testdevice.Lounge
+)
+
+func TestStartAndStop(t *testing.T) {
+	testCases := map[string]struct {
+		device   ldevice.Device
+		settings Settings
+		wantErr  bool
+		check    func(t *testing.T, payload packets.Payload)
+	}{
+		"move": {
+			device:   strip,
+			settings: Settings{Effect: Move, Speed: 2 * time.Second, Direction: DirectionLeft},
+			check: func(t *testing.T, payload packets.Payload) {
+				s := payload.(*packets.MultiZoneSetEffect).Settings
+				if s.Speed != 2000 || s.Parameter.Parameter1 != 1 {
+					t.Errorf("Settings do not match: got speed %d, direction %d, want 2000, 1", s.Speed, s.Parameter.Parameter1)
+				}
+			},
+		},
+		"morph": {
+			device:   tiles,
+			settings: Settings{Effect: Morph, Speed: 5 * time.Second, Palette: make([]packets.LightHsbk, 3)},
+			check: func(t *testing.T, payload packets.Payload) {
+				if n := payload.(*packets.TileSetEffect).Settings.PaletteCount; n != 3 {
+					t.Errorf("Palette does not match: got %d colors, want 3", n)
+				}
+			},
+		},
+		"flame": {
+			device:   tiles,
+			settings: Settings{Effect: Flame, Speed: 4 * time.Second},
+		},
+		"sky": {
+			device:   tiles,
+			settings: Settings{Effect: Sky, Speed: 50 * time.Second, SkyType: SkySunset},
+			check: func(t *testing.T, payload packets.Payload) {
+				if p := payload.(*packets.TileSetEffect).Settings.Parameter.Parameter0; p != 1 {
+					t.Errorf("Sky type does not match: got %d, want 1", p)
+				}
+			},
+		},
+		"move on bulb": {
+			device:   bulb,
+			settings: Settings{Effect: Move},
+			wantErr:  true,
+		},
+		"move on single zone light": {
+			device:   lounge,
+			settings: Settings{Effect: Move},
+			wantErr:  true,
+		},
+		"move on matrix device": {
+			device:   tiles,
+			settings: Settings{Effect: Move},
+			wantErr:  true,
+		},
+		"morph on strip": {
+			device:   strip,
+			settings: Settings{Effect: Morph},
+			wantErr:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := controller.NewFake(strip, tiles, bulb, lounge)
+			f.SetZones(strip.Serial, make([]packets.LightHsbk, 16))
+			f.SetZones(lounge.Serial, make([]packets.LightHsbk, 1))
+
+			msg, err := Start(context.Background(), f, tc.device, tc.settings)
+			if err != nil && !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("Error does not match: got %v, want %v", err, ErrUnsupported)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Error does not match: got %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if tc.check != nil {
+				tc.check(t, msg.Payload)
+			}
+
+			if err := f.Send(tc.device.Serial, msg); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := Get(context.Background(), f, tc.device); err != nil || got != tc.settings.Effect {
+				t.Errorf("Effect does not match: got %q (%v), want %q", got, err, tc.settings.Effect)
+			}
+
+			if msg, err = Stop(context.Background(), f, tc.device); err != nil {
+				t.Fatal(err)
+			}
+			if err := f.Send(tc.device.Serial, msg); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := Get(context.Background(), f, tc.device); err != nil || got != Off {
+				t.Errorf("Effect does not match: got %q (%v), want %q", got, err, Off)
+			}
+		})
+	}
+}
+
+func TestStopUnsupported(t *testing.T) {
+	f := controller.NewFake(bulb)
+	if _, err := Stop(context.Background(), f, bulb); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Error does not match: got %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestGetUnhandled(t *testing.T) {
+	f := controller.NewFake(bulb)
+	if _, err := Get(context.Background(), f, bulb); !errors.Is(err, controller.ErrUnhandled) {
+		t.Errorf("Error does not match: got %v, want %v", err, controller.ErrUnhandled)
+	}
+}
+
+// powerResponder answers every query with a power state.
+type powerResponder struct{}
+
+func (powerResponder) Query(context.Context, ldevice.Serial, packets.Payload, uint16, int) ([]packets.Payload, error) {
+	return []packets.Payload{&packets.DeviceStatePower{}}, nil
+}
+
+func TestGetUnexpectedResponse(t *testing.T) {
+	for _, d := range []ldevice.Device{strip, tiles} {
+		if _, err := Get(context.Background(), powerResponder{}, d); err == nil {
+			t.Errorf("Expected an error on an unexpected response from %s", d.Label)
+		}
+	}
+}
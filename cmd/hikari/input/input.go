@@ -1,6 +1,10 @@
 package input
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"github.com/alessio-palumbo/hikari/cmd/hikari/keymap"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
 
 type InputType int
 
@@ -18,3 +22,24 @@ type Input interface {
 	Value() string
 	Reset() Input
 }
+
+// keys are the bindings shared by all inputs.
+var keys = keymap.Default().Input
+
+// SetKeys replaces the bindings used by all inputs.
+func SetKeys(k keymap.InputKeys) {
+	keys = k
+}
+
+// Bindings returns the bindings used by inputs of type t.
+func Bindings(t InputType) []key.Binding {
+	switch t {
+	case InputSingleSelect, InputSingleSelectInline:
+		return []key.Binding{keys.Up, keys.Down}
+	case InputMultiSelect:
+		return []key.Binding{keys.Up, keys.Down, keys.Toggle}
+	case InputMatrixSelect:
+		return []key.Binding{keys.Up, keys.Down, keys.Left, keys.Right, keys.Toggle}
+	}
+	return nil
+}
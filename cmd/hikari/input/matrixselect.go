@@ -3,6 +3,7 @@ package input
 import (
 	"strings"
 
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -29,24 +30,24 @@ func NewMatrixSelect(width, height int) MatrixSelectModel {
 func (m MatrixSelectModel) Update(msg tea.Msg) (Input, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "left", "h":
+		switch {
+		case key.Matches(msg, keys.Left):
 			if m.cursorX > 0 {
 				m.cursorX--
 			}
-		case "right", "l":
+		case key.Matches(msg, keys.Right):
 			if m.cursorX < m.width-1 {
 				m.cursorX++
 			}
-		case "up", "k":
+		case key.Matches(msg, keys.Up):
 			if m.cursorY > 0 {
 				m.cursorY--
 			}
-		case "down", "j":
+		case key.Matches(msg, keys.Down):
 			if m.cursorY < m.height-1 {
 				m.cursorY++
 			}
-		case " ", "t":
+		case key.Matches(msg, keys.Toggle):
 			if m.matrix[m.cursorY][m.cursorX] {
 				m.matrix[m.cursorY][m.cursorX] = false
 			} else {
@@ -6,6 +6,7 @@ import (
 
 	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -38,16 +39,16 @@ func NewMultiSelect(options []string, width int) MultiSelectModel {
 func (m MultiSelectModel) Update(msg tea.Msg) (Input, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "up", "k":
+		switch {
+		case key.Matches(msg, keys.Up):
 			if m.cursor > 0 {
 				m.cursor--
 			}
-		case "down", "j":
+		case key.Matches(msg, keys.Down):
 			if m.cursor < len(m.items)-1 {
 				m.cursor++
 			}
-		case " ", "t":
+		case key.Matches(msg, keys.Toggle):
 			m.items[m.cursor].Checked = !m.items[m.cursor].Checked
 		}
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
+	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
@@ -39,12 +40,12 @@ func NewInputSingleSelectInline(options []string, width int) SingleSelectModel {
 func (m SingleSelectModel) Update(msg tea.Msg) (Input, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "up", "k":
+		switch {
+		case key.Matches(msg, keys.Up):
 			if m.cursor > 0 {
 				m.cursor--
 			}
-		case "down", "j":
+		case key.Matches(msg, keys.Down):
 			if m.cursor == cursorResetPosition && m.cursor < len(m.options)-2 {
 				m.cursor += 2
 			} else if m.cursor < len(m.options)-1 {
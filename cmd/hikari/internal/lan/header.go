@@ -0,0 +1,116 @@
+// Package lan encodes and decodes LIFX LAN protocol messages, for the controller client and the device simulator.
+package lan
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+const (
+	// HeaderSize is the size in bytes of a LIFX LAN protocol header.
+	HeaderSize = 36
+	// DefaultPort is the UDP port LIFX devices listen on.
+	DefaultPort = 56700
+
+	protocolNumber  = 1024
+	flagAddressable = 1 << 12
+	flagTagged      = 1 << 13
+	flagResRequired = 1 << 0
+	flagAckRequired = 1 << 1
+)
+
+// Header holds the fields of a LIFX LAN protocol header.
+type Header struct {
+	Size        uint16
+	Tagged      bool
+	Source      uint32
+	Target      [8]byte
+	AckRequired bool
+	ResRequired bool
+	Sequence    uint8
+	Type        uint16
+}
+
+// Encode returns the binary representation of a message with the given header and payload.
+// Size and Type are derived from the payload.
+func Encode(h Header, payload packets.Payload) ([]byte, error) {
+	body, err := payload.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, HeaderSize+len(body))
+	binary.LittleEndian.PutUint16(b[0:], uint16(len(b)))
+	proto := uint16(protocolNumber | flagAddressable)
+	if h.Tagged {
+		proto |= flagTagged
+	}
+	binary.LittleEndian.PutUint16(b[2:], proto)
+	binary.LittleEndian.PutUint32(b[4:], h.Source)
+	copy(b[8:16], h.Target[:])
+	var flags byte
+	if h.ResRequired {
+		flags |= flagResRequired
+	}
+	if h.AckRequired {
+		flags |= flagAckRequired
+	}
+	b[22] = flags
+	b[23] = h.Sequence
+	binary.LittleEndian.PutUint16(b[32:], payload.PayloadType())
+	copy(b[HeaderSize:], body)
+	return b, nil
+}
+
+// Decode parses a message into its header and payload.
+func Decode(b []byte) (Header, packets.Payload, error) {
+	if len(b) < HeaderSize {
+		return Header{}, nil, fmt.Errorf("message too short: %d bytes", len(b))
+	}
+
+	var h Header
+	h.Size = binary.LittleEndian.Uint16(b[0:])
+	if int(h.Size) != len(b) {
+		return Header{}, nil, fmt.Errorf("size mismatch: header %d, message %d", h.Size, len(b))
+	}
+	proto := binary.LittleEndian.Uint16(b[2:])
+	if proto&0x0fff != protocolNumber {
+		return Header{}, nil, fmt.Errorf("unsupported protocol: %d", proto&0x0fff)
+	}
+	h.Tagged = proto&flagTagged != 0
+	h.Source = binary.LittleEndian.Uint32(b[4:])
+	copy(h.Target[:], b[8:16])
+	h.ResRequired = b[22]&flagResRequired != 0
+	h.AckRequired = b[22]&flagAckRequired != 0
+	h.Sequence = b[23]
+	h.Type = binary.LittleEndian.Uint16(b[32:])
+
+	newPayload, ok := packets.Payloads[h.Type]
+	if !ok {
+		return h, nil, fmt.Errorf("unknown payload type: %d", h.Type)
+	}
+	payload := newPayload()
+	if err := payload.UnmarshalBinary(b[HeaderSize:]); err != nil {
+		return h, nil, err
+	}
+	return h, payload, nil
+}
+
+// ParseSerial parses a hex encoded serial, e.g. d073d5000001, into a header target.
+func ParseSerial(s string) ([8]byte, error) {
+	var target [8]byte
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 6 {
+		return target, fmt.Errorf("invalid serial: %s", s)
+	}
+	copy(target[:], b)
+	return target, nil
+}
+
+// FormatSerial returns the hex encoded serial of a header target.
+func FormatSerial(target [8]byte) string {
+	return hex.EncodeToString(target[:6])
+}
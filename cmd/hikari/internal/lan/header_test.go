@@ -0,0 +1,70 @@
+package lan
+
+import (
+	"testing"
+
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	target, err := ParseSerial("d073d5000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		header  Header
+		payload packets.Payload
+	}{
+		"get with response required": {
+			header:  Header{Source: 42, Target: target, ResRequired: true, Sequence: 7},
+			payload: &packets.LightGet{},
+		},
+		"set with ack required": {
+			header:  Header{Source: 42, Target: target, AckRequired: true, Sequence: 255},
+			payload: &packets.LightSetColor{Color: packets.LightHsbk{Hue: 1, Saturation: 2, Brightness: 3, Kelvin: 3500}, Duration: 1000},
+		},
+		"tagged broadcast": {
+			header:  Header{Source: 42, Tagged: true},
+			payload: &packets.DeviceGetService{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			b, err := Encode(tc.header, tc.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) != HeaderSize+tc.payload.Size() {
+				t.Errorf("Expected message size %d, got %d", HeaderSize+tc.payload.Size(), len(b))
+			}
+
+			h, payload, err := Decode(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.header.Size = uint16(len(b))
+			tc.header.Type = tc.payload.PayloadType()
+			if h != tc.header {
+				t.Errorf("Decoded header does not match: got %+v, want %+v", h, tc.header)
+			}
+			if payload.PayloadType() != tc.payload.PayloadType() {
+				t.Errorf("Decoded payload type does not match: got %d, want %d", payload.PayloadType(), tc.payload.PayloadType())
+			}
+		})
+	}
+}
+
+func TestParseSerial(t *testing.T) {
+	target, err := ParseSerial("d073d5000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FormatSerial(target); got != "d073d5000001" {
+		t.Errorf("Expected serial d073d5000001, got %s", got)
+	}
+	if _, err := ParseSerial("d073d5"); err == nil {
+		t.Error("Expected error for short serial")
+	}
+}
@@ -0,0 +1,391 @@
+// Package mqtt implements the subset of an MQTT 3.1.1 client needed to bridge devices to a broker:
+// publishing and subscribing at QoS 0, retained messages, a last will and keep alive pings.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	protocolName  = "MQTT"
+	protocolLevel = 4
+	// DefaultPort is the TCP port MQTT brokers listen on.
+	DefaultPort = 1883
+)
+
+// connackTimeout bounds the wait for the broker to accept the connection.
+var connackTimeout = 10 * time.Second
+
+// Packet types, shifted into the upper nibble of the fixed header.
+const (
+	typeConnect    byte = 1 << 4
+	typeConnack    byte = 2 << 4
+	typePublish    byte = 3 << 4
+	typeSubscribe  byte = 8<<4 | 0x02
+	typeSuback     byte = 9 << 4
+	typePingreq    byte = 12 << 4
+	typePingresp   byte = 13 << 4
+	typeDisconnect byte = 14 << 4
+
+	flagRetain byte = 0x01
+)
+
+// Connect flags.
+const (
+	flagCleanSession byte = 0x02
+	flagWill         byte = 0x04
+	flagWillRetain   byte = 0x20
+	flagPassword     byte = 0x40
+	flagUsername     byte = 0x80
+)
+
+var (
+	// ErrClosed is returned when using a client whose connection is closed.
+	ErrClosed = errors.New("connection closed")
+	// ErrPingTimeout is returned when the broker does not answer a ping within the keep alive interval.
+	ErrPingTimeout = errors.New("no ping response from broker")
+)
+
+// Message is a message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// Options configures the connection to the broker.
+type Options struct {
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is the maximum time between packets sent to the broker, pings being sent every half interval.
+	// The connection is lost when the broker does not answer a ping within the interval.
+	KeepAlive time.Duration
+	// Will is published by the broker when the connection is lost without disconnecting.
+	Will *Message
+}
+
+// Client is a connection to an MQTT broker.
+type Client struct {
+	conn    net.Conn
+	handler func(Message)
+	done    chan struct{}
+	pongs   chan struct{}
+
+	mu       sync.Mutex
+	packetID uint16
+	err      error
+}
+
+// Dial connects to the broker at addr and returns a Client delivering the messages of subscribed topics to handler.
+// The broker port defaults to DefaultPort.
+func Dial(ctx context.Context, addr string, opts Options, handler func(Message)) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, fmt.Sprint(DefaultPort))
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newClient(conn, opts, handler)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// newClient connects over conn and starts reading packets and pinging the broker.
+func newClient(conn net.Conn, opts Options, handler func(Message)) (*Client, error) {
+	// MQTT 3.1.1 only allows a password along with a user name, brokers refuse the connection otherwise.
+	if opts.Password != "" && opts.Username == "" {
+		return nil, errors.New("password requires a user name")
+	}
+	c := &Client{conn: conn, handler: handler, done: make(chan struct{}), pongs: make(chan struct{}, 1)}
+	if _, err := conn.Write(encodeConnect(opts)); err != nil {
+		return nil, err
+	}
+
+	// A broker accepting the TCP connection without answering must not block the client forever.
+	if err := conn.SetReadDeadline(time.Now().Add(connackTimeout)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	header, body, err := readPacket(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read connack: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if header&0xf0 != typeConnack || len(body) != 2 {
+		return nil, fmt.Errorf("unexpected packet %#x instead of connack", header)
+	}
+	if code := body[1]; code != 0 {
+		return nil, fmt.Errorf("connection refused: %s", connackError(code))
+	}
+
+	go c.read(r)
+	if opts.KeepAlive > 0 {
+		go c.ping(opts.KeepAlive)
+	}
+	return c, nil
+}
+
+// Publish publishes payload to topic at QoS 0, retained by the broker for new subscribers if retain is set.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	header := typePublish
+	if retain {
+		header |= flagRetain
+	}
+	body := appendString(nil, topic)
+	body = append(body, payload...)
+	return c.write(header, body)
+}
+
+// Subscribe subscribes to the topic filters at QoS 0, e.g. "hikari/+/set".
+func (c *Client) Subscribe(filters ...string) error {
+	c.mu.Lock()
+	c.packetID++
+	id := c.packetID
+	c.mu.Unlock()
+
+	body := []byte{byte(id >> 8), byte(id)}
+	for _, f := range filters {
+		body = appendString(body, f)
+		body = append(body, 0)
+	}
+	return c.write(typeSubscribe, body)
+}
+
+// Done is closed when the connection is lost or closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was lost, nil while connected.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close disconnects from the broker, which then discards the will.
+func (c *Client) Close() error {
+	c.write(typeDisconnect, nil)
+	c.fail(ErrClosed)
+	return c.conn.Close()
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	_, err := c.conn.Write(encodePacket(header, body))
+	return err
+}
+
+// read delivers published messages to the handler and ping responses to ping until the connection fails.
+func (c *Client) read(r *bufio.Reader) {
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		switch header & 0xf0 {
+		case typePingresp:
+			select {
+			case c.pongs <- struct{}{}:
+			default:
+			}
+		case typePublish:
+			msg, err := decodePublish(header, body)
+			if err != nil {
+				c.fail(err)
+				return
+			}
+			if c.handler != nil {
+				c.handler(msg)
+			}
+		}
+	}
+}
+
+// ping pings the broker every half keep alive interval, and closes the connection
+// when a ping is not answered within the interval, as a silent broker would otherwise go unnoticed.
+func (c *Client) ping(keepAlive time.Duration) {
+	ticker := time.NewTicker(keepAlive / 2)
+	defer ticker.Stop()
+	var timeout <-chan time.Time
+	for {
+		select {
+		case <-ticker.C:
+			if timeout != nil {
+				continue
+			}
+			if err := c.write(typePingreq, nil); err != nil {
+				return
+			}
+			timeout = time.After(keepAlive)
+		case <-c.pongs:
+			timeout = nil
+		case <-timeout:
+			c.fail(ErrPingTimeout)
+			c.conn.Close()
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// fail records the first error of the connection and signals that it is done.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+func encodeConnect(opts Options) []byte {
+	flags := flagCleanSession
+	body := appendString(nil, protocolName)
+	body = append(body, protocolLevel, 0)
+	keepAlive := uint16(opts.KeepAlive / time.Second)
+	body = append(body, byte(keepAlive>>8), byte(keepAlive))
+
+	payload := appendString(nil, opts.ClientID)
+	if opts.Will != nil {
+		flags |= flagWill
+		if opts.Will.Retain {
+			flags |= flagWillRetain
+		}
+		payload = appendString(payload, opts.Will.Topic)
+		payload = appendBytes(payload, opts.Will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= flagUsername
+		payload = appendString(payload, opts.Username)
+	}
+	if opts.Password != "" {
+		flags |= flagPassword
+		payload = appendString(payload, opts.Password)
+	}
+	body[len(protocolName)+3] = flags
+	return encodePacket(typeConnect, append(body, payload...))
+}
+
+func decodePublish(header byte, body []byte) (Message, error) {
+	if len(body) < 2 {
+		return Message{}, errors.New("malformed publish")
+	}
+	n := int(body[0])<<8 | int(body[1])
+	if len(body) < 2+n {
+		return Message{}, errors.New("malformed publish")
+	}
+	msg := Message{Topic: string(body[2 : 2+n]), Retain: header&flagRetain != 0}
+	rest := body[2+n:]
+	// Messages above QoS 0 carry a packet identifier.
+	if header&0x06 != 0 {
+		if len(rest) < 2 {
+			return Message{}, errors.New("malformed publish")
+		}
+		rest = rest[2:]
+	}
+	msg.Payload = rest
+	return msg, nil
+}
+
+// encodePacket returns a packet with the fixed header and the remaining length of body.
+func encodePacket(header byte, body []byte) []byte {
+	b := []byte{header}
+	b = appendRemainingLength(b, len(body))
+	return append(b, body...)
+}
+
+// readPacket reads the fixed header and body of the next packet.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := readRemainingLength(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+// appendRemainingLength appends n as a variable length integer of 7 bit groups.
+func appendRemainingLength(b []byte, n int) []byte {
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			return b
+		}
+	}
+}
+
+func readRemainingLength(r io.ByteReader) (int, error) {
+	var n, shift int
+	for i := 0; i < 4; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		n |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			return n, nil
+		}
+		shift += 7
+	}
+	return 0, errors.New("malformed remaining length")
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, v []byte) []byte {
+	b = append(b, byte(len(v)>>8), byte(len(v)))
+	return append(b, v...)
+}
+
+func connackError(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
@@ -0,0 +1,212 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRemainingLength(t *testing.T) {
+	testCases := map[string]struct {
+		n    int
+		want []byte
+	}{
+		"zero":       {n: 0, want: []byte{0x00}},
+		"one byte":   {n: 127, want: []byte{0x7f}},
+		"two bytes":  {n: 128, want: []byte{0x80, 0x01}},
+		"max two":    {n: 16383, want: []byte{0xff, 0x7f}},
+		"three byte": {n: 16384, want: []byte{0x80, 0x80, 0x01}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got := appendRemainingLength(nil, tc.n)
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("Encoded length does not match: got %x, want %x", got, tc.want)
+			}
+			n, err := readRemainingLength(bytes.NewReader(got))
+			if err != nil || n != tc.n {
+				t.Errorf("Decoded length does not match: got %d (%v), want %d", n, err, tc.n)
+			}
+		})
+	}
+}
+
+func TestClient(t *testing.T) {
+	conn, broker := net.Pipe()
+	defer broker.Close()
+	r := bufio.NewReader(broker)
+	received := make(chan Message, 1)
+
+	connected := make(chan *Client)
+	go func() {
+		c, err := newClient(conn, Options{
+			ClientID: "hikari",
+			Username: "user",
+			Password: "secret",
+			Will:     &Message{Topic: "hikari/status", Payload: []byte("offline"), Retain: true},
+		}, func(m Message) { received <- m })
+		if err != nil {
+			t.Error(err)
+		}
+		connected <- c
+	}()
+
+	header, body := readTestPacket(t, r)
+	if header != typeConnect {
+		t.Fatalf("Expected connect, got %#x", header)
+	}
+	if flags := body[7]; flags != flagCleanSession|flagWill|flagWillRetain|flagUsername|flagPassword {
+		t.Errorf("Connect flags do not match: got %08b", flags)
+	}
+	if !bytes.Contains(body, []byte("hikari/status")) || !bytes.HasSuffix(body, []byte("secret")) {
+		t.Errorf("Connect payload does not match: got %q", body)
+	}
+	broker.Write([]byte{typeConnack, 2, 0, 0})
+	c := <-connected
+	defer c.Close()
+
+	go c.Publish("hikari/d073d5000001/state", []byte(`{"state":"ON"}`), true)
+	header, body = readTestPacket(t, r)
+	if header != typePublish|flagRetain {
+		t.Errorf("Expected retained publish, got %#x", header)
+	}
+	if want := "\x00\x19hikari/d073d5000001/state{\"state\":\"ON\"}"; string(body) != want {
+		t.Errorf("Publish does not match: got %q, want %q", body, want)
+	}
+
+	go c.Subscribe("hikari/+/set")
+	header, body = readTestPacket(t, r)
+	if header != typeSubscribe {
+		t.Errorf("Expected subscribe, got %#x", header)
+	}
+	if want := "\x00\x01\x00\x0chikari/+/set\x00"; string(body) != want {
+		t.Errorf("Subscribe does not match: got %q, want %q", body, want)
+	}
+
+	broker.Write(encodePacket(typePublish, append(appendString(nil, "hikari/d073d5000001/set"), `{"state":"OFF"}`...)))
+	select {
+	case m := <-received:
+		if m.Topic != "hikari/d073d5000001/set" || string(m.Payload) != `{"state":"OFF"}` {
+			t.Errorf("Message does not match: got %s %s", m.Topic, m.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected message to be delivered")
+	}
+
+	broker.Close()
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Expected client to be done when the broker disconnects")
+	}
+	if c.Err() == nil {
+		t.Error("Expected connection error")
+	}
+}
+
+func TestClientRefused(t *testing.T) {
+	conn, broker := net.Pipe()
+	defer broker.Close()
+	go func() {
+		readTestPacket(t, bufio.NewReader(broker))
+		broker.Write([]byte{typeConnack, 2, 0, 5})
+	}()
+
+	_, err := newClient(conn, Options{ClientID: "hikari"}, nil)
+	if err == nil || err.Error() != "connection refused: not authorized" {
+		t.Errorf("Error does not match: got %v", err)
+	}
+}
+
+func TestClientPing(t *testing.T) {
+	testCases := map[string]struct {
+		answer   bool
+		wantDone bool
+	}{
+		"answered": {
+			answer: true,
+		},
+		"silent broker": {
+			wantDone: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conn, broker := net.Pipe()
+			defer broker.Close()
+			go func() {
+				r := bufio.NewReader(broker)
+				readPacket(r)
+				broker.Write([]byte{typeConnack, 2, 0, 0})
+				for {
+					header, _, err := readPacket(r)
+					if err != nil {
+						return
+					}
+					if header == typePingreq && tc.answer {
+						broker.Write([]byte{typePingresp, 0})
+					}
+				}
+			}()
+
+			c, err := newClient(conn, Options{ClientID: "hikari", KeepAlive: 40 * time.Millisecond}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			// Several keep alive intervals pass, the connection is lost after the first unanswered ping.
+			select {
+			case <-c.Done():
+				if !tc.wantDone {
+					t.Fatalf("Expected client to stay connected, got %v", c.Err())
+				}
+				if !errors.Is(c.Err(), ErrPingTimeout) {
+					t.Errorf("Error does not match: got %v, want %v", c.Err(), ErrPingTimeout)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tc.wantDone {
+					t.Fatal("Expected client to be done when pings are not answered")
+				}
+			}
+		})
+	}
+}
+
+func TestClientPasswordWithoutUsername(t *testing.T) {
+	conn, broker := net.Pipe()
+	defer broker.Close()
+	if _, err := newClient(conn, Options{ClientID: "hikari", Password: "secret"}, nil); err == nil {
+		t.Error("Expected a password without user name to be rejected")
+	}
+}
+
+func TestClientNoConnack(t *testing.T) {
+	timeout := connackTimeout
+	connackTimeout = 50 * time.Millisecond
+	defer func() { connackTimeout = timeout }()
+
+	conn, broker := net.Pipe()
+	defer broker.Close()
+	go readPacket(bufio.NewReader(broker))
+
+	_, err := newClient(conn, Options{ClientID: "hikari"}, nil)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Error does not match: got %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+}
+
+func readTestPacket(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	header, body, err := readPacket(r)
+	if err != nil {
+		t.Fatalf("Failed to read packet: %v", err)
+	}
+	return header, body
+}
@@ -0,0 +1,63 @@
+// Package testdevice holds the devices shared by the tests of hikari packages.
+// Tests copy and adjust them rather than defining their own devices.
+package testdevice
+
+import (
+	"net"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+var (
+	// Kitchen is a powered on bulb at full brightness.
+	Kitchen = ldevice.Device{
+		Serial:       ldevice.Serial{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x01},
+		Label:        "Kitchen",
+		Group:        "Downstairs",
+		Location:     "Home",
+		RegistryName: "LIFX A19",
+		PoweredOn:    true,
+		Color:        ldevice.Color{Brightness: 100, Kelvin: 3500},
+		Address:      &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+	}
+	// Lounge is a powered on bulb in another group than Kitchen.
+	Lounge = ldevice.Device{
+		Serial:       ldevice.Serial{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x02},
+		Label:        "Lounge",
+		Group:        "Living Room",
+		Location:     "Home",
+		RegistryName: "LIFX A19",
+		PoweredOn:    true,
+		Color:        ldevice.Color{Brightness: 100, Kelvin: 3500},
+		Address:      &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+	}
+	// Tiles is a powered off matrix device of five 8x8 tiles.
+	Tiles = ldevice.Device{
+		Serial:           ldevice.Serial{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x03},
+		Label:            "Tiles",
+		Group:            "Living Room",
+		Location:         "Home",
+		LightType:        ldevice.LightTypeMatrix,
+		MatrixProperties: ldevice.MatrixProperties{Width: 8, Height: 8, ChainLength: 5},
+		Address:          &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+	}
+	// Strip is a powered off strip, whose zones are set with controller.Fake.SetZones.
+	Strip = ldevice.Device{
+		Serial:   ldevice.Serial{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x04},
+		Label:    "Shelf",
+		Group:    "Living Room",
+		Location: "Home",
+		Address:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+	}
+	// Button is a switch, which has no light.
+	Button = ldevice.Device{
+		Serial:   ldevice.Serial{0xd0, 0x73, 0xd5, 0x00, 0x00, 0x05},
+		Label:    "Button",
+		Group:    "Downstairs",
+		Location: "Home",
+		Type:     ldevice.DeviceTypeSwitch,
+		Address:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)},
+	}
+	// Unknown is the serial of a device that was never discovered.
+	Unknown = ldevice.Serial{0xd0, 0x73, 0xd5, 0x00, 0x00, 0xff}
+)
@@ -0,0 +1,98 @@
+package keymap
+
+import (
+	"slices"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// Help is a set of bindings implementing help.KeyMap.
+type Help struct {
+	Short []key.Binding
+	Full  [][]key.Binding
+}
+
+func (h Help) ShortHelp() []key.Binding  { return h.Short }
+func (h Help) FullHelp() [][]key.Binding { return h.Full }
+
+// DeviceListHelp returns the help of the device list.
+func (k KeyMap) DeviceListHelp() Help {
+	d := k.DeviceList
+	return Help{
+		Short: []key.Binding{d.Select, d.Mark, d.Filter, k.Help, d.Quit},
+		Full: [][]key.Binding{
+			{d.Up, d.Down, d.Filter},
+			{d.Select, d.Mark, d.MarkAll},
+			{d.TreeView, d.Offline, d.Schedules, d.Info},
+			{k.Help, d.Quit},
+		},
+	}
+}
+
+// CommandListHelp returns the help of the command list.
+func (k KeyMap) CommandListHelp() Help {
+	c := k.CommandList
+	return Help{
+		Short: []key.Binding{c.Select, c.Send, c.Back, k.Help, c.Quit},
+		Full: [][]key.Binding{
+			{c.Up, c.Down},
+			{c.Select, c.Send, c.ForceSend},
+			{c.Pause, c.Cancel},
+			{c.Info, c.Back},
+			{k.Help, c.Quit},
+		},
+	}
+}
+
+// ParamListHelp returns the help of the param list.
+func (k KeyMap) ParamListHelp() Help {
+	p := k.ParamList
+	return Help{
+		Short: []key.Binding{p.Select, p.Send, p.Back, k.Help, p.Quit},
+		Full: [][]key.Binding{
+			{p.Up, p.Down},
+			{p.Select, p.Send, p.ForceSend},
+			{p.Back},
+			{k.Help, p.Quit},
+		},
+	}
+}
+
+// ScheduleListHelp returns the help of the schedule list.
+func (k KeyMap) ScheduleListHelp() Help {
+	s := k.ScheduleList
+	return Help{
+		Short: []key.Binding{s.Back, k.Help, s.Quit},
+		Full: [][]key.Binding{
+			{s.Back},
+			{k.Help, s.Quit},
+		},
+	}
+}
+
+// ParamEditHelp returns the help of param editing with the bindings of the current input.
+// Keys shadowed by the input, e.g. the matrix cursor keys, are left out.
+func (k KeyMap) ParamEditHelp(input []key.Binding) Help {
+	confirm := without(k.ParamEdit.Confirm, input)
+	cancel := without(k.ParamEdit.Cancel, input)
+	help := without(k.Help, input)
+	return Help{
+		Short: append(slices.Clone(input), confirm, cancel, help),
+		Full: [][]key.Binding{
+			input,
+			{confirm, cancel},
+			{help},
+		},
+	}
+}
+
+// without returns b without the keys matched by any of others.
+func without(b key.Binding, others []key.Binding) key.Binding {
+	var keys []string
+	for _, k := range b.Keys() {
+		if !slices.ContainsFunc(others, func(o key.Binding) bool { return slices.Contains(o.Keys(), k) }) {
+			keys = append(keys, k)
+		}
+	}
+	return newBinding(b.Help().Desc, keys...)
+}
@@ -0,0 +1,258 @@
+package keymap
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+// KeyMap holds the key bindings of every TUI state and of the param inputs.
+type KeyMap struct {
+	Help         key.Binding
+	DeviceList   DeviceListKeys
+	CommandList  CommandListKeys
+	ParamList    ParamListKeys
+	ParamEdit    ParamEditKeys
+	ScheduleList ScheduleListKeys
+	Input        InputKeys
+}
+
+// DeviceListKeys are the bindings of the device list.
+type DeviceListKeys struct {
+	Up, Down, Filter, Select, Mark, MarkAll, TreeView, Offline, Schedules, Info, Quit key.Binding
+}
+
+// CommandListKeys are the bindings of the command list.
+// ForceSend also sends to the targets known to be offline.
+// Pause toggles pausing the routines of the targets and Cancel stops them.
+type CommandListKeys struct {
+	Up, Down, Select, Send, ForceSend, Pause, Cancel, Info, Back, Quit key.Binding
+}
+
+// ParamListKeys are the bindings of the param list.
+type ParamListKeys struct {
+	Up, Down, Select, Send, ForceSend, Back, Quit key.Binding
+}
+
+// ParamEditKeys are the bindings used while editing a param, in addition to the input bindings.
+type ParamEditKeys struct {
+	Confirm, Cancel key.Binding
+}
+
+// ScheduleListKeys are the bindings of the schedule list.
+type ScheduleListKeys struct {
+	Back, Quit key.Binding
+}
+
+// InputKeys are the bindings of the select and matrix inputs.
+// While editing a param the bindings of the current input take precedence over ParamEditKeys.
+type InputKeys struct {
+	Up, Down, Left, Right, Toggle key.Binding
+}
+
+// Default returns the built-in keymap.
+func Default() KeyMap {
+	return KeyMap{
+		Help: newBinding("help", "?"),
+		DeviceList: DeviceListKeys{
+			Up:        newBinding("up", "up", "k"),
+			Down:      newBinding("down", "down", "j"),
+			Filter:    newBinding("filter", "/"),
+			Select:    newBinding("select", "enter", "e"),
+			Mark:      newBinding("mark", " "),
+			MarkAll:   newBinding("mark all", "a"),
+			TreeView:  newBinding("tree view", "g"),
+			Offline:   newBinding("offline", "o"),
+			Schedules: newBinding("schedules", "t"),
+			Info:      newBinding("info", "i"),
+			Quit:      newBinding("quit", "q"),
+		},
+		CommandList: CommandListKeys{
+			Up:        newBinding("up", "up", "k"),
+			Down:      newBinding("down", "down", "j"),
+			Select:    newBinding("edit", "enter", "e"),
+			Send:      newBinding("send", "s"),
+			ForceSend: newBinding("force send", "S"),
+			Pause:     newBinding("pause routine", "p"),
+			Cancel:    newBinding("cancel routine", "x"),
+			Info:      newBinding("info", "i"),
+			Back:      newBinding("back", "left", "h"),
+			Quit:      newBinding("quit", "q"),
+		},
+		ParamList: ParamListKeys{
+			Up:        newBinding("up", "up", "k"),
+			Down:      newBinding("down", "down", "j"),
+			Select:    newBinding("edit", "enter", "e"),
+			Send:      newBinding("send", "s"),
+			ForceSend: newBinding("force send", "S"),
+			Back:      newBinding("back", "left", "h"),
+			Quit:      newBinding("quit", "q"),
+		},
+		ParamEdit: ParamEditKeys{
+			Confirm: newBinding("confirm", "enter", "e"),
+			Cancel:  newBinding("cancel", "left", "h"),
+		},
+		ScheduleList: ScheduleListKeys{
+			Back: newBinding("back", "left", "h"),
+			Quit: newBinding("quit", "q"),
+		},
+		Input: InputKeys{
+			Up:     newBinding("up", "up", "k"),
+			Down:   newBinding("down", "down", "j"),
+			Left:   newBinding("left", "left", "h"),
+			Right:  newBinding("right", "right", "l"),
+			Toggle: newBinding("toggle", " ", "t"),
+		},
+	}
+}
+
+// New returns the default keymap with the keys of the given actions replaced,
+// e.g. {"device_list.quit": ["ctrl+q"]}. An empty list of keys disables the action.
+// It fails on unknown actions and on keys bound to more than one action of the same state.
+func New(overrides map[string][]string) (KeyMap, error) {
+	k := Default()
+	actions := k.actions()
+	for name, keys := range overrides {
+		i := slices.IndexFunc(actions, func(a action) bool { return a.name == name })
+		if i < 0 {
+			return k, fmt.Errorf("keys: unknown action %s", name)
+		}
+		keys = slices.Clone(keys)
+		for j, keyName := range keys {
+			if keyName == "space" {
+				keys[j] = " "
+			}
+		}
+		b := actions[i].binding
+		*b = newBinding(b.Help().Desc, keys...)
+	}
+	return k, k.conflicts()
+}
+
+type action struct {
+	name    string
+	binding *key.Binding
+}
+
+func (k *KeyMap) actions() []action {
+	return []action{
+		{"help", &k.Help},
+		{"device_list.up", &k.DeviceList.Up},
+		{"device_list.down", &k.DeviceList.Down},
+		{"device_list.filter", &k.DeviceList.Filter},
+		{"device_list.select", &k.DeviceList.Select},
+		{"device_list.mark", &k.DeviceList.Mark},
+		{"device_list.mark_all", &k.DeviceList.MarkAll},
+		{"device_list.tree_view", &k.DeviceList.TreeView},
+		{"device_list.offline", &k.DeviceList.Offline},
+		{"device_list.schedules", &k.DeviceList.Schedules},
+		{"device_list.info", &k.DeviceList.Info},
+		{"device_list.quit", &k.DeviceList.Quit},
+		{"command_list.up", &k.CommandList.Up},
+		{"command_list.down", &k.CommandList.Down},
+		{"command_list.select", &k.CommandList.Select},
+		{"command_list.send", &k.CommandList.Send},
+		{"command_list.force_send", &k.CommandList.ForceSend},
+		{"command_list.pause", &k.CommandList.Pause},
+		{"command_list.cancel", &k.CommandList.Cancel},
+		{"command_list.info", &k.CommandList.Info},
+		{"command_list.back", &k.CommandList.Back},
+		{"command_list.quit", &k.CommandList.Quit},
+		{"param_list.up", &k.ParamList.Up},
+		{"param_list.down", &k.ParamList.Down},
+		{"param_list.select", &k.ParamList.Select},
+		{"param_list.send", &k.ParamList.Send},
+		{"param_list.force_send", &k.ParamList.ForceSend},
+		{"param_list.back", &k.ParamList.Back},
+		{"param_list.quit", &k.ParamList.Quit},
+		{"param_edit.confirm", &k.ParamEdit.Confirm},
+		{"param_edit.cancel", &k.ParamEdit.Cancel},
+		{"schedule_list.back", &k.ScheduleList.Back},
+		{"schedule_list.quit", &k.ScheduleList.Quit},
+		{"input.up", &k.Input.Up},
+		{"input.down", &k.Input.Down},
+		{"input.left", &k.Input.Left},
+		{"input.right", &k.Input.Right},
+		{"input.toggle", &k.Input.Toggle},
+	}
+}
+
+// scopes returns the groups of actions that are active at the same time and must not share keys.
+func (k *KeyMap) scopes() [][]string {
+	deviceList, commandList, paramList := []string{"help"}, []string{"help"}, []string{"help"}
+	for _, a := range k.actions() {
+		switch {
+		case strings.HasPrefix(a.name, "device_list."):
+			deviceList = append(deviceList, a.name)
+		case strings.HasPrefix(a.name, "command_list."):
+			commandList = append(commandList, a.name)
+		case strings.HasPrefix(a.name, "param_list."):
+			paramList = append(paramList, a.name)
+		}
+	}
+	return [][]string{
+		deviceList,
+		commandList,
+		paramList,
+		{"help", "param_edit.confirm", "param_edit.cancel", "input.up", "input.down", "input.toggle"},
+		{"help", "param_edit.confirm", "input.up", "input.down", "input.left", "input.right", "input.toggle"},
+		{"help", "schedule_list.back", "schedule_list.quit"},
+	}
+}
+
+// conflicts reports keys bound to more than one action of the same scope.
+func (k *KeyMap) conflicts() error {
+	bindings := make(map[string]*key.Binding)
+	for _, a := range k.actions() {
+		bindings[a.name] = a.binding
+	}
+
+	var errs []error
+	reported := make(map[string]bool)
+	for _, scope := range k.scopes() {
+		owners := make(map[string]string)
+		for _, name := range scope {
+			for _, keyName := range bindings[name].Keys() {
+				owner, ok := owners[keyName]
+				if !ok {
+					owners[keyName] = name
+					continue
+				}
+				conflict := fmt.Sprintf("keys: %q is bound to both %s and %s", displayKey(keyName), owner, name)
+				if !reported[conflict] {
+					reported[conflict] = true
+					errs = append(errs, errors.New(conflict))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func newBinding(desc string, keys ...string) key.Binding {
+	help := make([]string, len(keys))
+	for i, k := range keys {
+		help[i] = displayKey(k)
+	}
+	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(strings.Join(help, "/"), desc))
+}
+
+// displayKey returns the name of a key as shown in help.
+func displayKey(k string) string {
+	switch k {
+	case " ":
+		return "space"
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	case "left":
+		return "←"
+	case "right":
+		return "→"
+	}
+	return k
+}
@@ -0,0 +1,116 @@
+package keymap
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/key"
+)
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		overrides map[string][]string
+		action    string
+		wantKeys  []string
+		wantHelp  string
+		wantErr   bool
+	}{
+		"defaults": {
+			action:   "device_list.mark",
+			wantKeys: []string{" "},
+			wantHelp: "space",
+		},
+		"remapped action": {
+			overrides: map[string][]string{"device_list.quit": {"ctrl+q", "esc"}},
+			action:    "device_list.quit",
+			wantKeys:  []string{"ctrl+q", "esc"},
+			wantHelp:  "ctrl+q/esc",
+		},
+		"space alias": {
+			overrides: map[string][]string{"input.toggle": {"space"}},
+			action:    "input.toggle",
+			wantKeys:  []string{" "},
+			wantHelp:  "space",
+		},
+		"same key in different states": {
+			overrides: map[string][]string{"command_list.send": {"g"}},
+			action:    "command_list.send",
+			wantKeys:  []string{"g"},
+			wantHelp:  "g",
+		},
+		"matrix left shares cancel keys": {
+			overrides: map[string][]string{"param_edit.cancel": {"left", "h"}},
+			action:    "param_edit.cancel",
+			wantKeys:  []string{"left", "h"},
+			wantHelp:  "←/h",
+		},
+		"unknown action": {
+			overrides: map[string][]string{"device_list.explode": {"x"}},
+			wantErr:   true,
+		},
+		"conflict in the same state": {
+			overrides: map[string][]string{"device_list.tree_view": {"a"}},
+			wantErr:   true,
+		},
+		"conflict between edit and input keys": {
+			overrides: map[string][]string{"param_edit.confirm": {"t"}},
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			k, err := New(tc.overrides)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			i := slices.IndexFunc(k.actions(), func(a action) bool { return a.name == tc.action })
+			b := k.actions()[i].binding
+			if !slices.Equal(b.Keys(), tc.wantKeys) {
+				t.Errorf("Keys do not match: got %q, want %q", b.Keys(), tc.wantKeys)
+			}
+			if b.Help().Key != tc.wantHelp {
+				t.Errorf("Help does not match: got %q, want %q", b.Help().Key, tc.wantHelp)
+			}
+		})
+	}
+}
+
+func TestParamEditHelp(t *testing.T) {
+	k := Default()
+	testCases := map[string]struct {
+		input      []key.Binding
+		wantCancel []string
+	}{
+		"text input": {
+			wantCancel: []string{"left", "h"},
+		},
+		"select input": {
+			input:      []key.Binding{k.Input.Up, k.Input.Down},
+			wantCancel: []string{"left", "h"},
+		},
+		"matrix input shadows cancel": {
+			input: []key.Binding{k.Input.Up, k.Input.Down, k.Input.Left, k.Input.Right, k.Input.Toggle},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h := k.ParamEditHelp(tc.input)
+			cancel := h.Full[1][1]
+			if !slices.Equal(cancel.Keys(), tc.wantCancel) {
+				t.Errorf("Cancel keys do not match: got %q, want %q", cancel.Keys(), tc.wantCancel)
+			}
+			if cancel.Enabled() != (len(tc.wantCancel) > 0) {
+				t.Errorf("Cancel enabled does not match: got %v", cancel.Enabled())
+			}
+		})
+	}
+}
@@ -1,54 +1,46 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"maps"
 	"os"
 	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"text/tabwriter"
 	"time"
 
+	"github.com/alessio-palumbo/hikari/cmd/hikari/cli"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/firmware"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/input"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/version"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/keymap"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/multizone"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/routine"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/schedule"
 	"github.com/alessio-palumbo/hikari/cmd/hikari/style"
-	ctrl "github.com/alessio-palumbo/lifxlan-go/pkg/controller"
 	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
 	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
-const (
-	defaultDeviceRefreshPeriod = 2 * time.Second
-	defaultSendMessageSpinner  = 300 * time.Millisecond
-	listWidth                  = 40
-)
-
-const (
-	mappingQuit      = "q"
-	mappingInfo      = "i"
-	mappingSelect    = "enter"
-	mappingSelectAlt = "e"
-	mappingBack      = "left"
-	mappingBackAlt   = "h"
-	mappingSend      = "s"
-)
-
-var (
-	filterExcludedBindings = []string{
-		mappingQuit,
-		mappingInfo,
-		mappingSelect,
-		mappingSelectAlt,
-		mappingBack,
-		mappingBackAlt,
-		mappingSend,
-	}
-)
+// scheduleTimeFormat is the format of the times of the schedule list.
+const scheduleTimeFormat = "Mon 2 Jan 15:04"
 
 type state int
 
@@ -57,20 +49,50 @@ const (
 	stateCommandList
 	stateParamList
 	stateParamEdit
+	stateScheduleList
 	stateError
 )
 
 // Bubble Tea messages
 type deviceUpdateMsg []ldevice.Device
-type msgSendDone struct{}
+type msgSendDone []sendResult
+type verifyDoneMsg []sendResult
 type effectStopDone struct{}
 type tickMsg time.Time
 
+// infoMsg carries the zone colors and the firmware effect read from a device.
+type infoMsg struct {
+	serial    ldevice.Serial
+	zones     []packets.LightHsbk
+	zonesErr  error
+	effect    firmware.Effect
+	effectErr error
+}
+
+// sendResult is the outcome of sending a command to a single device.
+type sendResult struct {
+	device device.Item
+	err    error
+}
+
 type model struct {
+	cfg                config.Config
+	keys               keymap.KeyMap
+	help               help.Model
+	showHelp           bool
 	state              state
-	deviceManager      *ctrl.Controller
+	deviceManager      controller.Controller
+	health             device.HealthFunc
+	hideOffline        bool
+	force              bool
+	retryPolicy        controller.RetryPolicy
+	devices            []ldevice.Device
 	deviceList         list.Model
+	treeView           bool
 	selectedDevice     device.Item
+	selectedGroup      *device.GroupItem
+	markedDevices      device.Selection
+	targets            []device.Item
 	showDeviceInfo     bool
 	commandList        list.Model
 	selectedCommand    command.Item
@@ -80,26 +102,67 @@ type model struct {
 	lastUpdate         time.Time
 	spinner            spinner.Model
 	sending, stopping  bool
+	sendResults        []sendResult
+	pendingVerify      *controller.Expectation
+	pendingDone        func() error // completes a device command once it ran on every target
+	verifying          bool
+	verifyResults      []sendResult
+	mismatches         map[ldevice.Serial]error
 	effectStoppers     map[ldevice.Serial]*atomic.Bool
+	scheduler          *schedule.Scheduler
+	scheduleErr        error
+	schedules          []schedule.Status
+	routines           *routine.Runner
+	zones              map[ldevice.Serial][]packets.LightHsbk // nil for devices without zones
+	effects            map[ldevice.Serial]firmware.Effect
+	clock              func() time.Time
 }
 
-func initialModel() model {
-	c, err := ctrl.New()
-	if err != nil {
-		log.Fatal(err)
-	}
+func initialModel(cfg config.Config, keys keymap.KeyMap, dm controller.Controller, scheduler *schedule.Scheduler, routines *routine.Runner) model {
+	h := help.New()
+	h.Styles.ShortKey = style.HelpKey
+	h.Styles.ShortDesc = style.Help
+	h.Styles.ShortSeparator = style.Help
+	h.Styles.FullKey = style.HelpKey
+	h.Styles.FullDesc = style.Help
+	h.Styles.FullSeparator = style.Help
+
 	s := spinner.New()
 	s.Spinner = spinner.Points
 	s.Style = style.Spinner
 
+	devices := dm.GetDevices()
+	markedDevices := make(device.Selection)
+	var health device.HealthFunc
+	if hr, ok := dm.(controller.HealthReporter); ok {
+		health = hr.Health
+	}
+
+	deviceList := withListKeys(device.NewList(devices, markedDevices, health), keys.DeviceList.Up, keys.DeviceList.Down, keys.DeviceList.Quit)
+	deviceList.KeyMap.Filter = keys.DeviceList.Filter
+	commandList := withListKeys(command.NewList(), keys.CommandList.Up, keys.CommandList.Down, keys.CommandList.Quit)
+
 	return model{
+		cfg:            cfg,
+		keys:           keys,
+		help:           h,
 		state:          stateDeviceList,
-		deviceManager:  c,
-		deviceList:     device.NewList(c.GetDevices()),
-		commandList:    command.NewList(),
+		deviceManager:  dm,
+		health:         health,
+		retryPolicy:    controller.PolicyFrom(cfg),
+		devices:        devices,
+		deviceList:     deviceList,
+		markedDevices:  markedDevices,
+		commandList:    commandList,
 		lastUpdate:     time.Now(),
 		spinner:        s,
 		effectStoppers: make(map[ldevice.Serial]*atomic.Bool),
+		mismatches:     make(map[ldevice.Serial]error),
+		scheduler:      scheduler,
+		routines:       routines,
+		zones:          make(map[ldevice.Serial][]packets.LightHsbk),
+		effects:        make(map[ldevice.Serial]firmware.Effect),
+		clock:          time.Now,
 	}
 }
 
@@ -110,8 +173,17 @@ func (m model) Init() tea.Cmd {
 	)
 }
 
-func shouldSkipBindingOnFilter(l list.Model, keypress string) bool {
-	return l.FilterState() == list.Filtering && slices.Contains(filterExcludedBindings, keypress)
+// shouldSkipBindingOnFilter reports whether key presses should go to the list filter rather than to the keymap.
+func shouldSkipBindingOnFilter(l list.Model) bool {
+	return l.FilterState() == list.Filtering
+}
+
+// withListKeys applies the navigation and quit bindings of the keymap to a list.
+func withListKeys(l list.Model, up, down, quit key.Binding) list.Model {
+	l.KeyMap.CursorUp = up
+	l.KeyMap.CursorDown = down
+	l.KeyMap.Quit = quit
+	return l
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -121,73 +193,115 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case list.FilterMatchesMsg:
 		m.deviceList, cmd = m.deviceList.Update(msg)
 	case tea.KeyMsg:
+		if m.isHelpKey(msg) {
+			m.showHelp = !m.showHelp
+			return m, nil
+		}
+
 		switch m.state {
 		case stateDeviceList:
-			if shouldSkipBindingOnFilter(m.deviceList, msg.String()) {
+			if shouldSkipBindingOnFilter(m.deviceList) {
 				m.deviceList, cmd = m.deviceList.Update(msg)
 				return m, cmd
 			}
-			switch msg.String() {
-			case mappingSelect, mappingSelectAlt:
-				if selectedDevice, ok := m.deviceList.SelectedItem().(device.Item); ok {
-					m.selectedDevice = selectedDevice
+			switch {
+			case key.Matches(msg, m.keys.DeviceList.Select):
+				switch item := m.deviceList.SelectedItem().(type) {
+				case device.Item:
+					m.selectedDevice = item
+					m.selectedGroup = nil
+					m.targets = m.selectTargets()
+					m.sendResults = nil
+					m.state = stateCommandList
+				case device.GroupItem:
+					m.selectedDevice = device.Item{}
+					m.selectedGroup = &item
+					m.targets = item.Members
+					m.sendResults = nil
 					m.state = stateCommandList
 				}
-			case mappingInfo:
+			case key.Matches(msg, m.keys.DeviceList.Mark):
+				switch item := m.deviceList.SelectedItem().(type) {
+				case device.Item:
+					m.markedDevices.Toggle(item.Serial)
+				case device.GroupItem:
+					m.markedDevices.ToggleAll(item.ListItems())
+				}
+			case key.Matches(msg, m.keys.DeviceList.MarkAll):
+				m.markedDevices.ToggleAll(m.deviceList.VisibleItems())
+			case key.Matches(msg, m.keys.DeviceList.TreeView):
+				m.treeView = !m.treeView
+				cmd = m.updateDeviceList(m.devices)
+			case key.Matches(msg, m.keys.DeviceList.Offline):
+				m.hideOffline = !m.hideOffline
+				cmd = m.updateDeviceList(m.devices)
+			case key.Matches(msg, m.keys.DeviceList.Schedules):
+				m.refreshSchedules()
+				m.state = stateScheduleList
+			case key.Matches(msg, m.keys.DeviceList.Info):
 				m.showDeviceInfo = !m.showDeviceInfo
-			case mappingQuit:
+				cmd = m.fetchInfo()
+			case key.Matches(msg, m.keys.DeviceList.Quit):
 				return m, tea.Quit
 			default:
 				m.deviceList, cmd = m.deviceList.Update(msg)
 			}
 
 		case stateCommandList:
-			switch msg.String() {
-			case mappingSend:
+			switch {
+			case key.Matches(msg, m.keys.CommandList.Send, m.keys.CommandList.ForceSend):
 				if commandItem, ok := m.commandList.SelectedItem().(command.Item); ok {
 					m.selectedCommand = commandItem
+					m.force = key.Matches(msg, m.keys.CommandList.ForceSend)
 
 					switch m.selectedCommand.ID {
 					case "power_on", "power_off":
-						message, _ := m.selectedCommand.Handler()
-						m.deviceManager.Send(m.selectedDevice.Serial, message)
-						return m.sendMessageSpinner()
+						return m.sendToTargets(m.sendMessage(m.selectedCommand.Handler), m.expectation())
+					case "stop_firmware_effect":
+						run, _, _ := m.selectedCommand.DeviceHandler(m.deviceManager, m.deliver)
+						return m.sendToTargets(func(t device.Item) error {
+							return run(ldevice.Device(t))
+						}, nil)
 					}
 				}
-			case mappingSelect, mappingSelectAlt:
+			case key.Matches(msg, m.keys.CommandList.Select):
 				if commandItem, ok := m.commandList.SelectedItem().(command.Item); ok {
 					m.selectedCommand = commandItem
 
 					switch m.selectedCommand.ID {
-					case "set_color", "set_brightness", "set_pixels":
-						m.paramList = m.selectedCommand.NewParams()
+					case "set_color", "set_brightness", "waveform", "set_pixels", "set_zones", "zone_gradient", "firmware_effect", "save_scene", "recall_scene", "routine":
+						m.paramList = m.newParamList()
 						m.state = stateParamList
 						return m, nil
 					default:
 						if m.selectedCommand.Type == command.CommandTypeEffect {
-							if v, ok := m.effectStoppers[m.selectedDevice.Serial]; ok {
-								v.Store(true)
-								delete(m.effectStoppers, m.selectedDevice.Serial)
+							if m.stopTargetEffects() {
 								return m.stopEffectSpinner()
 							}
-							m.paramList = m.selectedCommand.NewParams()
+							m.paramList = m.newParamList()
 							m.state = stateParamList
 							return m, nil
 						}
 					}
 				}
-			case mappingInfo:
+			case key.Matches(msg, m.keys.CommandList.Pause):
+				m.toggleTargetRoutines()
+			case key.Matches(msg, m.keys.CommandList.Cancel):
+				m.cancelTargetRoutines()
+			case key.Matches(msg, m.keys.CommandList.Info):
 				m.showDeviceInfo = !m.showDeviceInfo
-			case mappingBack, mappingBackAlt:
+				cmd = m.fetchInfo()
+			case key.Matches(msg, m.keys.CommandList.Back):
+				m.sendResults = nil
 				m.state = stateDeviceList
-			case mappingQuit:
+			case key.Matches(msg, m.keys.CommandList.Quit):
 				return m, tea.Quit
 			default:
 				m.commandList, cmd = m.commandList.Update(msg)
 			}
 
 		case stateParamList:
-			if shouldSkipBindingOnFilter(m.paramList, msg.String()) {
+			if shouldSkipBindingOnFilter(m.paramList) {
 				m.paramList, cmd = m.paramList.Update(msg)
 				return m, cmd
 			}
@@ -195,38 +309,50 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			paramIndex := m.paramList.GlobalIndex()
 			paramItem := m.paramList.Items()[paramIndex].(command.ParamItem)
 
-			switch msg.String() {
-			case mappingSelect, mappingSelectAlt:
-				paramItem.SetEdit(true, m.selectedDevice.MatrixProperties)
+			switch {
+			case key.Matches(msg, m.keys.ParamList.Select):
+				paramItem.SetEdit(true, m.matrixProperties())
 				m.paramList.SetItem(paramIndex, paramItem)
 				m.state = stateParamEdit
-			case mappingSend:
+			case key.Matches(msg, m.keys.ParamList.Send, m.keys.ParamList.ForceSend):
+				m.force = key.Matches(msg, m.keys.ParamList.ForceSend)
+				params := command.ParamItemsFromModel(m.paramList)
 				switch m.selectedCommand.Type {
 				case command.CommandTypeEffect:
-					mProps := m.selectedDevice.MatrixProperties
-					send := func(msg *protocol.Message) error {
-						return m.deviceManager.Send(m.selectedDevice.Serial, msg)
+					return m.startTargetEffects(params)
+				case command.CommandTypeRoutine:
+					ramp, err := m.selectedCommand.RoutineHandler(params...)
+					if err != nil {
+						m.errMessage = err.Error()
+						return m, nil
 					}
-					stopped, err := m.selectedCommand.StartMatrixEffect(mProps, send, command.ParamItemsFromModel(m.paramList)...)
+					return m.sendToTargets(func(t device.Item) error {
+						return m.routines.Start(ldevice.Device(t), ramp)
+					}, nil)
+				case command.CommandTypeScene, command.CommandTypeZones, command.CommandTypeFirmware:
+					run, done, err := m.selectedCommand.DeviceHandler(m.deviceManager, m.deliver, params...)
 					if err != nil {
 						m.errMessage = err.Error()
 						return m, nil
 					}
-					m.effectStoppers[m.selectedDevice.Serial] = stopped
+					m.pendingDone = done
+					return m.sendToTargets(func(t device.Item) error {
+						return run(ldevice.Device(t))
+					}, nil)
 				default:
-					message, err := m.selectedCommand.Handler(command.ParamItemsFromModel(m.paramList)...)
-					if err != nil {
+					if _, err := m.selectedCommand.Handler(params...); err != nil {
 						m.errMessage = err.Error()
 						return m, nil
 					}
-					m.deviceManager.Send(m.selectedDevice.Serial, message)
+					return m.sendToTargets(m.sendMessage(func(...command.ParamItem) (*protocol.Message, error) {
+						return m.selectedCommand.Handler(params...)
+					}), m.expectation(params...))
 				}
-				return m.sendMessageSpinner()
-			case mappingBack, mappingBackAlt:
+			case key.Matches(msg, m.keys.ParamList.Back):
 				paramItem.SetEdit(false)
 				m.paramList.SetItem(paramIndex, paramItem)
 				m.state = stateCommandList
-			case mappingQuit:
+			case key.Matches(msg, m.keys.ParamList.Quit):
 				return m, tea.Quit
 			default:
 				m.paramList, cmd = m.paramList.Update(msg)
@@ -236,8 +362,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			paramIndex := m.paramList.GlobalIndex()
 			paramItem := m.paramList.Items()[paramIndex].(command.ParamItem)
 
-			switch msg.String() {
-			case mappingSelect, mappingSelectAlt:
+			switch {
+			// Input keys take precedence, e.g. matrix input requires directional keys
+			// and text input requires letters, which are only confirmed or cancelled by non-letter keys.
+			case typesText(paramItem, msg), key.Matches(msg, input.Bindings(paramItem.InputType)...):
+				paramItem.UpdateValue(msg)
+			case key.Matches(msg, m.keys.ParamEdit.Confirm):
 				if err := paramItem.SetValue(); err != nil {
 					m.errMessage = err.Error()
 					return m, nil
@@ -245,13 +375,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				paramItem.SetEdit(false)
 				m.errMessage = ""
 				m.state = stateParamList
-			case mappingBack, mappingBackAlt:
-				// Special handling for matrix input which requires directional keys.
-				if paramItem.InputType == input.InputMatrixSelect {
-					paramItem.UpdateValue(msg)
-					break
-				}
-
+			case key.Matches(msg, m.keys.ParamEdit.Cancel):
 				paramItem.Input = paramItem.Input.Reset()
 				_ = paramItem.SetValue()
 				paramItem.SetEdit(false)
@@ -261,11 +385,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				paramItem.UpdateValue(msg)
 			}
 			m.paramList.SetItem(paramIndex, paramItem)
+
+		case stateScheduleList:
+			switch {
+			case key.Matches(msg, m.keys.ScheduleList.Back):
+				m.errMessage = ""
+				m.state = stateDeviceList
+			case key.Matches(msg, m.keys.ScheduleList.Quit):
+				return m, tea.Quit
+			}
 		}
 
 	case tea.WindowSizeMsg:
 		m.deviceList.SetWidth(msg.Width)
-		m.deviceList.SetHeight(msg.Height - 4)
+		m.deviceList.SetHeight(msg.Height - 5)
+		m.help.Width = msg.Width
 
 	case deviceUpdateMsg:
 		cmd = m.updateDeviceList([]ldevice.Device(msg))
@@ -273,7 +407,33 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case msgSendDone:
 		m.sending = false
+		m.sendResults = msg
 		m.state = stateCommandList
+		if m.pendingVerify != nil {
+			cmd = m.verifyTargets(msg, *m.pendingVerify)
+			m.pendingVerify = nil
+			m.verifying = true
+		}
+		if m.pendingDone != nil {
+			if err := m.pendingDone(); err != nil {
+				m.errMessage = err.Error()
+			}
+			m.pendingDone = nil
+		}
+		if m.selectedCommand.Type == command.CommandTypeZones || m.selectedCommand.Type == command.CommandTypeFirmware {
+			cmd = tea.Batch(cmd, m.fetchInfo())
+		}
+
+	case verifyDoneMsg:
+		m.verifying = false
+		m.verifyResults = msg
+		for _, r := range msg {
+			if r.err != nil {
+				m.mismatches[r.device.Serial] = r.err
+			} else {
+				delete(m.mismatches, r.device.Serial)
+			}
+		}
 
 	case effectStopDone:
 		m.stopping = false
@@ -282,11 +442,31 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tickMsg:
 		switch {
 		case m.state == stateDeviceList:
-			return m, tea.Batch(m.refreshDevices(), m.tick())
-		case time.Since(m.lastUpdate) > 5*time.Second:
-			return m, tea.Batch(m.refreshDevices(), m.tick())
-		default:
+			return m, tea.Batch(m.refreshDevices(), m.tick(), m.fetchInfo())
+		case m.state == stateScheduleList:
+			m.refreshSchedules()
 			return m, m.tick()
+		case time.Since(m.lastUpdate) > m.cfg.StaleThreshold.Std():
+			return m, tea.Batch(m.refreshDevices(), m.tick(), m.fetchInfo())
+		default:
+			return m, tea.Batch(m.tick(), m.fetchInfo())
+		}
+
+	case infoMsg:
+		switch {
+		case errors.Is(msg.zonesErr, controller.ErrUnhandled):
+			m.zones[msg.serial] = nil
+		case errors.Is(msg.zonesErr, context.DeadlineExceeded) && m.zones[msg.serial] == nil:
+			// Online bulbs that ignore unhandled messages time out instead, keep strips that replied before.
+			m.zones[msg.serial] = nil
+		case msg.zonesErr == nil:
+			m.zones[msg.serial] = msg.zones
+		}
+		switch {
+		case errors.Is(msg.effectErr, controller.ErrUnhandled):
+			delete(m.effects, msg.serial)
+		case msg.effectErr == nil:
+			m.effects[msg.serial] = msg.effect
 		}
 
 	case spinner.TickMsg:
@@ -304,53 +484,371 @@ func (m model) refreshDevices() tea.Cmd {
 	}
 }
 
+// fetchInfo reads the zone colors and the firmware effect of the device shown in the info panel,
+// unless it is offline or known to have no zones. Matrix devices only have firmware effects.
+func (m model) fetchInfo() tea.Cmd {
+	d := m.infoDevice()
+	if !m.showDeviceInfo || d == nil || d.Type == ldevice.DeviceTypeSwitch || device.Offline(m.health, d.Serial) {
+		return nil
+	}
+	matrix := d.LightType == ldevice.LightTypeMatrix
+	if zones, ok := m.zones[d.Serial]; ok && zones == nil && !matrix {
+		return nil
+	}
+	dm, target, timeout := m.deviceManager, ldevice.Device(*d), m.retryPolicy.Timeout
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		msg := infoMsg{serial: target.Serial}
+		if !matrix {
+			if msg.zones, msg.zonesErr = multizone.Get(ctx, dm, target.Serial); msg.zonesErr != nil {
+				msg.effectErr = msg.zonesErr
+				return msg
+			}
+		}
+		msg.effect, msg.effectErr = firmware.Get(ctx, dm, target)
+		return msg
+	}
+}
+
+// infoDevice returns the device the info panel is about, the single target of the commands when not in the device list,
+// nil when a group or several devices are targeted.
+func (m model) infoDevice() *device.Item {
+	switch m.state {
+	case stateDeviceList:
+		if deviceItem, ok := m.deviceList.SelectedItem().(device.Item); ok {
+			return &deviceItem
+		}
+	case stateCommandList:
+		if m.selectedGroup == nil && len(m.targets) == 1 {
+			return &m.targets[0]
+		}
+	}
+	return nil
+}
+
 // Command for periodic updates
 func (m model) tick() tea.Cmd {
-	return tea.Tick(defaultDeviceRefreshPeriod, func(t time.Time) tea.Msg {
+	return tea.Tick(m.cfg.DeviceRefreshPeriod.Std(), func(t time.Time) tea.Msg {
 		return tickMsg(t)
 	})
 }
 
-func (m model) sendMessageSpinner() (model, tea.Cmd) {
+// isHelpKey reports whether msg toggles the help, unless it is typed into a filter or used by the current input.
+func (m model) isHelpKey(msg tea.KeyMsg) bool {
+	switch m.state {
+	case stateDeviceList:
+		if shouldSkipBindingOnFilter(m.deviceList) {
+			return false
+		}
+	case stateParamList:
+		if shouldSkipBindingOnFilter(m.paramList) {
+			return false
+		}
+	case stateParamEdit:
+		if typesText(m.selectedParam(), msg) || key.Matches(msg, input.Bindings(m.selectedParam().InputType)...) {
+			return false
+		}
+	}
+	return key.Matches(msg, m.keys.Help)
+}
+
+// typesText reports whether msg types characters into the text input of the param.
+func typesText(p command.ParamItem, msg tea.KeyMsg) bool {
+	return p.InputType == input.InputText && (msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace)
+}
+
+// helpKeys returns the bindings valid in the current state and input.
+func (m model) helpKeys() keymap.Help {
+	switch m.state {
+	case stateCommandList:
+		return m.keys.CommandListHelp()
+	case stateParamList:
+		return m.keys.ParamListHelp()
+	case stateParamEdit:
+		return m.keys.ParamEditHelp(input.Bindings(m.selectedParam().InputType))
+	case stateScheduleList:
+		return m.keys.ScheduleListHelp()
+	}
+	return m.keys.DeviceListHelp()
+}
+
+// selectedParam returns the param under the cursor of the param list.
+func (m model) selectedParam() command.ParamItem {
+	return m.paramList.Items()[m.paramList.GlobalIndex()].(command.ParamItem)
+}
+
+// newParamList returns the param list of the selected command using the keymap.
+func (m model) newParamList() list.Model {
+	return withListKeys(m.selectedCommand.NewParams(), m.keys.ParamList.Up, m.keys.ParamList.Down, m.keys.ParamList.Quit)
+}
+
+// selectTargets returns the marked devices, or the selected device if none is marked.
+func (m model) selectTargets() []device.Item {
+	if len(m.markedDevices) == 0 {
+		return []device.Item{m.selectedDevice}
+	}
+	var targets []device.Item
+	for _, d := range m.devices {
+		if m.markedDevices[d.Serial] {
+			targets = append(targets, device.Item(d))
+		}
+	}
+	return targets
+}
+
+// matrixProperties returns the matrix properties of the first matrix target,
+// falling back to the selected device.
+func (m model) matrixProperties() ldevice.MatrixProperties {
+	for _, t := range m.targets {
+		if t.LightType == ldevice.LightTypeMatrix {
+			return t.MatrixProperties
+		}
+	}
+	return m.selectedDevice.MatrixProperties
+}
+
+// sendMessage returns a send function delivering the message built by handler to a device.
+func (m model) sendMessage(handler func(...command.ParamItem) (*protocol.Message, error)) func(device.Item) error {
+	return func(t device.Item) error {
+		message, err := handler()
+		if err != nil {
+			return err
+		}
+		return m.deliver(t.Serial, message)
+	}
+}
+
+// deliver sends msg to the device and waits for its acknowledgement, retrying according to the config.
+func (m model) deliver(serial ldevice.Serial, msg *protocol.Message) error {
+	return controller.Deliver(context.Background(), m.deviceManager, serial, m.retryPolicy, msg)
+}
+
+// expectation returns the state to verify once the selected command is delivered,
+// nil if verification is disabled or not supported by the command.
+func (m model) expectation(params ...command.ParamItem) *controller.Expectation {
+	if !m.cfg.Verify || m.selectedCommand.Expect == nil {
+		return nil
+	}
+	e := m.selectedCommand.Expect(params...)
+	if e.IsZero() {
+		return nil
+	}
+	return &e
+}
+
+// sendToTargets runs send for all targets concurrently and reports the per-device results once all sends are done.
+// When expect is not nil, the state of the devices is verified once delivered.
+func (m model) sendToTargets(send func(device.Item) error, expect *controller.Expectation) (model, tea.Cmd) {
+	m.sending = true
+	m.sendResults = nil
+	m.verifyResults = nil
+	m.pendingVerify = expect
+	targets := m.targets
+	skip := m.skipOffline()
+
+	return m, tea.Batch(
+		m.spinner.Tick,
+		func() tea.Msg {
+			results := make([]sendResult, len(targets))
+			var wg sync.WaitGroup
+			for i, t := range targets {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if skip(t) {
+						results[i] = sendResult{device: t, err: controller.ErrOffline}
+						return
+					}
+					results[i] = sendResult{device: t, err: send(t)}
+				}()
+			}
+			wg.Wait()
+			return msgSendDone(results)
+		},
+	)
+}
+
+// skipOffline returns whether a target is not sent to because it is known to be offline, unless sending is forced.
+func (m model) skipOffline() func(device.Item) bool {
+	force, health := m.force, m.health
+	return func(t device.Item) bool {
+		return !force && device.Offline(health, t.Serial)
+	}
+}
+
+// verifyTargets reads back the state of the devices the command was delivered to
+// once the transition is over, and reports the per-device mismatches.
+func (m model) verifyTargets(results []sendResult, expect controller.Expectation) tea.Cmd {
+	dm := m.deviceManager
+	timeout := expect.Transition + m.retryPolicy.Timeout
+
+	return tea.Batch(
+		m.spinner.Tick,
+		func() tea.Msg {
+			var verified []sendResult
+			for _, r := range results {
+				if r.err == nil {
+					verified = append(verified, sendResult{device: r.device})
+				}
+			}
+			var wg sync.WaitGroup
+			for i := range verified {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					ctx, cancel := context.WithTimeout(context.Background(), timeout)
+					defer cancel()
+					verified[i].err = controller.Verify(ctx, dm, verified[i].device.Serial, expect)
+				}()
+			}
+			wg.Wait()
+			return verifyDoneMsg(verified)
+		},
+	)
+}
+
+// startTargetEffects starts the selected effect on all targets.
+func (m model) startTargetEffects(params []command.ParamItem) (model, tea.Cmd) {
+	results := make([]sendResult, len(m.targets))
+	skip := m.skipOffline()
+	for i, t := range m.targets {
+		results[i] = sendResult{device: t}
+		if t.LightType != ldevice.LightTypeMatrix {
+			results[i].err = fmt.Errorf("not a matrix device")
+			continue
+		}
+		if skip(t) {
+			results[i].err = controller.ErrOffline
+			continue
+		}
+
+		send := func(msg *protocol.Message) error {
+			return m.deviceManager.Send(t.Serial, msg)
+		}
+		stopped, err := m.selectedCommand.StartMatrixEffect(t.MatrixProperties, send, params...)
+		if err != nil {
+			m.errMessage = err.Error()
+			return m, nil
+		}
+		m.effectStoppers[t.Serial] = stopped
+	}
+
+	// Effect frames are not acknowledged, keep the spinner visible for a minimum time so that feedback is not lost.
 	m.sending = true
+	m.sendResults = nil
 	return m, tea.Batch(
 		m.spinner.Tick,
-		tea.Tick(defaultSendMessageSpinner, func(time.Time) tea.Msg {
-			return msgSendDone{}
+		tea.Tick(m.cfg.SendMessageSpinner.Std(), func(time.Time) tea.Msg {
+			return msgSendDone(results)
 		}),
 	)
 }
 
+// stopTargetEffects stops running effects on all targets and reports whether any was running.
+func (m model) stopTargetEffects() bool {
+	var stopped bool
+	for _, t := range m.targets {
+		if v, ok := m.effectStoppers[t.Serial]; ok {
+			v.Store(true)
+			delete(m.effectStoppers, t.Serial)
+			stopped = true
+		}
+	}
+	return stopped
+}
+
 func (m model) stopEffectSpinner() (model, tea.Cmd) {
 	m.stopping = true
 	return m, tea.Batch(
 		m.spinner.Tick,
-		tea.Tick(defaultSendMessageSpinner, func(time.Time) tea.Msg {
+		tea.Tick(m.cfg.SendMessageSpinner.Std(), func(time.Time) tea.Msg {
 			return effectStopDone{}
 		}),
 	)
 }
 
+// toggleTargetRoutines pauses the routines of the targets, or resumes them if they are all paused.
+func (m model) toggleTargetRoutines() {
+	if m.routines == nil {
+		return
+	}
+	resume := true
+	for _, t := range m.targets {
+		if rt, ok := m.routines.Get(t.Serial); ok && !rt.Paused() {
+			resume = false
+		}
+	}
+	for _, t := range m.targets {
+		if resume {
+			m.routines.Resume(t.Serial)
+		} else {
+			m.routines.Pause(t.Serial)
+		}
+	}
+}
+
+// cancelTargetRoutines stops the routines of the targets, leaving the devices at their current color.
+func (m model) cancelTargetRoutines() {
+	if m.routines == nil {
+		return
+	}
+	for _, t := range m.targets {
+		m.routines.Cancel(t.Serial)
+	}
+}
+
+// refreshSchedules reads the results of the schedules run by hikari schedule and computes their next runs.
+func (m *model) refreshSchedules() {
+	if m.scheduler == nil {
+		if m.scheduleErr != nil {
+			m.errMessage = m.scheduleErr.Error()
+		}
+		return
+	}
+	m.errMessage = ""
+	if err := m.scheduler.Reload(); err != nil {
+		m.errMessage = err.Error()
+	}
+	m.schedules = m.scheduler.Status(m.clock())
+}
+
 // updateDeviceList updates the list of devices and keeps the current selection.
+// Offline devices are left out of the list when hidden.
 func (m *model) updateDeviceList(devices []ldevice.Device) tea.Cmd {
-	var selectedSerial ldevice.Serial
-	if selectedItem, ok := m.deviceList.SelectedItem().(device.Item); ok {
-		selectedSerial = selectedItem.Serial
+	m.devices = devices
+	// Mismatches of devices that disappeared would otherwise be counted in the status bar forever.
+	maps.DeleteFunc(m.mismatches, func(serial ldevice.Serial, _ error) bool {
+		return !slices.ContainsFunc(devices, func(d ldevice.Device) bool { return d.Serial == serial })
+	})
+	selectedKey := device.Key(m.deviceList.SelectedItem())
+	if m.hideOffline {
+		devices = slices.DeleteFunc(slices.Clone(devices), func(d ldevice.Device) bool {
+			return device.Offline(m.health, d.Serial)
+		})
 	}
 
-	items := make([]list.Item, len(devices))
 	for i := range devices {
 		d := device.Item(devices[i])
-		items[i] = d
-		// Update selectedDevice and its state so that it reflect in Commands and Params views.
+		// Update selectedDevice and targets state so that it reflect in Commands and Params views.
 		if d.Serial == m.selectedDevice.Serial {
 			m.selectedDevice = d
 		}
+		for j, t := range m.targets {
+			if d.Serial == t.Serial {
+				m.targets[j] = d
+			}
+		}
+	}
+
+	items := device.Items(devices)
+	if m.treeView {
+		items = device.Tree(devices)
 	}
 
 	cmd := m.deviceList.SetItems(items)
 	for i, d := range m.deviceList.VisibleItems() {
-		if d.(device.Item).Serial == selectedSerial {
+		if device.Key(d) == selectedKey {
 			m.deviceList.Select(i)
 			break
 		}
@@ -362,33 +860,39 @@ func (m model) View() string {
 	title := style.Title.Render("Hikari")
 	switch m.state {
 	case stateDeviceList:
-		var d *device.Item
-		if deviceItem, ok := m.deviceList.SelectedItem().(device.Item); ok {
-			d = &deviceItem
-		}
-		return m.withDeviceInfoView(d, fmt.Sprintf("%s\n%s\n%s",
+		return m.withDeviceInfoView(m.infoDevice(), fmt.Sprintf("%s\n%s\n%s",
 			title,
 			m.renderStartupSpinnerOrDevices(),
-			style.Status.Render(fmt.Sprintf("Last updated: %s | Devices: %d",
-				m.lastUpdate.Format("15:04:05"), len(m.deviceList.Items()))),
-		))
+			style.Status.Render(m.renderStatus()),
+		)) + "\n" + m.renderHelp()
 
 	case stateCommandList:
-		return m.withDeviceInfoView(&m.selectedDevice, fmt.Sprintf("%s\n\n%s\n\n%s%s",
+		return m.withDeviceInfoView(m.infoDevice(), fmt.Sprintf("%s\n\n%s\n\n%s%s%s",
 			title,
-			m.selectedDevice.Title(),
+			m.renderTargetsTitle(),
 			m.commandList.View(),
 			m.renderSpinner(),
-		))
+			m.renderSendResults(),
+		)+m.renderRoutines()) + "\n\n" + m.renderHelp()
 
 	case stateParamList, stateParamEdit:
-		return fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s%s%s",
+		return fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s%s%s\n\n%s",
 			title,
-			m.selectedDevice.Title(),
+			m.renderTargetsTitle(),
 			m.selectedCommand.Title(),
 			m.paramList.View(),
 			m.renderError(),
 			m.renderSpinner(),
+			m.renderHelp(),
+		)
+
+	case stateScheduleList:
+		return fmt.Sprintf("%s\n\n%s\n\n%s%s\n\n%s",
+			title,
+			style.ListTitle.Render("Schedules"),
+			m.renderSchedules(),
+			m.renderError(),
+			m.renderHelp(),
 		)
 	}
 
@@ -396,11 +900,16 @@ func (m model) View() string {
 }
 
 func (m model) withDeviceInfoView(deviceItem *device.Item, view string) string {
-	view = lipgloss.NewStyle().Width(listWidth).Render(view)
+	view = lipgloss.NewStyle().Width(m.cfg.ListWidth).Render(view)
 	if deviceItem != nil && m.showDeviceInfo {
+		var h controller.Health
+		var tracked bool
+		if m.health != nil {
+			h, tracked = m.health(deviceItem.Serial)
+		}
 		modal := "\n" + lipgloss.Place(0, 30,
 			lipgloss.Left, lipgloss.Top,
-			deviceItem.Info(),
+			deviceItem.Info(h, tracked, m.zones[deviceItem.Serial], m.effects[deviceItem.Serial]),
 		)
 
 		return lipgloss.JoinHorizontal(lipgloss.Top, view, modal)
@@ -415,6 +924,162 @@ func (m model) renderError() string {
 	return ""
 }
 
+func (m model) renderStatus() string {
+	status := fmt.Sprintf("Last updated: %s | Devices: %d", m.lastUpdate.Format("15:04:05"), len(m.devices))
+	if len(m.markedDevices) > 0 {
+		status += fmt.Sprintf(" | Marked: %d", len(m.markedDevices))
+	}
+	if len(m.mismatches) > 0 {
+		status += fmt.Sprintf(" | ⚠️ Mismatched: %d", len(m.mismatches))
+	}
+	var offline int
+	for _, d := range m.devices {
+		if device.Offline(m.health, d.Serial) {
+			offline++
+		}
+	}
+	if offline > 0 {
+		status += fmt.Sprintf(" | Offline: %d", offline)
+		if m.hideOffline {
+			status += " (hidden)"
+		}
+	}
+	return status
+}
+
+func (m model) renderTargetsTitle() string {
+	if m.selectedGroup != nil {
+		return m.selectedGroup.Title()
+	}
+	if len(m.targets) > 1 {
+		return style.SelectedBorder.Render(style.SelectedDevice.Render(fmt.Sprintf("%d devices", len(m.targets))))
+	}
+	// The target is the marked device rather than the one under the cursor, when marked.
+	return m.targets[0].Title()
+}
+
+// renderSendResults renders a per-device summary of the last send.
+func (m model) renderSendResults() string {
+	if m.sending || len(m.sendResults) == 0 {
+		return ""
+	}
+
+	var failed int
+	var skipped bool
+	var b strings.Builder
+	for _, r := range m.sendResults {
+		if r.err != nil {
+			failed++
+			skipped = skipped || errors.Is(r.err, controller.ErrOffline)
+			fmt.Fprintf(&b, "\n%s %s: %s", statusIcon(controller.StatusOf(r.err)), r.device.Label, r.err)
+		}
+	}
+	if skipped {
+		fmt.Fprintf(&b, "\nPress %s to send to offline devices", m.keys.CommandList.ForceSend.Help().Key)
+	}
+	outcome := "Delivered to"
+	if m.selectedCommand.Type == command.CommandTypeEffect || m.selectedCommand.Type == command.CommandTypeRoutine {
+		outcome = "Started on"
+	}
+	return fmt.Sprintf("\n\n✅ %s %d/%d devices%s%s", outcome, len(m.sendResults)-failed, len(m.sendResults), b.String(), m.renderVerifyResults())
+}
+
+// renderRoutines renders the progress of the routines running on the targets.
+func (m model) renderRoutines() string {
+	if m.routines == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	now := m.clock()
+	for _, t := range m.targets {
+		rt, ok := m.routines.Get(t.Serial)
+		if !ok {
+			continue
+		}
+		icon, state := "⏳", fmt.Sprintf("%s left", (rt.Duration-rt.Elapsed(now)).Round(time.Second))
+		if rt.Paused() {
+			icon, state = "⏸️", "paused"
+		}
+		brightness, kelvin := rt.At(rt.Progress(now))
+		fmt.Fprintf(&b, "\n%s %s: %.0f%% %dK → %.0f%% %dK, now %.0f%% %dK, %s",
+			icon, t.Label, rt.FromBrightness, rt.FromKelvin, rt.ToBrightness, rt.ToKelvin, brightness, kelvin, state)
+		if rt.Err != "" {
+			fmt.Fprintf(&b, " (%s)", rt.Err)
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "\n\nRoutines:" + b.String()
+}
+
+// renderVerifyResults renders a per-device summary of the last verification.
+func (m model) renderVerifyResults() string {
+	if len(m.verifyResults) == 0 {
+		return ""
+	}
+
+	var mismatched int
+	var b strings.Builder
+	for _, r := range m.verifyResults {
+		if r.err != nil {
+			mismatched++
+			fmt.Fprintf(&b, "\n⚠️ %s: %s", r.device.Label, r.err)
+		}
+	}
+	return fmt.Sprintf("\n🔍 Verified %d/%d devices%s", len(m.verifyResults)-mismatched, len(m.verifyResults), b.String())
+}
+
+// renderSchedules renders the schedules in the order of their next run with the result of their last one.
+func (m model) renderSchedules() string {
+	if m.scheduler == nil && m.scheduleErr != nil {
+		return "Schedules could not be loaded, fix the schedules of the config file."
+	}
+	if len(m.schedules) == 0 {
+		return "No schedules, add them to the schedules of the config file."
+	}
+
+	var b strings.Builder
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Name\tAt\tCommand\tTarget\tNext\tLast run")
+	for _, s := range m.schedules {
+		next := "never"
+		if !s.Next.IsZero() {
+			next = s.Next.Format(scheduleTimeFormat)
+		}
+		last := "never"
+		if r := s.Last; r != nil {
+			icon := "✅"
+			if !r.OK() {
+				icon = "❌"
+			}
+			last = fmt.Sprintf("%s %s %s", icon, r.Time.In(m.clock().Location()).Format(scheduleTimeFormat), r)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.At, s.Command, s.Target, next, last)
+	}
+	tw.Flush()
+	return b.String() + "\nSchedules run while hikari schedule is running."
+}
+
+func statusIcon(s controller.Status) string {
+	switch s {
+	case controller.StatusTimedOut:
+		return "⌛"
+	case controller.StatusOffline:
+		return "📴"
+	}
+	return "❌"
+}
+
+// renderHelp renders the bindings of the current state as a one-line footer, or all of them when the help is shown.
+func (m model) renderHelp() string {
+	if m.showHelp {
+		return style.HelpOverlay.Render(m.help.FullHelpView(m.helpKeys().FullHelp()))
+	}
+	return m.help.ShortHelpView(m.helpKeys().ShortHelp())
+}
+
 func (m model) renderSpinner() string {
 	if m.sending {
 		return fmt.Sprint("\n\nSending... ", m.spinner.View())
@@ -422,6 +1087,9 @@ func (m model) renderSpinner() string {
 	if m.stopping {
 		return fmt.Sprint("\n\nStopping effect... ", m.spinner.View())
 	}
+	if m.verifying {
+		return fmt.Sprint("\n\nVerifying... ", m.spinner.View())
+	}
 	return ""
 }
 
@@ -433,13 +1101,67 @@ func (m model) renderStartupSpinnerOrDevices() string {
 }
 
 func main() {
-	if len(os.Args) > 1 && os.Args[1] == "--version" {
+	fs := flag.NewFlagSet("hikari", flag.ExitOnError)
+	showVersion := fs.Bool("version", false, "Print version information")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: hikari [flags] [command]\n\nRun 'hikari help' for the list of commands.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+
+	cfg, err := config.Load(fs, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *showVersion {
 		version.Print()
 		os.Exit(0)
 	}
+	if err := command.ApplyConfig(cfg); err != nil {
+		log.Fatal(err)
+	}
+	if fs.NArg() > 0 {
+		os.Exit(cli.Run(cfg, fs.Args()))
+	}
+
+	if err := style.Use(cfg.Theme); err != nil {
+		log.Fatal(err)
+	}
+	keys, err := keymap.New(cfg.Keys)
+	if err != nil {
+		log.Fatal(err)
+	}
+	input.SetKeys(keys.Input)
+
+	c, err := controller.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tracker := controller.NewTracker(c, cfg.PingInterval.Std(), cfg.OfflineAfter.Std())
+	defer tracker.Close()
+	if err := command.OpenSceneLibrary(); err != nil {
+		log.Fatal(err)
+	}
+
+	statePath, err := schedule.DefaultStatePath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Invalid schedules or state only stop hikari schedule, the TUI reports them in the schedule list.
+	scheduler, scheduleErr := schedule.New(nil, cfg, statePath)
+
+	routinesPath, err := routine.DefaultPath("")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Routines left running when hikari last exited are resumed.
+	routines, err := routine.NewRunner(tracker, controller.PolicyFrom(cfg), routinesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer routines.Close()
 
-	m := initialModel()
-	defer m.deviceManager.Close()
+	m := initialModel(cfg, keys, tracker, scheduler, routines)
+	m.scheduleErr = scheduleErr
 
 	p := tea.NewProgram(m, tea.WithAltScreen())
 
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/firmware"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/keymap"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/multizone"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/routine"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/schedule"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+var (
+	kitchen = testdevice.Kitchen
+	tiles   = testdevice.Tiles
+)
+
+// stripZones returns n zones blending from red to blue.
+func stripZones(n int) []packets.LightHsbk {
+	return multizone.Gradient([]packets.LightHsbk{
+		{Hue: 0, Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500},
+		{Hue: math.MaxUint16 * 2 / 3, Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500},
+	}, n)
+}
+
+// types returns payload types as sent by sentTo.
+func types[T ~uint16](ts ...T) []uint16 {
+	out := make([]uint16, len(ts))
+	for i, t := range ts {
+		out[i] = uint16(t)
+	}
+	return out
+}
+
+// sentTo returns the payload types of the messages sent to each device, in order.
+func sentTo(r *controller.Recorder) map[ldevice.Serial][]uint16 {
+	sent := make(map[ldevice.Serial][]uint16)
+	for _, c := range r.Calls() {
+		sent[c.Serial] = append(sent[c.Serial], c.Payload.PayloadType())
+	}
+	return sent
+}
+
+func TestModel(t *testing.T) {
+	scheduler := newTestScheduler(t)
+	testCases := map[string]struct {
+		setup     func(m *model, f *controller.Fake)
+		offline   []ldevice.Serial
+		keys      []string
+		wantState state
+		wantSent  map[ldevice.Serial][]uint16
+		checkSent func(t *testing.T, calls []controller.Call)
+		check     func(t *testing.T, m model)
+	}{
+		"filter and select device": {
+			keys:      []string{"/", "t", "i", "l", "enter", "enter"},
+			wantState: stateCommandList,
+			check: func(t *testing.T, m model) {
+				if len(m.targets) != 1 || m.targets[0].Serial != tiles.Serial {
+					t.Errorf("Expected Tiles to be the only target, got %v", m.targets)
+				}
+			},
+		},
+		"send power on to marked devices": {
+			keys:      []string{" ", "down", " ", "enter", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeDeviceSetPower), tiles.Serial: types(packets.PayloadTypeDeviceSetPower)},
+			checkSent: func(t *testing.T, calls []controller.Call) {
+				for _, c := range calls {
+					if p := c.Payload.(*packets.DeviceSetPower); p.Level != math.MaxUint16 {
+						t.Errorf("Power level of %s does not match: got %d, want %d", c.Serial, p.Level, math.MaxUint16)
+					}
+				}
+			},
+		},
+		"unacknowledged send": {
+			setup:     func(m *model, f *controller.Fake) { f.Drop(tiles.Serial, -1) },
+			keys:      []string{" ", "down", " ", "enter", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeDeviceSetPower), tiles.Serial: types(packets.PayloadTypeDeviceSetPower, packets.PayloadTypeDeviceSetPower, packets.PayloadTypeDeviceSetPower)},
+			check: func(t *testing.T, m model) {
+				for _, r := range m.sendResults {
+					want := controller.StatusDelivered
+					if r.device.Serial == tiles.Serial {
+						want = controller.StatusTimedOut
+					}
+					if got := controller.StatusOf(r.err); got != want {
+						t.Errorf("Status of %s does not match: got %s, want %s", r.device.Label, got, want)
+					}
+				}
+			},
+		},
+		"verify missed power off": {
+			setup: func(m *model, f *controller.Fake) {
+				m.cfg.Verify = true
+				f.Apply = func(*ldevice.Device, packets.Payload) {}
+			},
+			keys:      []string{"enter", "down", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeDeviceSetPower, packets.PayloadTypeLightGet)},
+			checkSent: func(t *testing.T, calls []controller.Call) {
+				if p := calls[0].Payload.(*packets.DeviceSetPower); p.Level != 0 {
+					t.Errorf("Power level does not match: got %d, want 0", p.Level)
+				}
+			},
+			check: func(t *testing.T, m model) {
+				if err := m.mismatches[kitchen.Serial]; !errors.Is(err, controller.ErrMismatch) {
+					t.Errorf("Expected a mismatch, got %v", err)
+				}
+				// The mismatch is dropped once the device disappears.
+				m = send(t, m, deviceUpdateMsg{tiles})
+				if len(m.mismatches) != 0 {
+					t.Errorf("Expected no mismatches once Kitchen is gone, got %v", m.mismatches)
+				}
+			},
+		},
+		"verify power on": {
+			setup:     func(m *model, f *controller.Fake) { m.cfg.Verify = true },
+			keys:      []string{"enter", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeDeviceSetPower, packets.PayloadTypeLightGet)},
+			check: func(t *testing.T, m model) {
+				if len(m.verifyResults) != 1 || len(m.mismatches) != 0 {
+					t.Errorf("Expected the device to be verified, got %v", m.verifyResults)
+				}
+			},
+		},
+		"edit param and send": {
+			keys:      []string{"enter", "down", "down", "enter", "enter", "1", "2", "0", "enter", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeLightSetColor)},
+			checkSent: func(t *testing.T, calls []controller.Call) {
+				if p := calls[0].Payload.(*packets.LightSetColor); p.Color.Hue != 21845 {
+					t.Errorf("Hue does not match: got %d, want 21845 (120°)", p.Color.Hue)
+				}
+			},
+		},
+		"invalid param renders error": {
+			keys:      []string{"enter", "down", "down", "enter", "enter", "9", "9", "9", "enter"},
+			wantState: stateParamEdit,
+			check: func(t *testing.T, m model) {
+				if m.errMessage == "" {
+					t.Error("Expected an error message")
+				}
+			},
+		},
+		"cancel param edit": {
+			keys:      []string{"enter", "down", "down", "enter", "enter", "9", "left", "left"},
+			wantState: stateCommandList,
+		},
+		"effect on non matrix device": {
+			keys:      []string{"enter", "down", "down", "down", "down", "down", "down", "down", "down", "enter", "down", "down", "down", "enter", " ", "enter", "s"},
+			wantState: stateCommandList,
+			check: func(t *testing.T, m model) {
+				if len(m.sendResults) != 1 || m.sendResults[0].err == nil {
+					t.Errorf("Expected a not a matrix device error, got %v", m.sendResults)
+				}
+			},
+		},
+		"effect start and stop": {
+			keys:      []string{"down", "enter", "down", "down", "down", "down", "down", "down", "down", "down", "enter", "down", "down", "down", "enter", " ", "enter", "s", "enter"},
+			wantState: stateParamList,
+			check: func(t *testing.T, m model) {
+				if _, ok := m.effectStoppers[tiles.Serial]; ok {
+					t.Error("Expected effect to be stopped")
+				}
+			},
+		},
+		"offline device greyed out": {
+			offline:   []ldevice.Serial{tiles.Serial},
+			keys:      []string{"down", "i"},
+			wantState: stateDeviceList,
+		},
+		"zone bar in device info": {
+			setup: func(m *model, f *controller.Fake) {
+				f.SetZones(kitchen.Serial, stripZones(16))
+			},
+			keys:      []string{"i"},
+			wantState: stateDeviceList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeMultiZoneExtendedGetColorZones, packets.PayloadTypeMultiZoneGetEffect)},
+			check: func(t *testing.T, m model) {
+				if n := len(m.zones[kitchen.Serial]); n != 16 {
+					t.Errorf("Zones do not match: got %d, want 16", n)
+				}
+			},
+		},
+		"firmware effect in device info": {
+			setup: func(m *model, f *controller.Fake) {
+				msg, err := firmware.Start(context.Background(), f, tiles, firmware.Settings{Effect: firmware.Morph, Speed: 5 * time.Second})
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Send(tiles.Serial, msg)
+			},
+			keys:      []string{"down", "i"},
+			wantState: stateDeviceList,
+			wantSent:  map[ldevice.Serial][]uint16{tiles.Serial: types(packets.PayloadTypeTileGetEffect)},
+			check: func(t *testing.T, m model) {
+				if got := m.effects[tiles.Serial]; got != firmware.Morph {
+					t.Errorf("Effect does not match: got %q, want %q", got, firmware.Morph)
+				}
+			},
+		},
+		"stop firmware effect": {
+			setup: func(m *model, f *controller.Fake) {
+				f.SetZones(kitchen.Serial, stripZones(8))
+				msg, err := firmware.Start(context.Background(), f, kitchen, firmware.Settings{Effect: firmware.Move, Speed: 5 * time.Second})
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Send(kitchen.Serial, msg)
+			},
+			keys: []string{"enter", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down",
+				"down", "down", "down", "down", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeMultiZoneExtendedGetColorZones, packets.PayloadTypeMultiZoneSetEffect)},
+			checkSent: func(t *testing.T, calls []controller.Call) {
+				if p := calls[1].Payload.(*packets.MultiZoneSetEffect); p.Settings.Type != enums.MultiZoneEffectTypeMULTIZONEEFFECTTYPEOFF {
+					t.Errorf("Effect does not match: got %d, want off", p.Settings.Type)
+				}
+			},
+			check: func(t *testing.T, m model) {
+				effect, err := firmware.Get(context.Background(), m.deviceManager, kitchen)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if effect != firmware.Off {
+					t.Errorf("Effect does not match: got %q, want %q", effect, firmware.Off)
+				}
+			},
+		},
+		"set zone range": {
+			setup: func(m *model, f *controller.Fake) {
+				f.SetZones(kitchen.Serial, stripZones(8))
+			},
+			keys: []string{"enter", "down", "down", "down", "down", "down", "down", "enter",
+				"enter", "2", "enter", "down", "enter", "3", "enter", "down", "enter", "1", "8", "0", "enter", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeMultiZoneExtendedGetColorZones, packets.PayloadTypeMultiZoneExtendedSetColorZones)},
+			checkSent: func(t *testing.T, calls []controller.Call) {
+				p := calls[1].Payload.(*packets.MultiZoneExtendedSetColorZones)
+				if p.Index != 2 || p.ColorsCount != 2 {
+					t.Errorf("Zones do not match: got %d from %d, want 2 from 2", p.ColorsCount, p.Index)
+				}
+			},
+			check: func(t *testing.T, m model) {
+				zones := m.deviceManager.(*controller.Recorder).Controller.(*controller.Fake).Zones(kitchen.Serial)
+				for i, z := range zones {
+					want := stripZones(8)[i].Hue
+					if i == 2 || i == 3 {
+						want = 32768 // 180°
+					}
+					if z.Hue != want {
+						t.Errorf("Hue of zone %d does not match: got %d, want %d", i, z.Hue, want)
+					}
+				}
+			},
+		},
+		"hide offline devices": {
+			offline:   []ldevice.Serial{tiles.Serial},
+			keys:      []string{"o"},
+			wantState: stateDeviceList,
+			check: func(t *testing.T, m model) {
+				if n := len(m.deviceList.Items()); n != 1 {
+					t.Errorf("Devices do not match: got %d, want 1", n)
+				}
+			},
+		},
+		"send skips offline device": {
+			offline:   []ldevice.Serial{tiles.Serial},
+			keys:      []string{" ", "down", " ", "enter", "s"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeDeviceSetPower)},
+			check: func(t *testing.T, m model) {
+				if len(m.sendResults) != 2 || !errors.Is(m.sendResults[1].err, controller.ErrOffline) {
+					t.Errorf("Expected Tiles to be skipped as offline, got %v", m.sendResults)
+				}
+			},
+		},
+		"marked device shown as target": {
+			keys:      []string{"down", " ", "up", "enter", "i"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{tiles.Serial: types(packets.PayloadTypeTileGetEffect)},
+			check: func(t *testing.T, m model) {
+				if len(m.targets) != 1 || m.targets[0].Serial != tiles.Serial {
+					t.Errorf("Expected Tiles to be the only target, got %v", m.targets)
+				}
+			},
+		},
+		"force send to offline device": {
+			offline:   []ldevice.Serial{tiles.Serial},
+			keys:      []string{" ", "down", " ", "enter", "S"},
+			wantState: stateCommandList,
+			wantSent:  map[ldevice.Serial][]uint16{kitchen.Serial: types(packets.PayloadTypeDeviceSetPower), tiles.Serial: types(packets.PayloadTypeDeviceSetPower)},
+		},
+		"schedule list": {
+			setup: func(m *model, f *controller.Fake) {
+				m.scheduler = scheduler
+				m.clock = func() time.Time { return time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC) }
+			},
+			keys:      []string{"t"},
+			wantState: stateScheduleList,
+			check: func(t *testing.T, m model) {
+				if len(m.schedules) != 2 || m.schedules[0].Name != "night" {
+					t.Errorf("Expected night to run first, got %v", m.schedules)
+				}
+			},
+		},
+		"invalid schedules": {
+			setup: func(m *model, f *controller.Fake) {
+				_, m.scheduleErr = schedule.New(nil, config.Config{Schedules: []config.Schedule{
+					{Name: "dusk", At: "sunset", Command: "power_on", Target: "all"},
+				}}, "")
+			},
+			keys:      []string{"t"},
+			wantState: stateScheduleList,
+			check: func(t *testing.T, m model) {
+				if m.errMessage == "" {
+					t.Error("Expected the schedules error to be shown")
+				}
+			},
+		},
+		"help overlay": {
+			keys:      []string{"?"},
+			wantState: stateDeviceList,
+			check: func(t *testing.T, m model) {
+				if !m.showHelp {
+					t.Error("Expected help to be shown")
+				}
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m, f, r := newTestModel(t, tc.offline, kitchen, tiles)
+			if tc.setup != nil {
+				tc.setup(&m, f)
+			}
+			m = press(t, m, tc.keys...)
+
+			if m.state != tc.wantState {
+				t.Errorf("State does not match: got %d, want %d", m.state, tc.wantState)
+			}
+			if got := sentTo(r); len(got) != len(tc.wantSent) {
+				t.Errorf("Sent messages do not match: got %v, want %v", got, tc.wantSent)
+			} else {
+				for serial, want := range tc.wantSent {
+					if !slices.Equal(got[serial], want) {
+						t.Errorf("Sent messages to %s do not match: got %v, want %v", serial, got[serial], want)
+					}
+				}
+			}
+			if tc.checkSent != nil {
+				tc.checkSent(t, r.Calls())
+			}
+			if tc.check != nil {
+				tc.check(t, m)
+			}
+			assertGolden(t, m.View())
+		})
+	}
+}
+
+func TestEffectStop(t *testing.T) {
+	m, _, _ := newTestModel(t, nil, kitchen, tiles)
+	m = press(t, m, "down", "enter", "down", "down", "down", "down", "down", "down", "down", "down", "enter", "down", "down", "down", "enter", " ", "enter", "s")
+
+	stopped, ok := m.effectStoppers[tiles.Serial]
+	if !ok {
+		t.Fatal("Expected effect to be running")
+	}
+	m = press(t, m, "enter")
+	if !stopped.Load() {
+		t.Error("Expected effect to be signalled to stop")
+	}
+	if m.stopping {
+		t.Error("Expected stopping spinner to be done")
+	}
+}
+
+func TestZonesTimeout(t *testing.T) {
+	m, f, _ := newTestModel(t, nil, kitchen)
+	r := controller.NewRecorder(silentZones{Controller: f})
+	m.deviceManager = r
+	m = press(t, m, "i")
+	m = send(t, m, tickMsg{})
+
+	var queries int
+	for _, c := range r.Calls() {
+		if _, ok := c.Payload.(*packets.MultiZoneExtendedGetColorZones); ok {
+			queries++
+		}
+	}
+	if queries != 1 {
+		t.Errorf("Zone queries do not match: got %d, want 1", queries)
+	}
+	if zones, ok := m.zones[kitchen.Serial]; !ok || zones != nil {
+		t.Errorf("Expected kitchen to be known without zones, got %v", zones)
+	}
+}
+
+func TestRoutinePauseAndCancel(t *testing.T) {
+	m, _, _ := newTestModel(t, nil, kitchen, tiles)
+	runner, err := routine.NewRunner(m.deviceManager, m.retryPolicy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer runner.Close()
+	m.routines = runner
+
+	// Select the routine command and set its length, typing the hours unit.
+	m = press(t, m, "enter", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "enter")
+	m = press(t, m, "down", "down", "down", "down", "enter", "1", "h", "3", "0", "m", "enter", "s")
+	rt, ok := runner.Get(kitchen.Serial)
+	if !ok || rt.Duration != 90*time.Minute {
+		t.Fatalf("Routine does not match: got %+v (%t)", rt, ok)
+	}
+
+	m = press(t, m, "p")
+	if rt, _ := runner.Get(kitchen.Serial); !rt.Paused() {
+		t.Error("Expected routine to be paused")
+	}
+	if view := m.View(); !strings.Contains(view, "⏸️ Kitchen: 1% 2000K → 80% 4000K") {
+		t.Errorf("Expected paused routine in view, got:\n%s", view)
+	}
+
+	m = press(t, m, "p")
+	if rt, _ := runner.Get(kitchen.Serial); rt.Paused() {
+		t.Error("Expected routine to be resumed")
+	}
+	m = press(t, m, "x")
+	if _, ok := runner.Get(kitchen.Serial); ok {
+		t.Error("Expected routine to be cancelled")
+	}
+}
+
+func TestSceneNameInput(t *testing.T) {
+	m, _, _ := newTestModel(t, nil, kitchen, tiles)
+
+	// Select the save scene command and type a name with the confirm, cancel and help keys.
+	m = press(t, m, "enter", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "down", "enter")
+	m = press(t, m, "enter", "h", "e", "a", "r", "t", "h", " ", "e", "v", "e", "n", "i", "n", "g", "?")
+	if m.state != stateParamEdit || m.showHelp {
+		t.Fatalf("State does not match: got %d (help %t), want %d", m.state, m.showHelp, stateParamEdit)
+	}
+	m = press(t, m, "enter")
+	if m.state != stateParamList {
+		t.Fatalf("State does not match: got %d, want %d", m.state, stateParamList)
+	}
+	params := command.ParamItemsFromModel(m.paramList)
+	if got := command.SetParamValue[string](params[0]); got != "hearth evening?" {
+		t.Errorf("Name does not match: got %q, want %q", got, "hearth evening?")
+	}
+}
+
+// newTestScheduler returns a scheduler with two schedules, the morning one having run once.
+func newTestScheduler(t *testing.T) *schedule.Scheduler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schedule_state.json")
+	state := `{"version": 1, "results": {"morning": {"time": "2025-01-01T07:00:00Z", "delivered": 1, "devices": 2, "error": "Tiles: device offline"}}}`
+	if err := os.WriteFile(path, []byte(state), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	cfg.Schedules = []config.Schedule{
+		{Name: "morning", At: "0 7 * * mon-fri", Command: "power_on", Target: "all"},
+		{Name: "night", At: "30 23 * * *", Command: "power_off", Target: "all"},
+	}
+	s, err := schedule.New(nil, cfg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// offlineHealth reports the offline devices as last seen 3 minutes ago and every other device as online.
+type offlineHealth struct {
+	controller.Controller
+	offline []ldevice.Serial
+}
+
+func (c offlineHealth) Health(serial ldevice.Serial) (controller.Health, bool) {
+	if slices.Contains(c.offline, serial) {
+		return controller.Health{LastSeen: time.Now().Add(-3*time.Minute - time.Second)}, true
+	}
+	return controller.Health{Online: true, LastSeen: time.Now(), RTT: 12 * time.Millisecond}, true
+}
+
+// silentZones is a controller whose devices ignore zone queries, as bulbs that do not report unhandled messages.
+type silentZones struct {
+	controller.Controller
+}
+
+func (c silentZones) Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	if _, ok := payload.(*packets.MultiZoneExtendedGetColorZones); ok {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return c.Controller.Query(ctx, serial, payload, respType, count)
+}
+
+// newTestModel returns a model serving devices from a recorded fake controller, with a fixed size and update time.
+// Devices in offline are reported offline.
+func newTestModel(t *testing.T, offline []ldevice.Serial, devices ...ldevice.Device) (model, *controller.Fake, *controller.Recorder) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.SendMessageSpinner = 0
+	cfg.SendTimeout = config.Duration(10 * time.Millisecond)
+	cfg.SendBackoff = config.Duration(time.Millisecond)
+	f := controller.NewFake(devices...)
+	r := controller.NewRecorder(f)
+
+	var c controller.Controller = r
+	if len(offline) > 0 {
+		c = offlineHealth{Controller: r, offline: offline}
+	}
+	m := initialModel(cfg, keymap.Default(), c, nil, nil)
+	m = send(t, m, tea.WindowSizeMsg{Width: 80, Height: 30})
+	m.lastUpdate = time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)
+	return m, f, r
+}
+
+// press feeds key presses to the model, e.g. "enter", "down" or "a".
+func press(t *testing.T, m model, keys ...string) model {
+	t.Helper()
+	for _, k := range keys {
+		m = send(t, m, keyMsg(k))
+	}
+	return m
+}
+
+// send feeds msg to the model and then the messages of the resulting commands until none is left.
+// Ticks are dropped so that the model settles.
+func send(t *testing.T, m model, msg tea.Msg) model {
+	t.Helper()
+	queue := []tea.Msg{msg}
+	for len(queue) > 0 {
+		next, cmd := m.Update(queue[0])
+		m = next.(model)
+		queue = append(queue[1:], run(cmd)...)
+	}
+	return m
+}
+
+func run(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	switch msg := cmd().(type) {
+	case tea.BatchMsg:
+		var msgs []tea.Msg
+		for _, c := range msg {
+			msgs = append(msgs, run(c)...)
+		}
+		return msgs
+	case nil, tickMsg, spinner.TickMsg, tea.QuitMsg:
+		return nil
+	default:
+		return []tea.Msg{msg}
+	}
+}
+
+func keyMsg(k string) tea.KeyMsg {
+	switch k {
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "up":
+		return tea.KeyMsg{Type: tea.KeyUp}
+	case "down":
+		return tea.KeyMsg{Type: tea.KeyDown}
+	case "left":
+		return tea.KeyMsg{Type: tea.KeyLeft}
+	case "right":
+		return tea.KeyMsg{Type: tea.KeyRight}
+	case "esc":
+		return tea.KeyMsg{Type: tea.KeyEsc}
+	case " ":
+		return tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+}
+
+// assertGolden compares got with testdata/<test name>.golden, updating it with -update.
+func assertGolden(t *testing.T, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", filepath.Base(t.Name())+".golden")
+	if *updateGolden {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("View does not match %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
@@ -0,0 +1,121 @@
+// Package multizone reads and sets the colors of the zones of strips and beams with the extended multizone messages.
+package multizone
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// MaxZonesPerMessage is the number of zones carried by a single extended multizone message.
+const MaxZonesPerMessage = 82
+
+// Querier requests state from devices.
+type Querier interface {
+	Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error)
+}
+
+// Get returns the colors of all the zones of the device, the zone count being their length.
+// Devices without zones fail with controller.ErrUnhandled, or time out if they do not report unhandled messages.
+func Get(ctx context.Context, q Querier, serial ldevice.Serial) ([]packets.LightHsbk, error) {
+	respType := uint16(packets.PayloadTypeMultiZoneExtendedStateMultiZone)
+	responses, err := q.Query(ctx, serial, &packets.MultiZoneExtendedGetColorZones{}, respType, 1)
+	if err != nil {
+		return nil, err
+	}
+	first, ok := responses[0].(*packets.MultiZoneExtendedStateMultiZone)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response %T", responses[0])
+	}
+	count := int(first.Count)
+	// Devices with more zones than fit a message reply with one message per chunk of zones.
+	if n := messages(count); n > 1 {
+		if responses, err = q.Query(ctx, serial, &packets.MultiZoneExtendedGetColorZones{}, respType, n); err != nil {
+			return nil, err
+		}
+	}
+
+	zones := make([]packets.LightHsbk, count)
+	for _, r := range responses {
+		s, ok := r.(*packets.MultiZoneExtendedStateMultiZone)
+		if !ok {
+			return nil, fmt.Errorf("unexpected response %T", r)
+		}
+		if int(s.Index) >= count {
+			return nil, fmt.Errorf("unexpected zone index %d", s.Index)
+		}
+		copy(zones[s.Index:], s.Colors[:min(int(s.ColorsCount), MaxZonesPerMessage)])
+	}
+	return zones, nil
+}
+
+// Set returns the messages setting the zones from start onwards to colors with the given transition duration.
+// The colors are applied together once the last message is received.
+func Set(start int, colors []packets.LightHsbk, duration time.Duration) []*protocol.Message {
+	var msgs []*protocol.Message
+	for i := 0; i < len(colors); i += MaxZonesPerMessage {
+		chunk := colors[i:min(i+MaxZonesPerMessage, len(colors))]
+		p := &packets.MultiZoneExtendedSetColorZones{
+			Duration:    uint32(duration.Milliseconds()),
+			Apply:       enums.MultiZoneExtendedApplicationRequestMULTIZONEEXTENDEDAPPLICATIONREQUESTNOAPPLY,
+			Index:       uint16(start + i),
+			ColorsCount: uint8(len(chunk)),
+		}
+		if i+MaxZonesPerMessage >= len(colors) {
+			p.Apply = enums.MultiZoneExtendedApplicationRequestMULTIZONEEXTENDEDAPPLICATIONREQUESTAPPLY
+		}
+		copy(p.Colors[:], chunk)
+		msgs = append(msgs, protocol.NewMessage(p))
+	}
+	return msgs
+}
+
+// Gradient returns n colors blending evenly between the stops, from the first to the last.
+// Hues blend the shortest way around the color wheel, e.g. from red to magenta through pink rather than green.
+func Gradient(stops []packets.LightHsbk, n int) []packets.LightHsbk {
+	colors := make([]packets.LightHsbk, n)
+	if len(stops) == 0 {
+		return colors
+	}
+	for i := range colors {
+		if len(stops) == 1 || n == 1 {
+			colors[i] = stops[0]
+			continue
+		}
+		pos := float64(i) / float64(n-1) * float64(len(stops)-1)
+		seg := min(int(pos), len(stops)-2)
+		colors[i] = blend(stops[seg], stops[seg+1], pos-float64(seg))
+	}
+	return colors
+}
+
+// blend returns the color at t, between 0 and 1, from a to b.
+func blend(a, b packets.LightHsbk, t float64) packets.LightHsbk {
+	lerp := func(x, y uint16) uint16 {
+		return uint16(math.Round(float64(x) + (float64(y)-float64(x))*t))
+	}
+	dh := int(b.Hue) - int(a.Hue)
+	switch {
+	case dh > math.MaxInt16:
+		dh -= math.MaxUint16 + 1
+	case dh < math.MinInt16:
+		dh += math.MaxUint16 + 1
+	}
+	return packets.LightHsbk{
+		Hue:        uint16((int(a.Hue) + int(math.Round(float64(dh)*t)) + math.MaxUint16 + 1) % (math.MaxUint16 + 1)),
+		Saturation: lerp(a.Saturation, b.Saturation),
+		Brightness: lerp(a.Brightness, b.Brightness),
+		Kelvin:     lerp(a.Kelvin, b.Kelvin),
+	}
+}
+
+// messages returns the number of extended multizone messages carrying count zones.
+func messages(count int) int {
+	return max((count+MaxZonesPerMessage-1)/MaxZonesPerMessage, 1)
+}
@@ -0,0 +1,163 @@
+package multizone
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	red   = packets.LightHsbk{Hue: 0, Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500}
+	green = packets.LightHsbk{Hue: 21845, Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500}
+	blue  = packets.LightHsbk{Hue: 43690, Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500}
+	pink  = packets.LightHsbk{Hue: 60075, Saturation: math.MaxUint16, Brightness: math.MaxUint16, Kelvin: 3500}
+)
+
+func TestGradient(t *testing.T) {
+	testCases := map[string]struct {
+		stops    []packets.LightHsbk
+		n        int
+		wantHues []uint16
+	}{
+		"no stops": {
+			n:        2,
+			wantHues: []uint16{0, 0},
+		},
+		"single stop": {
+			stops:    []packets.LightHsbk{blue},
+			n:        3,
+			wantHues: []uint16{43690, 43690, 43690},
+		},
+		"two stops": {
+			stops:    []packets.LightHsbk{red, green},
+			n:        3,
+			wantHues: []uint16{0, 10923, 21845},
+		},
+		"three stops": {
+			stops:    []packets.LightHsbk{red, green, blue},
+			n:        5,
+			wantHues: []uint16{0, 10923, 21845, 32768, 43690},
+		},
+		"shortest arc": {
+			stops:    []packets.LightHsbk{red, blue},
+			n:        3,
+			wantHues: []uint16{0, 54613, 43690},
+		},
+		"shortest arc across red": {
+			stops:    []packets.LightHsbk{pink, red, pink},
+			n:        5,
+			wantHues: []uint16{60075, 62806, 0, 62805, 60075},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var hues []uint16
+			for _, c := range Gradient(tc.stops, tc.n) {
+				hues = append(hues, c.Hue)
+			}
+			if !slices.Equal(hues, tc.wantHues) {
+				t.Errorf("Hues do not match: got %v, want %v", hues, tc.wantHues)
+			}
+		})
+	}
+}
+
+func TestSetAndGet(t *testing.T) {
+	strip := testdevice.Strip
+	testCases := map[string]struct {
+		zones        int
+		start        int
+		colors       []packets.LightHsbk
+		wantMessages int
+	}{
+		"single zone": {
+			zones:        16,
+			start:        3,
+			colors:       []packets.LightHsbk{blue},
+			wantMessages: 1,
+		},
+		"range": {
+			zones:        16,
+			start:        4,
+			colors:       Gradient([]packets.LightHsbk{green, blue}, 8),
+			wantMessages: 1,
+		},
+		"more zones than a message": {
+			zones:        120,
+			colors:       Gradient([]packets.LightHsbk{red, green, blue}, 120),
+			wantMessages: 2,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := controller.NewFake(strip)
+			f.SetZones(strip.Serial, Gradient([]packets.LightHsbk{red}, tc.zones))
+
+			msgs := Set(tc.start, tc.colors, time.Second)
+			if len(msgs) != tc.wantMessages {
+				t.Fatalf("Messages do not match: got %d, want %d", len(msgs), tc.wantMessages)
+			}
+			for _, msg := range msgs {
+				if err := f.Send(strip.Serial, msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			zones, err := Get(context.Background(), f, strip.Serial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Gradient([]packets.LightHsbk{red}, tc.zones)
+			copy(want[tc.start:], tc.colors)
+			if !slices.Equal(zones, want) {
+				t.Errorf("Zones do not match: got %v, want %v", zones, want)
+			}
+		})
+	}
+}
+
+func TestGetUnhandled(t *testing.T) {
+	bulb := testdevice.Kitchen
+	f := controller.NewFake(bulb)
+	if _, err := Get(context.Background(), f, bulb.Serial); !errors.Is(err, controller.ErrUnhandled) {
+		t.Errorf("Error does not match: got %v, want %v", err, controller.ErrUnhandled)
+	}
+}
+
+// strayResponder answers zone queries with the first responses, as many as requested.
+type strayResponder struct {
+	responses []packets.Payload
+}
+
+func (s strayResponder) Query(_ context.Context, _ ldevice.Serial, _ packets.Payload, _ uint16, count int) ([]packets.Payload, error) {
+	return s.responses[:count], nil
+}
+
+func TestGetUnexpectedResponse(t *testing.T) {
+	testCases := map[string]strayResponder{
+		"first response": {
+			responses: []packets.Payload{&packets.LightState{}},
+		},
+		"later response": {
+			responses: []packets.Payload{&packets.MultiZoneExtendedStateMultiZone{Count: 100}, &packets.LightState{}},
+		},
+	}
+
+	for name, q := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Get(context.Background(), q, testdevice.Strip.Serial); err == nil {
+				t.Error("Expected an error on an unexpected response")
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package routine
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	shelf  = testdevice.Strip
+	wakeUp = Ramp{FromBrightness: 1, FromKelvin: 2000, ToBrightness: 81, ToKelvin: 4000, Duration: 30 * time.Minute, Curve: CurveLinear}
+)
+
+func TestRampAt(t *testing.T) {
+	testCases := map[string]struct {
+		curve          string
+		p              float64
+		wantBrightness float64
+		wantKelvin     uint16
+	}{
+		"start": {
+			curve:          CurveLinear,
+			wantBrightness: 1,
+			wantKelvin:     2000,
+		},
+		"linear halfway": {
+			curve:          CurveLinear,
+			p:              0.5,
+			wantBrightness: 41,
+			wantKelvin:     3000,
+		},
+		"ease in halfway": {
+			curve:          CurveEaseIn,
+			p:              0.5,
+			wantBrightness: 21,
+			wantKelvin:     2500,
+		},
+		"ease out halfway": {
+			curve:          CurveEaseOut,
+			p:              0.5,
+			wantBrightness: 61,
+			wantKelvin:     3500,
+		},
+		"past the end": {
+			curve:          CurveEaseIn,
+			p:              1.5,
+			wantBrightness: 81,
+			wantKelvin:     4000,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := wakeUp
+			r.Curve = tc.curve
+			brightness, kelvin := r.At(tc.p)
+			if math.Abs(brightness-tc.wantBrightness) > 1e-9 || kelvin != tc.wantKelvin {
+				t.Errorf("Color does not match: got %v%% %dK, want %v%% %dK", brightness, kelvin, tc.wantBrightness, tc.wantKelvin)
+			}
+		})
+	}
+}
+
+func TestRoutineElapsed(t *testing.T) {
+	start := time.Date(2025, 1, 1, 6, 30, 0, 0, time.UTC)
+	testCases := map[string]struct {
+		routine Routine
+		now     time.Time
+		want    time.Duration
+	}{
+		"running": {
+			routine: Routine{Ramp: wakeUp, StartedAt: start},
+			now:     start.Add(10 * time.Minute),
+			want:    10 * time.Minute,
+		},
+		"resumed": {
+			routine: Routine{Ramp: wakeUp, StartedAt: start, PausedFor: 5 * time.Minute},
+			now:     start.Add(10 * time.Minute),
+			want:    5 * time.Minute,
+		},
+		"paused": {
+			routine: Routine{Ramp: wakeUp, StartedAt: start, PausedAt: start.Add(2 * time.Minute)},
+			now:     start.Add(10 * time.Minute),
+			want:    2 * time.Minute,
+		},
+		"over": {
+			routine: Routine{Ramp: wakeUp, StartedAt: start},
+			now:     start.Add(time.Hour),
+			want:    30 * time.Minute,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := tc.routine.Elapsed(tc.now); got != tc.want {
+				t.Errorf("Elapsed does not match: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hikari", routinesFile)
+	f := controller.NewFake(shelf)
+	rec := controller.NewRecorder(f)
+	r, err := NewRunner(rec, controller.DefaultRetryPolicy, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Start(shelf, wakeUp); err != nil {
+		t.Fatal(err)
+	}
+
+	// The device is set to the start of the ramp and powered on before the routine starts.
+	var sent []uint16
+	for _, c := range rec.Calls()[:2] {
+		sent = append(sent, c.Payload.PayloadType())
+	}
+	if want := []uint16{uint16(packets.PayloadTypeLightSetColor), uint16(packets.PayloadTypeDeviceSetPower)}; !slices.Equal(sent, want) {
+		t.Errorf("Sent messages do not match: got %v, want %v", sent, want)
+	}
+	if d := f.GetDevices()[0]; !d.PoweredOn {
+		t.Errorf("Expected %s to be powered on", d.Label)
+	}
+
+	if err := r.Pause(shelf.Serial); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	// A routine left running is resumed from the file, paused where it was.
+	r, err = NewRunner(rec, controller.DefaultRetryPolicy, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	rt, ok := r.Get(shelf.Serial)
+	if !ok || !rt.Paused() || rt.Ramp != wakeUp {
+		t.Fatalf("Resumed routine does not match: got %+v (%t)", rt, ok)
+	}
+	if err := r.Resume(shelf.Serial); err != nil {
+		t.Fatal(err)
+	}
+	if rt, _ := r.Get(shelf.Serial); rt.Paused() {
+		t.Errorf("Expected routine to be resumed")
+	}
+
+	if err := r.Cancel(shelf.Serial); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Cancel(shelf.Serial); !errors.Is(err, ErrNoRoutine) {
+		t.Errorf("Error does not match: got %v, want %v", err, ErrNoRoutine)
+	}
+	var file File
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &file); err != nil || len(file.Routines) != 0 {
+		t.Errorf("Expected no routines in the file, got %s (%v)", b, err)
+	}
+}
+
+func TestRunnerPowerOff(t *testing.T) {
+	f := controller.NewFake(shelf)
+	r, err := NewRunner(f, controller.DefaultRetryPolicy, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	windDown := Ramp{FromBrightness: 50, FromKelvin: 2700, ToBrightness: 1, ToKelvin: 2000, Duration: 50 * time.Millisecond, Curve: CurveEaseOut, PowerOff: true}
+	if err := r.Start(shelf, windDown); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for _, ok := r.Get(shelf.Serial); ok; _, ok = r.Get(shelf.Serial) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected routine to be over")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	d := f.GetDevices()[0]
+	if d.PoweredOn || d.Color.Kelvin != 2000 {
+		t.Errorf("Device does not match: got powered on %t at %dK, want powered off at 2000K", d.PoweredOn, d.Color.Kelvin)
+	}
+}
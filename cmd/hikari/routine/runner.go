@@ -0,0 +1,346 @@
+package routine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/messages"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+)
+
+// FileVersion is the version of the routines file format.
+const FileVersion = 1
+
+const (
+	appDir       = "hikari"
+	routinesFile = "routines.json"
+	filePerm     = 0o644
+	// stepInterval is the length of the transitions a ramp is made of, short enough for curves to look smooth
+	// and for a resumed routine to catch up quickly.
+	stepInterval = time.Minute
+)
+
+// ErrNoRoutine is returned when pausing, resuming or cancelling a device without a routine.
+var ErrNoRoutine = errors.New("no routine running")
+
+// File is the on-disk format of the running routines:
+//
+//	{
+//	  "version": 1,
+//	  "routines": [
+//	    {
+//	      "serial": "d073d5000001",
+//	      "label": "Bedroom",
+//	      "from_brightness": 1, "from_kelvin": 2000,
+//	      "to_brightness": 80, "to_kelvin": 4000,
+//	      "duration": 1800000000000,
+//	      "curve": "linear",
+//	      "started_at": "2025-01-01T06:30:00+11:00"
+//	    }
+//	  ]
+//	}
+type File struct {
+	Version  int       `json:"version"`
+	Routines []Routine `json:"routines"`
+}
+
+// Runner runs routines on the devices of a controller, persisting them to a file
+// so that the routines left running are resumed when the next Runner opens it.
+type Runner struct {
+	c      controller.Controller
+	policy controller.RetryPolicy
+	path   string
+	ctx    context.Context
+	stop   context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	routines map[string]*running
+}
+
+// running is a routine with the channel waking up its goroutine when it is paused, resumed or cancelled.
+type running struct {
+	Routine
+	wake chan struct{}
+}
+
+// DefaultPath returns the path of the routines file of a process in the user config directory,
+// e.g. $XDG_CONFIG_HOME/hikari/routines.json on Linux for the TUI, or schedule_routines.json for process "schedule",
+// so that processes running at the same time do not resume each other's routines.
+func DefaultPath(process string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	name := routinesFile
+	if process != "" {
+		name = process + "_" + routinesFile
+	}
+	return filepath.Join(dir, appDir, name), nil
+}
+
+// NewRunner returns a Runner persisting routines to path, or only keeping them in memory if path is empty,
+// and resumes the routines left running in it. A missing file is treated as no routines.
+func NewRunner(c controller.Controller, policy controller.RetryPolicy, path string) (*Runner, error) {
+	r := &Runner{
+		c:        c,
+		policy:   policy,
+		path:     path,
+		routines: make(map[string]*running),
+	}
+	r.ctx, r.stop = context.WithCancel(context.Background())
+	if path == "" {
+		return r, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f File
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if f.Version != FileVersion {
+		return nil, fmt.Errorf("%s: unsupported routines file version %d", path, f.Version)
+	}
+
+	for _, rt := range f.Routines {
+		if err := rt.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: routine of %s: %w", path, rt.Serial, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rt := range f.Routines {
+		r.start(rt)
+	}
+	return r, nil
+}
+
+// Start sets the device to the start of the ramp, powers it on and runs the ramp in the background,
+// replacing any routine running on the device.
+func (r *Runner) Start(d ldevice.Device, ramp Ramp) error {
+	if err := ramp.Validate(); err != nil {
+		return err
+	}
+	brightness, kelvin := ramp.At(0)
+	if err := r.deliver(context.Background(), d.Serial, setColor(brightness, kelvin, 0)); err != nil {
+		return err
+	}
+	if !d.PoweredOn {
+		if err := r.deliver(context.Background(), d.Serial, messages.SetPowerOn()); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if old, ok := r.routines[d.Serial.String()]; ok {
+		delete(r.routines, d.Serial.String())
+		close(old.wake)
+	}
+	r.start(Routine{Ramp: ramp, Serial: d.Serial.String(), Label: d.Label, StartedAt: time.Now()})
+	return r.persist()
+}
+
+// Get returns the routine running on the device.
+func (r *Runner) Get(serial ldevice.Serial) (Routine, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.routines[serial.String()]
+	if !ok {
+		return Routine{}, false
+	}
+	return rt.Routine, true
+}
+
+// Pause holds the device at the current point of its routine.
+func (r *Runner) Pause(serial ldevice.Serial) error {
+	return r.update(serial, func(rt *Routine, now time.Time) {
+		if !rt.Paused() {
+			rt.PausedAt = now
+		}
+	})
+}
+
+// Resume continues the paused routine of the device from where it was paused.
+func (r *Runner) Resume(serial ldevice.Serial) error {
+	return r.update(serial, func(rt *Routine, now time.Time) {
+		if rt.Paused() {
+			rt.PausedFor += now.Sub(rt.PausedAt)
+			rt.PausedAt = time.Time{}
+		}
+	})
+}
+
+// Cancel stops the routine of the device, holding it at the current point.
+func (r *Runner) Cancel(serial ldevice.Serial) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.routines[serial.String()]
+	if !ok {
+		return ErrNoRoutine
+	}
+	delete(r.routines, serial.String())
+	close(rt.wake)
+	return r.persist()
+}
+
+// Close stops running routines without cancelling them, so that they are resumed by the next Runner.
+func (r *Runner) Close() {
+	r.stop()
+	r.wg.Wait()
+}
+
+func (r *Runner) update(serial ldevice.Serial, fn func(rt *Routine, now time.Time)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.routines[serial.String()]
+	if !ok {
+		return ErrNoRoutine
+	}
+	fn(&rt.Routine, time.Now())
+	select {
+	case rt.wake <- struct{}{}:
+	default:
+	}
+	return r.persist()
+}
+
+// start runs the routine in the background. It must be called with the lock held.
+func (r *Runner) start(rt Routine) {
+	entry := &running{Routine: rt, wake: make(chan struct{}, 1)}
+	r.routines[rt.Serial] = entry
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.run(entry)
+	}()
+}
+
+// run sends a transition to the point of the ramp at the end of every step until the routine is over,
+// holding the device at the current point when the routine is paused or cancelled.
+func (r *Runner) run(entry *running) {
+	ctx := r.ctx
+	var waitFor <-chan time.Time
+	for {
+		r.mu.Lock()
+		rt := entry.Routine
+		current, ok := r.routines[entry.Serial]
+		r.mu.Unlock()
+		if current != entry && ok {
+			// Replaced by another routine on the same device.
+			return
+		}
+		cancelled := current != entry
+
+		now := time.Now()
+		elapsed := rt.Elapsed(now)
+		var err error
+		switch {
+		case cancelled:
+			// Hold the current point even if the runner is closing, e.g. when interrupted right after cancelling.
+			brightness, kelvin := rt.At(rt.Progress(now))
+			r.send(context.Background(), rt.Serial, setColor(brightness, kelvin, 0))
+			return
+		case rt.Paused():
+			brightness, kelvin := rt.At(rt.Progress(now))
+			err = r.send(ctx, rt.Serial, setColor(brightness, kelvin, 0))
+			waitFor = nil
+		case elapsed >= rt.Duration:
+			if rt.PowerOff {
+				r.send(ctx, rt.Serial, messages.SetPowerOff())
+			}
+			r.finish(entry)
+			return
+		default:
+			next := min(elapsed+stepInterval, rt.Duration)
+			brightness, kelvin := rt.At(float64(next) / float64(rt.Duration))
+			err = r.send(ctx, rt.Serial, setColor(brightness, kelvin, next-elapsed))
+			waitFor = time.After(next - elapsed)
+		}
+		r.setErr(entry, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-entry.wake:
+		case <-waitFor:
+		}
+	}
+}
+
+// finish removes the routine once over, unless it was cancelled in the meantime.
+func (r *Runner) finish(entry *running) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.routines[entry.Serial] != entry {
+		return
+	}
+	delete(r.routines, entry.Serial)
+	r.persist()
+}
+
+func (r *Runner) setErr(entry *running, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.Err = ""
+	if err != nil {
+		entry.Err = err.Error()
+	}
+}
+
+// send delivers msg to the device with the given serial once discovered.
+func (r *Runner) send(ctx context.Context, serial string, msg *protocol.Message) error {
+	devices := r.c.GetDevices()
+	i := slices.IndexFunc(devices, func(d ldevice.Device) bool { return d.Serial.String() == serial })
+	if i < 0 {
+		return fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, serial)
+	}
+	return r.deliver(ctx, devices[i].Serial, msg)
+}
+
+func (r *Runner) deliver(ctx context.Context, serial ldevice.Serial, msg *protocol.Message) error {
+	return controller.Deliver(ctx, r.c, serial, r.policy, msg)
+}
+
+// persist atomically writes the routines to the file, if any. It must be called with the lock held.
+func (r *Runner) persist() error {
+	if r.path == "" {
+		return nil
+	}
+	f := File{Version: FileVersion, Routines: make([]Routine, 0, len(r.routines))}
+	for _, rt := range r.routines {
+		f.Routines = append(f.Routines, rt.Routine)
+	}
+	slices.SortFunc(f.Routines, func(a, b Routine) int { return strings.Compare(a.Serial, b.Serial) })
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(r.path, append(b, '\n'), filePerm)
+}
+
+// setColor returns a message setting the light to white at the brightness and kelvin over the transition.
+func setColor(brightness float64, kelvin uint16, transition time.Duration) *protocol.Message {
+	saturation := 0.0
+	return messages.SetColor(nil, &saturation, &brightness, &kelvin, transition, enums.LightWaveformLIGHTWAVEFORMSAW)
+}
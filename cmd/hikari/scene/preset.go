@@ -0,0 +1,94 @@
+package scene
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+)
+
+// ErrMixedColors is returned when a preset is saved from devices that do not share the same color.
+var ErrMixedColors = errors.New("devices have different colors")
+
+// Preset is a named color that is not tied to any device and can be recalled on any of them.
+type Preset struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Color     HSBK      `json:"color"`
+}
+
+// Recall sets the preset color and powers the device on with the given transition duration using send.
+func (p Preset) Recall(duration time.Duration, send func(*protocol.Message) error) error {
+	return DeviceState{PoweredOn: true, Color: p.Color}.Recall(duration, send)
+}
+
+// SavePreset stores the preset in the library, replacing any preset with the same name.
+func SavePreset(p Preset) error {
+	library.Lock()
+	defer library.Unlock()
+	library.presets[p.Name] = p
+	return persist()
+}
+
+// GetPreset returns the preset with the given name.
+func GetPreset(name string) (Preset, bool) {
+	library.RLock()
+	defer library.RUnlock()
+	p, ok := library.presets[name]
+	return p, ok
+}
+
+// PresetNames returns the names of all saved presets in alphabetical order.
+func PresetNames() []string {
+	library.RLock()
+	defer library.RUnlock()
+	names := make([]string, 0, len(library.presets))
+	for name := range library.presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// PresetDraft collects the color of a preset being saved from its target devices.
+type PresetDraft struct {
+	mu     sync.Mutex
+	preset Preset
+	added  int
+	mixed  bool
+}
+
+// NewPresetDraft returns an empty draft of the named preset.
+func NewPresetDraft(name string) *PresetDraft {
+	return &PresetDraft{preset: Preset{Name: name}}
+}
+
+// Add adds the color of a target device to the draft.
+func (d *PresetDraft) Add(c HSBK) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.added > 0 && c != d.preset.Color {
+		d.mixed = true
+	}
+	d.preset.Color = c
+	d.added++
+}
+
+// Save stores the preset in the library, replacing any preset with the same name.
+// The library is left untouched when no color was added, and ErrMixedColors is returned
+// when the target devices did not share the same color.
+func (d *PresetDraft) Save() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mixed {
+		return ErrMixedColors
+	}
+	if d.added == 0 {
+		return nil
+	}
+	p := d.preset
+	p.CreatedAt = time.Now()
+	return SavePreset(p)
+}
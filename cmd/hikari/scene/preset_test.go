@@ -0,0 +1,59 @@
+package scene
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPresetDraft(t *testing.T) {
+	if err := Open(filepath.Join(t.TempDir(), libraryFile), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	old := Preset{Name: "reading", Color: HSBK{Hue: 40, Saturation: 20, Brightness: 80, Kelvin: 4000}}
+	red := HSBK{Saturation: 100, Brightness: 100, Kelvin: 3500}
+	blue := HSBK{Hue: 240, Saturation: 100, Brightness: 100, Kelvin: 3500}
+
+	testCases := map[string]struct {
+		colors    []HSBK
+		wantErr   error
+		wantColor HSBK
+	}{
+		"single device": {
+			colors:    []HSBK{red},
+			wantColor: red,
+		},
+		"devices with the same color": {
+			colors:    []HSBK{red, red},
+			wantColor: red,
+		},
+		"devices with different colors": {
+			colors:    []HSBK{red, blue},
+			wantErr:   ErrMixedColors,
+			wantColor: old.Color,
+		},
+		"no device": {
+			wantColor: old.Color,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := SavePreset(old); err != nil {
+				t.Fatal(err)
+			}
+			d := NewPresetDraft(old.Name)
+			for _, c := range tc.colors {
+				d.Add(c)
+			}
+			if err := d.Save(); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+			}
+
+			p, _ := GetPreset(old.Name)
+			if p.Color != tc.wantColor {
+				t.Errorf("Color does not match: got %+v, want %+v", p.Color, tc.wantColor)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package scene
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/messages"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+const (
+	tileColors    = 64
+	defaultKelvin = 3500
+)
+
+// Scene is a named snapshot of the state of a set of devices, keyed by serial.
+type Scene struct {
+	Name      string                 `json:"name"`
+	CreatedAt time.Time              `json:"created_at"`
+	Devices   map[string]DeviceState `json:"devices"`
+}
+
+// DeviceState is the state of a single device in a scene.
+type DeviceState struct {
+	Label     string       `json:"label"`
+	PoweredOn bool         `json:"powered_on"`
+	Color     HSBK         `json:"color"`
+	Matrix    *MatrixState `json:"matrix,omitempty"`
+}
+
+// MatrixState holds the colors of every tile of a matrix device.
+type MatrixState struct {
+	Width int      `json:"width"`
+	Tiles [][]HSBK `json:"tiles"`
+}
+
+// HSBK is a color in user units: hue in degrees, saturation and brightness in percent.
+type HSBK struct {
+	Hue        float64 `json:"hue"`
+	Saturation float64 `json:"saturation"`
+	Brightness float64 `json:"brightness"`
+	Kelvin     uint16  `json:"kelvin"`
+}
+
+// Querier requests state from devices.
+type Querier interface {
+	Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error)
+}
+
+// Device returns the state of the device with the given serial,
+// falling back to a device with the same label, e.g. after a device was replaced.
+// When several devices share the label, the one with the lowest serial is used.
+func (s Scene) Device(serial, label string) (DeviceState, bool) {
+	if d, ok := s.Devices[serial]; ok {
+		return d, true
+	}
+	if label == "" {
+		return DeviceState{}, false
+	}
+	for _, k := range slices.Sorted(maps.Keys(s.Devices)) {
+		if d := s.Devices[k]; d.Label == label {
+			return d, true
+		}
+	}
+	return DeviceState{}, false
+}
+
+// Capture snapshots the state of a device. Power and color are taken from the last known
+// device state while the tile colors of matrix devices are queried from the device.
+func Capture(ctx context.Context, q Querier, d ldevice.Device) (DeviceState, error) {
+	state := DeviceState{
+		Label:     d.Label,
+		PoweredOn: d.PoweredOn,
+		Color: HSBK{
+			Hue:        d.Color.Hue,
+			Saturation: d.Color.Saturation,
+			Brightness: d.Color.Brightness,
+			Kelvin:     uint16(d.Color.Kelvin),
+		},
+	}
+	if d.LightType != ldevice.LightTypeMatrix {
+		return state, nil
+	}
+
+	mProps := d.MatrixProperties
+	payload := &packets.TileGet64{
+		Length: uint8(mProps.ChainLength),
+		Rect:   packets.TileBufferRect{Width: uint8(mProps.Width)},
+	}
+	responses, err := q.Query(ctx, d.Serial, payload, uint16(packets.PayloadTypeTileState64), int(mProps.ChainLength))
+	if err != nil {
+		return state, fmt.Errorf("failed to read tile colors: %w", err)
+	}
+
+	state.Matrix = &MatrixState{Width: int(mProps.Width), Tiles: make([][]HSBK, len(responses))}
+	for _, r := range responses {
+		tile, ok := r.(*packets.TileState64)
+		if !ok {
+			return state, fmt.Errorf("failed to read tile colors: unexpected response %T", r)
+		}
+		if int(tile.TileIndex) >= len(responses) {
+			return state, fmt.Errorf("unexpected tile index %d", tile.TileIndex)
+		}
+		colors := make([]HSBK, tileColors)
+		for i, c := range tile.Colors {
+			// Pixels that were never set report no kelvin, default them so that the scene stays valid.
+			if c.Kelvin == 0 {
+				c.Kelvin = defaultKelvin
+			}
+			colors[i] = FromLightHsbk(c)
+		}
+		state.Matrix.Tiles[tile.TileIndex] = colors
+	}
+	return state, nil
+}
+
+// Recall restores the device state with the given transition duration using send.
+func (s DeviceState) Recall(duration time.Duration, send func(*protocol.Message) error) error {
+	for _, msg := range s.Messages(duration) {
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Messages returns the messages restoring the device state with the given transition duration.
+func (s DeviceState) Messages(duration time.Duration) []*protocol.Message {
+	if !s.PoweredOn {
+		return []*protocol.Message{messages.SetPowerOff()}
+	}
+
+	c := s.Color
+	msgs := []*protocol.Message{
+		messages.SetColor(&c.Hue, &c.Saturation, &c.Brightness, &c.Kelvin, duration, enums.LightWaveformLIGHTWAVEFORMSAW),
+	}
+	if s.Matrix != nil {
+		for i, tile := range s.Matrix.Tiles {
+			var colors [tileColors]packets.LightHsbk
+			for j := range min(len(tile), tileColors) {
+				colors[j] = tile[j].LightHsbk()
+			}
+			msgs = append(msgs, protocol.NewMessage(&packets.TileSet64{
+				TileIndex: uint8(i),
+				Length:    1,
+				Rect:      packets.TileBufferRect{Width: uint8(s.Matrix.Width)},
+				Duration:  uint32(duration.Milliseconds()),
+				Colors:    colors,
+			}))
+		}
+	}
+	return append(msgs, messages.SetPowerOn())
+}
+
+// LightHsbk converts the color to protocol units.
+func (c HSBK) LightHsbk() packets.LightHsbk {
+	return packets.LightHsbk{
+		Hue:        uint16(math.Round(c.Hue / 360 * math.MaxUint16)),
+		Saturation: uint16(math.Round(c.Saturation / 100 * math.MaxUint16)),
+		Brightness: uint16(math.Round(c.Brightness / 100 * math.MaxUint16)),
+		Kelvin:     c.Kelvin,
+	}
+}
+
+// FromLightHsbk converts a color in protocol units to user units.
+func FromLightHsbk(c packets.LightHsbk) HSBK {
+	return HSBK{
+		Hue:        float64(c.Hue) / math.MaxUint16 * 360,
+		Saturation: float64(c.Saturation) / math.MaxUint16 * 100,
+		Brightness: float64(c.Brightness) / math.MaxUint16 * 100,
+		Kelvin:     c.Kelvin,
+	}
+}
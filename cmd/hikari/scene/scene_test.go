@@ -0,0 +1,84 @@
+package scene
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestDevice(t *testing.T) {
+	s := Scene{Devices: map[string]DeviceState{
+		"d073d5000003": {Label: "Kitchen", Color: HSBK{Kelvin: 4000}},
+		"d073d5000001": {Label: "Kitchen", Color: HSBK{Kelvin: 2700}},
+		"d073d5000002": {Label: "Lounge", Color: HSBK{Kelvin: 3500}},
+		"d073d5000004": {Color: HSBK{Kelvin: 5000}},
+	}}
+
+	testCases := map[string]struct {
+		serial     string
+		label      string
+		wantFound  bool
+		wantKelvin uint16
+	}{
+		"serial": {
+			serial:     "d073d5000003",
+			label:      "Lounge",
+			wantFound:  true,
+			wantKelvin: 4000,
+		},
+		"label fallback": {
+			serial:     "d073d5000009",
+			label:      "Lounge",
+			wantFound:  true,
+			wantKelvin: 3500,
+		},
+		"duplicate label uses lowest serial": {
+			serial:     "d073d5000009",
+			label:      "Kitchen",
+			wantFound:  true,
+			wantKelvin: 2700,
+		},
+		"empty label": {
+			serial: "d073d5000009",
+		},
+		"unknown label": {
+			serial: "d073d5000009",
+			label:  "Garage",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// Map iteration order is random, repeat to catch nondeterministic matches.
+			for range 20 {
+				d, ok := s.Device(tc.serial, tc.label)
+				if ok != tc.wantFound {
+					t.Fatalf("Found does not match: got %t, want %t", ok, tc.wantFound)
+				}
+				if d.Color.Kelvin != tc.wantKelvin {
+					t.Fatalf("Kelvin does not match: got %d, want %d", d.Color.Kelvin, tc.wantKelvin)
+				}
+			}
+		})
+	}
+}
+
+func TestCaptureUnexpectedResponse(t *testing.T) {
+	q := querierFunc(func(context.Context, ldevice.Serial, packets.Payload, uint16, int) ([]packets.Payload, error) {
+		return []packets.Payload{&packets.LightState{}}, nil
+	})
+	tiles := testdevice.Tiles
+	tiles.MatrixProperties.ChainLength = 1
+	if _, err := Capture(context.Background(), q, tiles); err == nil {
+		t.Error("Expected an error on an unexpected response")
+	}
+}
+
+type querierFunc func(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error)
+
+func (f querierFunc) Query(ctx context.Context, serial ldevice.Serial, payload packets.Payload, respType uint16, count int) ([]packets.Payload, error) {
+	return f(ctx, serial, payload, respType, count)
+}
@@ -0,0 +1,275 @@
+package scene
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+// FileVersion is the version of the scene library file format.
+const FileVersion = 1
+
+const (
+	appDir      = "hikari"
+	libraryFile = "scenes.json"
+	libraryPerm = 0o644
+)
+
+// File is the on-disk format of the scene library, which holds scenes and presets:
+//
+//	{
+//	  "version": 1,
+//	  "scenes": [
+//	    {
+//	      "name": "evening",
+//	      "created_at": "2025-01-01T20:00:00Z",
+//	      "devices": {
+//	        "d073d5000001": {
+//	          "label": "Kitchen",
+//	          "powered_on": true,
+//	          "color": {"hue": 30, "saturation": 60, "brightness": 40, "kelvin": 2700}
+//	        }
+//	      }
+//	    }
+//	  ],
+//	  "presets": [
+//	    {
+//	      "name": "reading",
+//	      "created_at": "2025-01-01T21:00:00Z",
+//	      "color": {"hue": 40, "saturation": 20, "brightness": 80, "kelvin": 4000}
+//	    }
+//	  ]
+//	}
+//
+// Devices are keyed by serial, the label is used as a fallback when no device has that serial.
+// Matrix devices additionally hold a "matrix" object with the tile "width" and the colors of every tile in "tiles".
+// Presets are not tied to any device.
+type File struct {
+	Version int      `json:"version"`
+	Scenes  []Scene  `json:"scenes"`
+	Presets []Preset `json:"presets,omitempty"`
+}
+
+// ValidateFunc checks a scene before it is added to the library.
+type ValidateFunc func(Scene) error
+
+// ValidatePresetFunc checks a preset before it is added to the library.
+type ValidatePresetFunc func(Preset) error
+
+var library = struct {
+	sync.RWMutex
+	scenes         map[string]Scene
+	presets        map[string]Preset
+	path           string
+	validate       ValidateFunc
+	validatePreset ValidatePresetFunc
+}{scenes: make(map[string]Scene), presets: make(map[string]Preset)}
+
+// DefaultPath returns the path of the scene library in the user config directory,
+// e.g. $XDG_CONFIG_HOME/hikari/scenes.json on Linux.
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDir, libraryFile), nil
+}
+
+// Open loads the library from path, validating every scene and preset, and persists any further change to it.
+// A missing file is treated as an empty library.
+func Open(path string, validate ValidateFunc, validatePreset ValidatePresetFunc) error {
+	library.Lock()
+	defer library.Unlock()
+
+	library.path = path
+	library.validate = validate
+	library.validatePreset = validatePreset
+
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	lf, err := decode(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	merge(lf)
+	return nil
+}
+
+// Save stores the scene in the library, replacing any scene with the same name.
+func Save(s Scene) error {
+	library.Lock()
+	defer library.Unlock()
+	library.scenes[s.Name] = s
+	return persist()
+}
+
+// Draft collects the device states of a scene being captured, so that a scene with the same name
+// is only replaced once every device was captured.
+type Draft struct {
+	mu     sync.Mutex
+	scene  Scene
+	failed bool
+}
+
+// NewDraft returns an empty draft of the named scene.
+func NewDraft(name string) *Draft {
+	return &Draft{scene: Scene{Name: name, Devices: make(map[string]DeviceState)}}
+}
+
+// Capture snapshots the state of the device into the draft. A failed capture prevents the draft from being saved.
+func (d *Draft) Capture(ctx context.Context, q Querier, dev ldevice.Device) error {
+	state, err := Capture(ctx, q, dev)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err != nil {
+		d.failed = true
+		return err
+	}
+	d.scene.Devices[dev.Serial.String()] = state
+	return nil
+}
+
+// Save stores the captured scene in the library, replacing any scene with the same name.
+// The library is left untouched when a capture failed or no device was captured.
+func (d *Draft) Save() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.failed || len(d.scene.Devices) == 0 {
+		return nil
+	}
+	s := d.scene
+	s.CreatedAt = time.Now()
+	return Save(s)
+}
+
+// Get returns the scene with the given name.
+func Get(name string) (Scene, bool) {
+	library.RLock()
+	defer library.RUnlock()
+	s, ok := library.scenes[name]
+	return s, ok
+}
+
+// Names returns the names of all saved scenes in alphabetical order.
+func Names() []string {
+	library.RLock()
+	defer library.RUnlock()
+	names := make([]string, 0, len(library.scenes))
+	for name := range library.scenes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Export writes the library to w in the library file format.
+func Export(w io.Writer) error {
+	library.RLock()
+	defer library.RUnlock()
+	return encode(w)
+}
+
+// Import validates the scenes and presets read from r and merges them into the library,
+// replacing scenes and presets with the same name. It returns the number of imported scenes and presets.
+func Import(r io.Reader) (scenes, presets int, err error) {
+	library.Lock()
+	defer library.Unlock()
+
+	f, err := decode(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	merge(f)
+	return len(f.Scenes), len(f.Presets), persist()
+}
+
+// decode reads and validates a library file. It must be called with the library lock held.
+func decode(r io.Reader) (File, error) {
+	var f File
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return File{}, err
+	}
+	if f.Version != FileVersion {
+		return File{}, fmt.Errorf("unsupported scene file version %d", f.Version)
+	}
+	for _, s := range f.Scenes {
+		if library.validate == nil {
+			continue
+		}
+		if err := library.validate(s); err != nil {
+			return File{}, fmt.Errorf("scene %s: %w", s.Name, err)
+		}
+	}
+	for _, p := range f.Presets {
+		if library.validatePreset == nil {
+			continue
+		}
+		if err := library.validatePreset(p); err != nil {
+			return File{}, fmt.Errorf("preset %s: %w", p.Name, err)
+		}
+	}
+	return f, nil
+}
+
+// merge adds the scenes and presets of f to the library. It must be called with the library lock held.
+func merge(f File) {
+	for _, s := range f.Scenes {
+		library.scenes[s.Name] = s
+	}
+	for _, p := range f.Presets {
+		library.presets[p.Name] = p
+	}
+}
+
+// encode writes the library. It must be called with the library lock held.
+func encode(w io.Writer) error {
+	f := File{Version: FileVersion, Scenes: make([]Scene, 0, len(library.scenes))}
+	for _, s := range library.scenes {
+		f.Scenes = append(f.Scenes, s)
+	}
+	slices.SortFunc(f.Scenes, func(a, b Scene) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, p := range library.presets {
+		f.Presets = append(f.Presets, p)
+	}
+	slices.SortFunc(f.Presets, func(a, b Preset) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// persist atomically writes the library to its path, if any. It must be called with the library lock held.
+func persist() error {
+	if library.path == "" {
+		return nil
+	}
+	var b bytes.Buffer
+	if err := encode(&b); err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(library.path, b.Bytes(), libraryPerm)
+}
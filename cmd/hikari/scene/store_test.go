@@ -0,0 +1,136 @@
+package scene
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestImportExport(t *testing.T) {
+	if err := Open(filepath.Join(t.TempDir(), libraryFile), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := map[string]struct {
+		input       string
+		wantErr     bool
+		wantScenes  int
+		wantPresets int
+	}{
+		"valid library": {
+			input:      `{"version": 1, "scenes": [{"name": "evening", "devices": {"d073d5000001": {"label": "Kitchen", "powered_on": true, "color": {"hue": 30, "saturation": 60, "brightness": 40, "kelvin": 2700}}}}]}`,
+			wantScenes: 1,
+		},
+		"library with presets": {
+			input:       `{"version": 1, "scenes": [], "presets": [{"name": "reading", "color": {"hue": 40, "saturation": 20, "brightness": 80, "kelvin": 4000}}]}`,
+			wantPresets: 1,
+		},
+		"unsupported version": {
+			input:   `{"version": 2, "scenes": []}`,
+			wantErr: true,
+		},
+		"malformed json": {
+			input:   `{"version": 1, "scenes": [`,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			scenes, presets, err := Import(strings.NewReader(tc.input))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if scenes != tc.wantScenes || presets != tc.wantPresets {
+				t.Errorf("Expected %d imported scenes and %d presets, got %d and %d", tc.wantScenes, tc.wantPresets, scenes, presets)
+			}
+		})
+	}
+
+	s, ok := Get("evening")
+	if !ok {
+		t.Fatal("Expected scene evening to be imported")
+	}
+	if d, ok := s.Device("d073d5000002", "Kitchen"); !ok || d.Color.Kelvin != 2700 {
+		t.Errorf("Expected label fallback to find Kitchen, got %+v", d)
+	}
+
+	if p, ok := GetPreset("reading"); !ok || p.Color.Kelvin != 4000 {
+		t.Errorf("Expected preset reading to be imported, got %+v", p)
+	}
+
+	var b bytes.Buffer
+	if err := Export(&b); err != nil {
+		t.Fatal(err)
+	}
+	exported := b.String()
+	library.validatePreset = func(Preset) error { return errors.New("invalid") }
+	if _, _, err := Import(strings.NewReader(exported)); err == nil {
+		t.Error("Expected exported presets to be rejected by validator")
+	}
+	library.validate = func(Scene) error { return errors.New("invalid") }
+	if _, _, err := Import(strings.NewReader(exported)); err == nil {
+		t.Error("Expected exported library to be rejected by validator")
+	}
+}
+
+func TestDraft(t *testing.T) {
+	if err := Open(filepath.Join(t.TempDir(), libraryFile), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	kitchen, tiles := testdevice.Kitchen, testdevice.Tiles
+	old := Scene{Name: "evening", Devices: map[string]DeviceState{kitchen.Serial.String(): {Label: "Kitchen"}}}
+
+	testCases := map[string]struct {
+		devices     []ldevice.Device
+		queryErr    error
+		wantDevices int
+	}{
+		"all captured": {
+			devices:     []ldevice.Device{kitchen, tiles},
+			wantDevices: 2,
+		},
+		"capture failed": {
+			devices:     []ldevice.Device{kitchen, tiles},
+			queryErr:    context.DeadlineExceeded,
+			wantDevices: 1,
+		},
+		"nothing captured": {
+			wantDevices: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if err := Save(old); err != nil {
+				t.Fatal(err)
+			}
+			q := querierFunc(func(_ context.Context, _ ldevice.Serial, _ packets.Payload, _ uint16, count int) ([]packets.Payload, error) {
+				var responses []packets.Payload
+				for i := range count {
+					responses = append(responses, &packets.TileState64{TileIndex: uint8(i)})
+				}
+				return responses, tc.queryErr
+			})
+			d := NewDraft(old.Name)
+			for _, dev := range tc.devices {
+				d.Capture(context.Background(), q, dev)
+			}
+			if err := d.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			s, _ := Get(old.Name)
+			if len(s.Devices) != tc.wantDevices {
+				t.Errorf("Devices do not match: got %d, want %d", len(s.Devices), tc.wantDevices)
+			}
+		})
+	}
+}
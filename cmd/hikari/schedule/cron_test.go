@@ -0,0 +1,109 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// Wednesday 1 January 2025.
+	start := time.Date(2025, 1, 1, 20, 0, 30, 0, time.UTC)
+	testCases := map[string]struct {
+		expr    string
+		want    time.Time
+		wantErr string
+	}{
+		"every minute": {
+			expr: "* * * * *",
+			want: time.Date(2025, 1, 1, 20, 1, 0, 0, time.UTC),
+		},
+		"step": {
+			expr: "*/15 * * * *",
+			want: time.Date(2025, 1, 1, 20, 15, 0, 0, time.UTC),
+		},
+		"next day": {
+			expr: "30 7 * * *",
+			want: time.Date(2025, 1, 2, 7, 30, 0, 0, time.UTC),
+		},
+		"weekend by name": {
+			expr: "0 7 * * sat,sun",
+			want: time.Date(2025, 1, 4, 7, 0, 0, 0, time.UTC),
+		},
+		"sunday as 7": {
+			expr: "0 7 * * 7",
+			want: time.Date(2025, 1, 5, 7, 0, 0, 0, time.UTC),
+		},
+		"list and range": {
+			expr: "0 8-9,22 * * *",
+			want: time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC),
+		},
+		"day of month or day of week": {
+			expr: "0 12 15 * fri",
+			want: time.Date(2025, 1, 3, 12, 0, 0, 0, time.UTC),
+		},
+		"month by name": {
+			expr: "0 0 1 mar *",
+			want: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"leap day": {
+			expr: "0 0 29 2 *",
+			want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		"shorthand": {
+			expr: "@monthly",
+			want: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		"never": {
+			expr: "0 0 31 2 *",
+		},
+		"too few fields": {
+			expr:    "0 7 * *",
+			wantErr: "cron expression must have 5 fields, got 4",
+		},
+		"out of range": {
+			expr:    "60 * * * *",
+			wantErr: `minute: invalid value "60", must be between 0 and 59`,
+		},
+		"invalid step": {
+			expr:    "*/0 * * * *",
+			wantErr: `minute: invalid step "0"`,
+		},
+		"inverted range": {
+			expr:    "0 0 * * fri-mon",
+			wantErr: `day of week: invalid range "fri-mon"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c, err := ParseCron(tc.expr)
+			if err != nil && err.Error() != tc.wantErr || err == nil && tc.wantErr != "" {
+				t.Fatalf("Error does not match: got %v, want %q", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, ok := c.Next(start)
+			if ok != !tc.want.IsZero() || !got.Equal(tc.want) {
+				t.Errorf("Next does not match: got %v (%t), want %v", got, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestCronNextDaylightSaving(t *testing.T) {
+	sydney, err := time.LoadLocation("Australia/Sydney")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	c, err := ParseCron("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Clocks go forward from 2:00 to 3:00 on 5 October 2025, skipping 2:30.
+	got, _ := c.Next(time.Date(2025, 10, 4, 12, 0, 0, 0, sydney))
+	if want := time.Date(2025, 10, 6, 2, 30, 0, 0, sydney); !got.Equal(want) {
+		t.Errorf("Next does not match: got %v, want %v", got, want)
+	}
+}
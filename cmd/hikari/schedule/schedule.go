@@ -0,0 +1,406 @@
+// Package schedule runs commands on devices on cron expressions and at sunrise and sunset,
+// and keeps the result of the last run of every schedule.
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/utils"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/routine"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+)
+
+// StateVersion is the version of the state file format.
+const StateVersion = 1
+
+const (
+	appDir    = "hikari"
+	stateFile = "schedule_state.json"
+	statePerm = 0o644
+	// maxWait is the longest the scheduler sleeps before checking the wall clock again,
+	// so that runs are not delayed by suspends or clock changes.
+	maxWait = time.Minute
+)
+
+// State is the on-disk format of the results of the last runs, keyed by schedule name:
+//
+//	{
+//	  "version": 1,
+//	  "results": {
+//	    "evening": {"time": "2025-01-01T19:42:00+11:00", "delivered": 2, "devices": 2}
+//	  }
+//	}
+type State struct {
+	Version int               `json:"version"`
+	Results map[string]Result `json:"results"`
+}
+
+// Result is the outcome of running a schedule.
+type Result struct {
+	Time time.Time `json:"time"`
+	// Delivered is the number of Devices the command was delivered to, or started on for effects.
+	Delivered int    `json:"delivered"`
+	Devices   int    `json:"devices"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (r Result) String() string {
+	if r.Devices == 0 {
+		return r.Error
+	}
+	s := fmt.Sprintf("%d/%d devices", r.Delivered, r.Devices)
+	if r.Error != "" {
+		s += ": " + r.Error
+	}
+	return s
+}
+
+// OK reports whether the run succeeded on every device.
+func (r Result) OK() bool {
+	return r.Error == ""
+}
+
+// Status is a schedule with its next run and the result of its last one, if any.
+type Status struct {
+	config.Schedule
+	// Next is zero if the schedule does not run again.
+	Next time.Time
+	Last *Result
+}
+
+// Scheduler runs the schedules of the config on the devices of a controller.
+type Scheduler struct {
+	c        controller.Controller
+	health   device.HealthFunc
+	policy   controller.RetryPolicy
+	path     string
+	entries  []entry
+	routines *routine.Runner
+
+	mu      sync.Mutex
+	results map[string]Result
+	effects map[ldevice.Serial]*atomic.Bool
+}
+
+type entry struct {
+	config.Schedule
+	trigger Trigger
+	cmd     command.Item
+	params  []command.ParamItem
+}
+
+// DefaultStatePath returns the path of the state file in the user config directory,
+// e.g. $XDG_CONFIG_HOME/hikari/schedule_state.json on Linux.
+func DefaultStatePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDir, stateFile), nil
+}
+
+// New validates the schedules of cfg and returns a Scheduler keeping their results in the state file at path,
+// or only in memory if path is empty. The controller may be nil when the scheduler only reports the status.
+// Recalling scenes requires the scene library to be open.
+func New(c controller.Controller, cfg config.Config, path string) (*Scheduler, error) {
+	var at *Coordinates
+	if cfg.Latitude != 0 || cfg.Longitude != 0 {
+		at = &Coordinates{Latitude: cfg.Latitude, Longitude: cfg.Longitude}
+	}
+
+	s := &Scheduler{
+		c:       c,
+		policy:  controller.PolicyFrom(cfg),
+		path:    path,
+		results: make(map[string]Result),
+		effects: make(map[ldevice.Serial]*atomic.Bool),
+	}
+	if hr, ok := c.(controller.HealthReporter); ok {
+		s.health = hr.Health
+	}
+
+	names := make(map[string]bool)
+	for _, sc := range cfg.Schedules {
+		e, err := newEntry(sc, at)
+		if err != nil {
+			return nil, fmt.Errorf("schedules: %s: %w", sc.Name, err)
+		}
+		if names[sc.Name] {
+			return nil, fmt.Errorf("schedules: duplicate name %s", sc.Name)
+		}
+		names[sc.Name] = true
+		s.entries = append(s.entries, e)
+	}
+	return s, s.Reload()
+}
+
+func newEntry(sc config.Schedule, at *Coordinates) (entry, error) {
+	switch {
+	case sc.Name == "":
+		return entry{}, errors.New("name must be set")
+	case sc.Target == "":
+		return entry{}, errors.New("target must be set")
+	}
+	trigger, err := ParseTrigger(sc.At, at)
+	if err != nil {
+		return entry{}, fmt.Errorf("at: %w", err)
+	}
+	cmd, ok := command.Find(sc.Command)
+	if !ok {
+		return entry{}, fmt.Errorf("unknown command %q", sc.Command)
+	}
+	params, err := cmd.ParseParams(sc.Params)
+	if err != nil {
+		return entry{}, err
+	}
+	return entry{Schedule: sc, trigger: trigger, cmd: cmd, params: params}, nil
+}
+
+// UseRoutines runs the routines of the schedules with r, without which they fail.
+func (s *Scheduler) UseRoutines(r *routine.Runner) {
+	s.routines = r
+}
+
+// Reload reads the results of the last runs from the state file, e.g. to follow a scheduler run by another process.
+// A missing file is treated as no runs.
+func (s *Scheduler) Reload() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state State
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	if state.Version != StateVersion {
+		return fmt.Errorf("%s: unsupported state file version %d", s.path, state.Version)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = state.Results
+	if s.results == nil {
+		s.results = make(map[string]Result)
+	}
+	return nil
+}
+
+// Status returns the schedules in the order of their next run after now, those which do not run again last.
+func (s *Scheduler) Status(now time.Time) []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, len(s.entries))
+	for i, e := range s.entries {
+		statuses[i] = Status{Schedule: e.Schedule}
+		statuses[i].Next, _ = e.trigger.Next(now)
+		if r, ok := s.results[e.Name]; ok {
+			statuses[i].Last = &r
+		}
+	}
+	slices.SortStableFunc(statuses, func(a, b Status) int {
+		switch {
+		case a.Next.IsZero() == b.Next.IsZero():
+			return a.Next.Compare(b.Next)
+		case a.Next.IsZero():
+			return 1
+		}
+		return -1
+	})
+	return statuses
+}
+
+// Run runs every schedule when its trigger fires until ctx is done.
+// A run missed while the host was suspended is made once on resume.
+func (s *Scheduler) Run(ctx context.Context) error {
+	now := time.Now()
+	next := make([]time.Time, len(s.entries))
+	for i, e := range s.entries {
+		next[i], _ = e.trigger.Next(now)
+	}
+
+	for {
+		now = time.Now()
+		wait := maxWait
+		for i, e := range s.entries {
+			if next[i].IsZero() {
+				continue
+			}
+			if !next[i].After(now) {
+				r := s.run(ctx, e)
+				log.Printf("%s: %s %s: %s", e.Name, e.Command, e.Target, r)
+				if next[i], _ = e.trigger.Next(now); next[i].IsZero() {
+					continue
+				}
+			}
+			wait = min(wait, time.Until(next[i]))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Close stops the effects started by the scheduler.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for serial, stopped := range s.effects {
+		stopped.Store(true)
+		delete(s.effects, serial)
+	}
+}
+
+// run runs the command of the schedule on its target devices which are online, and records the result.
+func (s *Scheduler) run(ctx context.Context, e entry) Result {
+	devices := device.Filter(s.c.GetDevices(), e.Target)
+	r := Result{Time: time.Now(), Devices: len(devices)}
+
+	var errs []error
+	if len(devices) == 0 {
+		errs = append(errs, fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, e.Target))
+	} else if fn, done, err := s.action(ctx, e); err != nil {
+		errs = append(errs, err)
+	} else {
+		for _, err := range s.forEach(devices, fn) {
+			if err == nil {
+				r.Delivered++
+			}
+			errs = append(errs, err)
+		}
+		if done != nil {
+			errs = append(errs, done())
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		r.Error = err.Error()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results[e.Name] = r
+	if err := s.persist(); err != nil {
+		log.Printf("Failed to save schedule state: %v", err)
+	}
+	return r
+}
+
+// action returns the function running the command of the schedule on a device,
+// and the function completing the command once it ran on every device, if any.
+func (s *Scheduler) action(ctx context.Context, e entry) (func(ldevice.Device) error, func() error, error) {
+	deliver := func(serial ldevice.Serial, msg *protocol.Message) error {
+		return controller.Deliver(ctx, s.c, serial, s.policy, msg)
+	}
+
+	switch e.cmd.Type {
+	case command.CommandTypeScene, command.CommandTypeZones, command.CommandTypeFirmware:
+		return e.cmd.DeviceHandler(s.c, deliver, e.params...)
+	case command.CommandTypeRoutine:
+		if s.routines == nil {
+			return nil, nil, errors.New("routines are not supported")
+		}
+		ramp, err := e.cmd.RoutineHandler(e.params...)
+		if err != nil {
+			return nil, nil, err
+		}
+		return func(d ldevice.Device) error {
+			return s.routines.Start(d, ramp)
+		}, nil, nil
+	case command.CommandTypeEffect:
+		return func(d ldevice.Device) error {
+			if d.LightType != ldevice.LightTypeMatrix {
+				return errors.New("not a matrix device")
+			}
+			send := func(msg *protocol.Message) error {
+				return s.c.Send(d.Serial, msg)
+			}
+
+			// The effect starts outside the lock, which only guards swapping it with the effect already running.
+			stopped, err := e.cmd.StartMatrixEffect(d.MatrixProperties, send, e.params...)
+			if err != nil {
+				return err
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if running, ok := s.effects[d.Serial]; ok {
+				running.Store(true)
+			}
+			s.effects[d.Serial] = stopped
+			return nil
+		}, nil, nil
+	}
+	return func(d ldevice.Device) error {
+		msg, err := e.cmd.Handler(e.params...)
+		if err != nil {
+			return err
+		}
+		return deliver(d.Serial, msg)
+	}, nil, nil
+}
+
+// forEach runs fn for all devices concurrently, skipping those known to be offline,
+// and returns the per-device errors prefixed by the device name.
+func (s *Scheduler) forEach(devices []ldevice.Device, fn func(ldevice.Device) error) []error {
+	errs := make([]error, len(devices))
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := controller.ErrOffline
+			if !device.Offline(s.health, d.Serial) {
+				err = fn(d)
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", deviceName(d), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// persist atomically writes the results to the state file, if any. It must be called with the lock held.
+func (s *Scheduler) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(State{Version: StateVersion, Results: s.results}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, append(b, '\n'), statePerm)
+}
+
+func deviceName(d ldevice.Device) string {
+	if d.Label != "" {
+		return d.Label
+	}
+	return d.Serial.String()
+}
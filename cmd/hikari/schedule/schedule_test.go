@@ -0,0 +1,215 @@
+package schedule
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+var (
+	kitchen = testdevice.Kitchen
+	lounge  = testdevice.Lounge
+)
+
+func TestNew(t *testing.T) {
+	testCases := map[string]struct {
+		schedules   []config.Schedule
+		coordinates bool
+		wantErr     string
+	}{
+		"valid": {
+			schedules: []config.Schedule{
+				{Name: "wake up", At: "30 7 * * mon-fri", Command: "set_color", Target: "group:Bedroom", Params: map[string]string{"brightness": "80"}},
+				{Name: "evening", At: "sunset-30m", Command: "power_on", Target: "all"},
+			},
+			coordinates: true,
+		},
+		"missing name": {
+			schedules: []config.Schedule{{At: "@daily", Command: "power_on", Target: "all"}},
+			wantErr:   "schedules: : name must be set",
+		},
+		"duplicate name": {
+			schedules: []config.Schedule{
+				{Name: "night", At: "@daily", Command: "power_off", Target: "all"},
+				{Name: "night", At: "@hourly", Command: "power_off", Target: "all"},
+			},
+			wantErr: "schedules: duplicate name night",
+		},
+		"unknown command": {
+			schedules: []config.Schedule{{Name: "night", At: "@daily", Command: "dim", Target: "all"}},
+			wantErr:   `schedules: night: unknown command "dim"`,
+		},
+		"invalid param": {
+			schedules: []config.Schedule{{Name: "night", At: "@daily", Command: "set_color", Target: "all", Params: map[string]string{"brightness": "150"}}},
+			wantErr:   "schedules: night: brightness: value out of range (0-100)",
+		},
+		"sunset without coordinates": {
+			schedules: []config.Schedule{{Name: "evening", At: "sunset", Command: "power_on", Target: "all"}},
+			wantErr:   "schedules: evening: at: " + ErrNoCoordinates.Error(),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.Schedules = tc.schedules
+			if tc.coordinates {
+				cfg.Latitude, cfg.Longitude = sydney.Latitude, sydney.Longitude
+			}
+			_, err := New(nil, cfg, "")
+			if err != nil && err.Error() != tc.wantErr || err == nil && tc.wantErr != "" {
+				t.Errorf("Error does not match: got %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	testCases := map[string]struct {
+		schedule config.Schedule
+		drop     bool
+		want     Result
+		wantSent []uint16
+	}{
+		"power on location": {
+			schedule: config.Schedule{Command: "power_on", Target: "location:Home"},
+			want:     Result{Delivered: 2, Devices: 2},
+			wantSent: []uint16{uint16(packets.PayloadTypeDeviceSetPower), uint16(packets.PayloadTypeDeviceSetPower)},
+		},
+		"set color": {
+			schedule: config.Schedule{Command: "set_color", Target: "Kitchen", Params: map[string]string{"brightness": "20", "kelvin": "2200"}},
+			want:     Result{Delivered: 1, Devices: 1},
+			wantSent: []uint16{uint16(packets.PayloadTypeLightSetColor)},
+		},
+		"waveform": {
+			schedule: config.Schedule{Command: "waveform", Target: "Kitchen", Params: map[string]string{"waveform": "pulse", "hue": "0", "saturation": "100", "period": "250", "cycles": "10"}},
+			want:     Result{Delivered: 1, Devices: 1},
+			wantSent: []uint16{uint16(packets.PayloadTypeLightSetWaveformOptional)},
+		},
+		"unacknowledged": {
+			schedule: config.Schedule{Command: "power_off", Target: "Kitchen"},
+			drop:     true,
+			want:     Result{Devices: 1, Error: "Kitchen: " + controller.ErrTimeout.Error() + " after 2 attempts"},
+			wantSent: []uint16{uint16(packets.PayloadTypeDeviceSetPower), uint16(packets.PayloadTypeDeviceSetPower)},
+		},
+		"effect on non matrix device": {
+			schedule: config.Schedule{Command: "rockets_effect", Target: "Kitchen", Params: map[string]string{"colors": "red"}},
+			want:     Result{Devices: 1, Error: "Kitchen: not a matrix device"},
+		},
+		"no matching device": {
+			schedule: config.Schedule{Command: "power_on", Target: "Garden"},
+			want:     Result{Error: `device not found matching "Garden"`},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := controller.NewFake(kitchen, lounge)
+			if tc.drop {
+				f.Drop(kitchen.Serial, -1)
+			}
+			r := controller.NewRecorder(f)
+			cfg := config.Default()
+			cfg.SendTimeout = config.Duration(10 * time.Millisecond)
+			cfg.SendRetries = 1
+			cfg.SendBackoff = config.Duration(time.Millisecond)
+			tc.schedule.Name, tc.schedule.At = name, "@daily"
+			cfg.Schedules = []config.Schedule{tc.schedule}
+			s, err := New(r, cfg, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			got := s.run(context.Background(), s.entries[0])
+			got.Time = time.Time{}
+			if got != tc.want {
+				t.Errorf("Result does not match: got %+v, want %+v", got, tc.want)
+			}
+			var sent []uint16
+			for _, c := range r.Calls() {
+				sent = append(sent, c.Payload.PayloadType())
+			}
+			if !slices.Equal(sent, tc.wantSent) {
+				t.Errorf("Sent messages do not match: got %v, want %v", sent, tc.wantSent)
+			}
+		})
+	}
+}
+
+func TestReplaceEffect(t *testing.T) {
+	tiles := testdevice.Tiles
+	cfg := config.Default()
+	cfg.Schedules = []config.Schedule{{Name: "party", At: "@daily", Command: "rockets_effect", Target: "Tiles", Params: map[string]string{"colors": "red"}}}
+	s, err := New(controller.NewFake(tiles), cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if r := s.run(context.Background(), s.entries[0]); r.Error != "" {
+		t.Fatal(r.Error)
+	}
+	s.mu.Lock()
+	first := s.effects[tiles.Serial]
+	s.mu.Unlock()
+
+	if r := s.run(context.Background(), s.entries[0]); r.Error != "" {
+		t.Fatal(r.Error)
+	}
+	if !first.Load() {
+		t.Error("Expected the replaced effect to be stopped")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.effects[tiles.Serial]; e == nil || e == first {
+		t.Error("Expected a new effect to be running")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hikari", stateFile)
+	cfg := config.Default()
+	cfg.Schedules = []config.Schedule{
+		{Name: "leap day", At: "0 0 31 2 *", Command: "power_on", Target: "all"},
+		{Name: "night", At: "0 23 * * *", Command: "power_off", Target: "all"},
+		{Name: "morning", At: "0 7 * * *", Command: "power_on", Target: "Kitchen"},
+	}
+	s, err := New(controller.NewFake(kitchen), cfg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.run(context.Background(), s.entries[2])
+
+	// A scheduler reporting the status of another one reads the results from the state file.
+	viewer, err := New(nil, cfg, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 1, 1, 20, 0, 0, 0, time.UTC)
+	got := viewer.Status(now)
+
+	var names []string
+	for _, st := range got {
+		names = append(names, st.Name)
+	}
+	if want := []string{"night", "morning", "leap day"}; !slices.Equal(names, want) {
+		t.Fatalf("Order does not match: got %v, want %v", names, want)
+	}
+	if want := time.Date(2025, 1, 1, 23, 0, 0, 0, time.UTC); !got[0].Next.Equal(want) || got[0].Last != nil {
+		t.Errorf("Status of night does not match: got %+v", got[0])
+	}
+	if last := got[1].Last; last == nil || !last.OK() || last.String() != "1/1 devices" {
+		t.Errorf("Last run of morning does not match: got %+v", last)
+	}
+	if !got[2].Next.IsZero() {
+		t.Errorf("Expected leap day to never run, got %v", got[2].Next)
+	}
+}
@@ -0,0 +1,66 @@
+package schedule
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// j2000 is the Julian day of 2000-01-01 12:00 UTC.
+	j2000 = 2451545.0
+	// unixEpochJulianDay is the Julian day of 1970-01-01 00:00 UTC.
+	unixEpochJulianDay = 2440587.5
+	// sunAltitude is the altitude of the center of the sun at sunrise and sunset in degrees,
+	// accounting for atmospheric refraction and the radius of the solar disc.
+	sunAltitude = -0.833
+	// obliquity is the axial tilt of the Earth in degrees.
+	obliquity = 23.4397
+)
+
+// Coordinates are a latitude and longitude in degrees, positive north and east.
+type Coordinates struct {
+	Latitude, Longitude float64
+}
+
+// SunTimes returns the sunrise and sunset on the day of date at the coordinates, in the location of date,
+// computed with the sunrise equation to within a couple of minutes.
+// ok is false when the sun does not rise or set that day, e.g. during polar day or night.
+func SunTimes(date time.Time, at Coordinates) (sunrise, sunset time.Time, ok bool) {
+	noon := time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, time.UTC)
+	n := math.Round(julianDay(noon) - j2000 + 0.0008)
+	meanNoon := n - at.Longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	m := radians(anomaly)
+	center := 1.9148*math.Sin(m) + 0.02*math.Sin(2*m) + 0.0003*math.Sin(3*m)
+	longitude := radians(math.Mod(anomaly+center+180+102.9372, 360))
+	transit := j2000 + meanNoon + 0.0053*math.Sin(m) - 0.0069*math.Sin(2*longitude)
+
+	sinDeclination := math.Sin(longitude) * math.Sin(radians(obliquity))
+	cosDeclination := math.Cos(math.Asin(sinDeclination))
+	lat := radians(at.Latitude)
+	cosHourAngle := (math.Sin(radians(sunAltitude)) - math.Sin(lat)*sinDeclination) / (math.Cos(lat) * cosDeclination)
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+	hourAngle := degrees(math.Acos(cosHourAngle)) / 360
+
+	loc := date.Location()
+	return fromJulianDay(transit - hourAngle).In(loc), fromJulianDay(transit + hourAngle).In(loc), true
+}
+
+func julianDay(t time.Time) float64 {
+	return float64(t.Unix())/86400 + unixEpochJulianDay
+}
+
+func fromJulianDay(j float64) time.Time {
+	return time.Unix(int64(math.Round((j-unixEpochJulianDay)*86400)), 0)
+}
+
+func radians(d float64) float64 {
+	return d * math.Pi / 180
+}
+
+func degrees(r float64) float64 {
+	return r * 180 / math.Pi
+}
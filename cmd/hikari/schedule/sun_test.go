@@ -0,0 +1,130 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	sydney = Coordinates{Latitude: -33.87, Longitude: 151.21}
+	london = Coordinates{Latitude: 51.51, Longitude: -0.13}
+	tromso = Coordinates{Latitude: 69.65, Longitude: 18.96}
+)
+
+func TestSunTimes(t *testing.T) {
+	aest := time.FixedZone("AEST", 10*60*60)
+	bst := time.FixedZone("BST", 60*60)
+	testCases := map[string]struct {
+		date                time.Time
+		at                  Coordinates
+		wantRise, wantSet   time.Time
+		wantPolarDayOrNight bool
+	}{
+		"sydney winter solstice": {
+			date:     time.Date(2025, 6, 21, 0, 0, 0, 0, aest),
+			at:       sydney,
+			wantRise: time.Date(2025, 6, 21, 7, 0, 0, 0, aest),
+			wantSet:  time.Date(2025, 6, 21, 16, 54, 0, 0, aest),
+		},
+		"london summer solstice": {
+			date:     time.Date(2025, 6, 21, 0, 0, 0, 0, bst),
+			at:       london,
+			wantRise: time.Date(2025, 6, 21, 4, 43, 0, 0, bst),
+			wantSet:  time.Date(2025, 6, 21, 21, 21, 0, 0, bst),
+		},
+		"midnight sun": {
+			date:                time.Date(2025, 6, 21, 0, 0, 0, 0, time.UTC),
+			at:                  tromso,
+			wantPolarDayOrNight: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			rise, set, ok := SunTimes(tc.date, tc.at)
+			if ok == tc.wantPolarDayOrNight {
+				t.Fatalf("Expected sun to rise and set: %t, got %t", !tc.wantPolarDayOrNight, ok)
+			}
+			if !ok {
+				return
+			}
+			if d := rise.Sub(tc.wantRise).Abs(); d > 2*time.Minute {
+				t.Errorf("Sunrise does not match: got %v, want %v", rise, tc.wantRise)
+			}
+			if d := set.Sub(tc.wantSet).Abs(); d > 2*time.Minute {
+				t.Errorf("Sunset does not match: got %v, want %v", set, tc.wantSet)
+			}
+		})
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	aest := time.FixedZone("AEST", 10*60*60)
+	// Sunset in Sydney is at about 16:54 on 21 June and 16:55 on 22 June.
+	start := time.Date(2025, 6, 21, 16, 30, 0, 0, aest)
+	testCases := map[string]struct {
+		trigger string
+		at      *Coordinates
+		want    time.Time
+		wantErr error
+	}{
+		"sunset": {
+			trigger: "sunset",
+			at:      &sydney,
+			want:    time.Date(2025, 6, 21, 16, 54, 0, 0, aest),
+		},
+		"sunset with negative offset": {
+			trigger: "sunset-30m",
+			at:      &sydney,
+			want:    time.Date(2025, 6, 22, 16, 25, 0, 0, aest),
+		},
+		"sunrise with positive offset": {
+			trigger: "sunrise+1h",
+			at:      &sydney,
+			want:    time.Date(2025, 6, 22, 8, 0, 0, 0, aest),
+		},
+		"cron": {
+			trigger: "0 17 * * *",
+			want:    time.Date(2025, 6, 21, 17, 0, 0, 0, aest),
+		},
+		"no coordinates": {
+			trigger: "sunrise",
+			wantErr: ErrNoCoordinates,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			trigger, err := ParseTrigger(tc.trigger, tc.at)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Error does not match: got %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, ok := trigger.Next(start)
+			if !ok || got.Sub(tc.want).Abs() > 2*time.Minute {
+				t.Errorf("Next does not match: got %v (%t), want %v", got, ok, tc.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"sunset30m", "sunrise+soon", "0 7 * *"} {
+		if _, err := ParseTrigger(invalid, &sydney); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+}
+
+func TestSolarNextPolarNight(t *testing.T) {
+	trigger, err := ParseTrigger("sunrise", &tromso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The sun does not rise in Tromsø from late November to mid January.
+	got, ok := trigger.Next(time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC))
+	if !ok || got.Month() != time.January || got.Year() != 2026 {
+		t.Errorf("Expected the first sunrise in January, got %v (%t)", got, ok)
+	}
+}
@@ -0,0 +1,77 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	sunrise = "sunrise"
+	sunset  = "sunset"
+	// solarDays is how many days ahead a solar trigger looks for its event, covering a polar night.
+	solarDays = 370
+)
+
+// ErrNoCoordinates is returned when parsing a solar trigger without coordinates.
+var ErrNoCoordinates = errors.New("sunrise and sunset require latitude and longitude")
+
+// Trigger fires at the times a schedule runs.
+type Trigger interface {
+	// Next returns the first time after t the trigger fires, false if it does not fire again.
+	Next(t time.Time) (time.Time, bool)
+}
+
+// ParseTrigger parses a solar event, "sunrise" or "sunset" with an optional offset such as "sunset-30m" or "sunrise+1h15m",
+// or otherwise a cron expression, see Cron. Solar events are computed at the coordinates, which may be nil for cron expressions.
+func ParseTrigger(s string, at *Coordinates) (Trigger, error) {
+	for _, event := range []string{sunrise, sunset} {
+		rest, ok := strings.CutPrefix(s, event)
+		if !ok {
+			continue
+		}
+		var offset time.Duration
+		if rest != "" {
+			if rest[0] != '+' && rest[0] != '-' {
+				return nil, fmt.Errorf("invalid %s offset %q, must start with + or -", event, rest)
+			}
+			var err error
+			if offset, err = time.ParseDuration(rest); err != nil {
+				return nil, fmt.Errorf("invalid %s offset: %w", event, err)
+			}
+		}
+		if at == nil {
+			return nil, ErrNoCoordinates
+		}
+		return solar{event: event, offset: offset, at: *at}, nil
+	}
+	return ParseCron(s)
+}
+
+// solar fires at an offset from the sunrise or sunset of every day.
+type solar struct {
+	event  string
+	offset time.Duration
+	at     Coordinates
+}
+
+// Next returns the first event after t, starting from the day before t so that negative offsets
+// moving an event to the previous day and days without the event are both accounted for.
+func (s solar) Next(t time.Time) (time.Time, bool) {
+	day := time.Date(t.Year(), t.Month(), t.Day()-1, 12, 0, 0, 0, t.Location())
+	for i := range solarDays {
+		rise, set, ok := SunTimes(day.AddDate(0, 0, i), s.at)
+		if !ok {
+			continue
+		}
+		event := rise
+		if s.event == sunset {
+			event = set
+		}
+		if next := event.Add(s.offset); next.After(t) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
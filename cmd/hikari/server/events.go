@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+// Event types.
+const (
+	EventDiscovered    = "discovered"
+	EventLost          = "lost"
+	EventPower         = "power"
+	EventColor         = "color"
+	EventEffectStarted = "effect_started"
+	EventEffectStopped = "effect_stopped"
+)
+
+// eventBuffer is the number of events buffered for each subscriber before events are dropped.
+const eventBuffer = 64
+
+// Event is a change of a device, carrying the state of the device after the change.
+type Event struct {
+	Type   string        `json:"type"`
+	Time   time.Time     `json:"time"`
+	Device device.Record `json:"device"`
+	Effect string        `json:"effect,omitempty"`
+
+	device ldevice.Device
+}
+
+func newEvent(typ string, d ldevice.Device, now time.Time) Event {
+	return Event{Type: typ, Time: now, Device: device.NewRecord(d), device: d}
+}
+
+// Diff returns the events turning the prev snapshot of devices into next:
+// devices which appeared are discovered, devices which disappeared are lost
+// and devices which changed power or color emit an event for each change.
+func Diff(prev, next []ldevice.Device, now time.Time) []Event {
+	var events []Event
+	for _, d := range next {
+		i := slices.IndexFunc(prev, func(p ldevice.Device) bool { return p.Serial == d.Serial })
+		if i < 0 {
+			events = append(events, newEvent(EventDiscovered, d, now))
+			continue
+		}
+		if prev[i].PoweredOn != d.PoweredOn {
+			events = append(events, newEvent(EventPower, d, now))
+		}
+		if prev[i].Color != d.Color {
+			events = append(events, newEvent(EventColor, d, now))
+		}
+	}
+	for _, p := range prev {
+		if !slices.ContainsFunc(next, func(d ldevice.Device) bool { return d.Serial == p.Serial }) {
+			events = append(events, newEvent(EventLost, p, now))
+		}
+	}
+	return events
+}
+
+// hub broadcasts events to subscribers.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+func newHub() *hub {
+	return &hub{subs: make(map[chan Event]struct{})}
+}
+
+// subscribe returns a channel receiving the published events and a function to unsubscribe.
+func (h *hub) subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs, ch)
+		h.mu.Unlock()
+	}
+}
+
+// publish sends the events to every subscriber, dropping them for subscribers which are lagging behind.
+func (h *hub) publish(events ...Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// writeEvent writes e in the server-sent events format.
+func writeEvent(w io.Writer, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+func TestDiff(t *testing.T) {
+	poweredOff := kitchen
+	poweredOff.PoweredOn = false
+	recolored := poweredOff
+	recolored.Color.Hue = 120
+
+	testCases := map[string]struct {
+		prev, next []ldevice.Device
+		want       []string
+	}{
+		"first snapshot": {
+			next: []ldevice.Device{kitchen, tiles},
+			want: []string{"discovered Kitchen", "discovered Tiles"},
+		},
+		"unchanged": {
+			prev: []ldevice.Device{kitchen, tiles},
+			next: []ldevice.Device{kitchen, tiles},
+		},
+		"power change": {
+			prev: []ldevice.Device{kitchen},
+			next: []ldevice.Device{poweredOff},
+			want: []string{"power Kitchen"},
+		},
+		"power and color change": {
+			prev: []ldevice.Device{kitchen},
+			next: []ldevice.Device{recolored},
+			want: []string{"power Kitchen", "color Kitchen"},
+		},
+		"lost device": {
+			prev: []ldevice.Device{kitchen, tiles},
+			next: []ldevice.Device{kitchen},
+			want: []string{"lost Tiles"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var got []string
+			for _, e := range Diff(tc.prev, tc.next, time.Now()) {
+				got = append(got, e.Type+" "+e.Device.Label)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("Events do not match: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	f := controller.NewFake(kitchen)
+	s := newTestServer(f)
+	defer s.Close()
+	s.refresh()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content type does not match: got %s, want text/event-stream", ct)
+	}
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		t.Helper()
+		for lines.Scan() {
+			if event, ok := strings.CutPrefix(lines.Text(), "event: "); ok {
+				return event
+			}
+		}
+		t.Fatalf("Stream ended: %v", lines.Err())
+		return ""
+	}
+
+	if got := next(); got != EventDiscovered {
+		t.Errorf("Snapshot event does not match: got %s, want %s", got, EventDiscovered)
+	}
+
+	poweredOff := kitchen
+	poweredOff.PoweredOn = false
+	f.SetDevices(poweredOff, tiles)
+	s.refresh()
+	for _, want := range []string{EventPower, EventDiscovered} {
+		if got := next(); got != want {
+			t.Errorf("Event does not match: got %s, want %s", got, want)
+		}
+	}
+
+	f.SetDevices(tiles)
+	s.refresh()
+	if got := next(); got != EventLost {
+		t.Errorf("Event does not match: got %s, want %s", got, EventLost)
+	}
+}
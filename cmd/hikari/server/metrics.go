@@ -0,0 +1,126 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelEscaper escapes label values, which may only escape backslashes, double quotes and line feeds.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metric is a metric family in the Prometheus text exposition format.
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	samples []sample
+}
+
+type sample struct {
+	labels []string // name and value pairs
+	value  float64
+}
+
+func (m *metric) add(value float64, labels ...string) {
+	m.samples = append(m.samples, sample{labels: labels, value: value})
+}
+
+// serveMetrics exposes the state of every device and the messages sent by the server in the Prometheus text format.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	var (
+		info       = &metric{name: "hikari_device_info", help: "Device details, always 1.", typ: "gauge"}
+		power      = &metric{name: "hikari_device_power", help: "Whether the device is powered on.", typ: "gauge"}
+		brightness = &metric{name: "hikari_device_brightness", help: "Brightness of the light as a percentage.", typ: "gauge"}
+		hue        = &metric{name: "hikari_device_hue", help: "Hue of the light in degrees.", typ: "gauge"}
+		saturation = &metric{name: "hikari_device_saturation", help: "Saturation of the light as a percentage.", typ: "gauge"}
+		kelvin     = &metric{name: "hikari_device_kelvin", help: "Color temperature of the light in kelvin.", typ: "gauge"}
+		online     = &metric{name: "hikari_device_online", help: "Whether the device responded recently.", typ: "gauge"}
+		rtt        = &metric{name: "hikari_device_rtt_seconds", help: "Round trip time of the last response of the device.", typ: "gauge"}
+	)
+	for _, d := range s.c.GetDevices() {
+		labels := []string{"serial", d.Serial.String(), "label", d.Label}
+		info.add(1, append(labels,
+			"product", d.RegistryName,
+			"firmware", fmt.Sprint(d.FirmwareVersion),
+			"group", d.Group,
+			"location", d.Location,
+		)...)
+		power.add(boolValue(d.PoweredOn), labels...)
+		if d.Type != ldevice.DeviceTypeSwitch {
+			brightness.add(d.Color.Brightness, labels...)
+			hue.add(d.Color.Hue, labels...)
+			saturation.add(d.Color.Saturation, labels...)
+			kelvin.add(float64(d.Color.Kelvin), labels...)
+		}
+		if s.health == nil {
+			continue
+		}
+		if h, ok := s.health(d.Serial); ok {
+			online.add(boolValue(h.Online), labels...)
+			rtt.add(h.RTT.Seconds(), labels...)
+		}
+	}
+
+	counts := s.counter.Counts()
+	s.mu.Lock()
+	var running float64
+	for _, e := range s.effects {
+		if !e.stopped.Load() {
+			running++
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", metricsContentType)
+	writeMetrics(w,
+		info, power, brightness, hue, saturation, kelvin, online, rtt,
+		counter("hikari_messages_sent_total", "Messages sent to devices, including resends.", counts.Sent),
+		counter("hikari_acks_total", "Messages acknowledged by devices.", counts.Acked),
+		counter("hikari_retries_total", "Messages resent after their acknowledgement was lost.", counts.Retries),
+		counter("hikari_ack_timeouts_total", "Messages not acknowledged in time.", counts.Timeouts),
+		counter("hikari_errors_total", "Messages which failed to be sent.", counts.Errors),
+		&metric{name: "hikari_effects_running", help: "Effects running on devices.", typ: "gauge", samples: []sample{{value: running}}},
+	)
+}
+
+func counter(name, help string, v uint64) *metric {
+	return &metric{name: name, help: help, typ: "counter", samples: []sample{{value: float64(v)}}}
+}
+
+// writeMetrics writes the metrics in the Prometheus text exposition format, leaving out metrics without samples.
+func writeMetrics(w io.Writer, metrics ...*metric) {
+	for _, m := range metrics {
+		if len(m.samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, s := range m.samples {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, formatLabels(s.labels), strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+`="`+labelEscaper.Replace(labels[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+)
+
+func TestMetrics(t *testing.T) {
+	f := controller.NewFake(kitchen, tiles)
+	f.Drop(kitchen.Serial, 1)
+	s := newTestServer(offlineHealth{f, tiles.Serial})
+	defer s.Close()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/devices/Kitchen/power", strings.NewReader(`{"on": false}`)),
+		httptest.NewRequest(http.MethodPost, "/devices/Tiles/effects/snake_effect?force=true", strings.NewReader(`{"color": "red"}`)),
+	} {
+		s.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content type does not match: got %s", ct)
+	}
+	for _, want := range []string{
+		"# TYPE hikari_device_power gauge",
+		`hikari_device_info{serial="d073d5000001",label="Kitchen",product="LIFX A19",firmware="",group="Downstairs",location="Home"} 1`,
+		`hikari_device_power{serial="d073d5000001",label="Kitchen"} 0`,
+		`hikari_device_kelvin{serial="d073d5000001",label="Kitchen"} 3500`,
+		`hikari_device_online{serial="d073d5000003",label="Tiles"} 0`,
+		"# TYPE hikari_messages_sent_total counter",
+		"hikari_messages_sent_total 2",
+		"hikari_acks_total 1",
+		"hikari_retries_total 1",
+		"hikari_ack_timeouts_total 1",
+	} {
+		if !strings.Contains(w.Body.String(), want+"\n") {
+			t.Errorf("Metrics do not contain %q:\n%s", want, w.Body)
+		}
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	testCases := map[string]struct {
+		labels []string
+		want   string
+	}{
+		"no labels": {},
+		"plain":     {labels: []string{"serial", "d073d5000001", "label", "Kitchen"}, want: `{serial="d073d5000001",label="Kitchen"}`},
+		"escaped":   {labels: []string{"label", "Bob's \"Lamp\"\\\n"}, want: `{label="Bob's \"Lamp\"\\\n"}`},
+		"unicode":   {labels: []string{"label", "Küche 💡"}, want: `{label="Küche 💡"}`},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if got := formatLabels(tc.labels); got != tc.want {
+				t.Errorf("Labels do not match: got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
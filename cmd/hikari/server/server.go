@@ -0,0 +1,565 @@
+// Package server exposes devices and commands over HTTP/JSON.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/command"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+	"github.com/alessio-palumbo/lifxlan-go/pkg/protocol"
+)
+
+// Result statuses reported for effects, in addition to the delivery statuses.
+const (
+	statusStarted = "started"
+	statusStopped = "stopped"
+)
+
+// Server serves the devices of a controller and runs commands from the command registry on them.
+// Changes of the devices are streamed to subscribers as server-sent events.
+type Server struct {
+	c       controller.Controller
+	counter *controller.Counter
+	policy  controller.RetryPolicy
+	verify  bool
+	health  device.HealthFunc
+	mux     *http.ServeMux
+	events  *hub
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu       sync.Mutex
+	effects  map[ldevice.Serial]effect
+	snapshot []ldevice.Device
+}
+
+// effect is an effect running on a device.
+type effect struct {
+	id      string
+	stopped *atomic.Bool
+}
+
+// Result is the outcome of a command on a device.
+type Result struct {
+	Serial string `json:"serial"`
+	Label  string `json:"label"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CommandInfo describes a command and its params.
+type CommandInfo struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Description string      `json:"description"`
+	Params      []ParamInfo `json:"params"`
+}
+
+// ParamInfo describes a command param.
+type ParamInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+// New returns a Server sending commands through c with the retry policy and verification from cfg.
+// Devices which c reports offline are skipped unless the request is forced
+// and the messages sent through c are counted for metrics.
+// Devices are refreshed every device refresh period until closed to stream their changes,
+// or never when the period is 0.
+func New(c controller.Controller, cfg config.Config) *Server {
+	counter := controller.NewCounter(c)
+	s := &Server{
+		c:       counter,
+		counter: counter,
+		policy:  controller.PolicyFrom(cfg),
+		verify:  cfg.Verify,
+		mux:     http.NewServeMux(),
+		events:  newHub(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		effects: make(map[ldevice.Serial]effect),
+	}
+	if hr, ok := c.(controller.HealthReporter); ok {
+		s.health = hr.Health
+	}
+
+	s.mux.HandleFunc("GET /commands", s.listCommands)
+	s.mux.HandleFunc("GET /devices", s.listDevices)
+	s.mux.HandleFunc("GET /devices/{target}", s.getDevice)
+	s.mux.HandleFunc("POST /devices/{target}/power", s.setPower)
+	s.mux.HandleFunc("POST /devices/{target}/color", s.setColor)
+	s.mux.HandleFunc("POST /devices/{target}/commands/{id}", s.runCommand)
+	s.mux.HandleFunc("POST /devices/{target}/effects/{id}", s.startEffect)
+	s.mux.HandleFunc("DELETE /devices/{target}/effects/{id}", s.stopEffect)
+	s.mux.HandleFunc("GET /events", s.streamEvents)
+	s.mux.HandleFunc("GET /metrics", s.serveMetrics)
+
+	if period := cfg.DeviceRefreshPeriod.Std(); period > 0 {
+		go s.watch(period)
+	} else {
+		close(s.done)
+	}
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops refreshing devices and all running effects.
+func (s *Server) Close() {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for serial, e := range s.effects {
+		e.stopped.Store(true)
+		delete(s.effects, serial)
+	}
+}
+
+func (s *Server) listCommands(w http.ResponseWriter, r *http.Request) {
+	var infos []CommandInfo
+	for _, c := range command.Commands() {
+		info := CommandInfo{ID: c.ID, Name: c.Name, Type: c.Type.String(), Description: c.Description, Params: []ParamInfo{}}
+		for _, p := range c.ParamTypes {
+			info.Params = append(info.Params, ParamInfo{Name: p.Name, Description: p.Description, Required: p.Required})
+		}
+		infos = append(infos, info)
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// listDevices returns all devices, or the devices addressed by the target query param.
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	devices := s.c.GetDevices()
+	if target := r.URL.Query().Get("target"); target != "" {
+		devices = device.Filter(devices, target)
+	}
+	records := make([]device.Record, len(devices))
+	for i, d := range devices {
+		records[i] = device.NewRecord(d)
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// getDevice returns the device with the serial or label in the path.
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request) {
+	target := r.PathValue("target")
+	if device.IsMulti(target) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%q addresses multiple devices, use /devices?target=%s", target, target))
+		return
+	}
+	devices := device.Filter(s.c.GetDevices(), target)
+	if len(devices) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, target))
+		return
+	}
+	writeJSON(w, http.StatusOK, device.NewRecord(devices[0]))
+}
+
+// setPower turns the devices on or off, e.g. {"on": true}.
+func (s *Server) setPower(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		On *bool `json:"on"`
+	}
+	if err := decode(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if body.On == nil {
+		writeError(w, http.StatusBadRequest, errors.New("on must be set"))
+		return
+	}
+	id := "power_off"
+	if *body.On {
+		id = "power_on"
+	}
+	s.run(w, r, id, nil)
+}
+
+// setColor changes the color of the devices with the params of set_color, e.g. {"hue": 120, "brightness": 50}.
+func (s *Server) setColor(w http.ResponseWriter, r *http.Request) {
+	values, err := decodeParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.run(w, r, "set_color", values)
+}
+
+// runCommand runs any setter or scene command on the devices, with params in the body keyed by name.
+func (s *Server) runCommand(w http.ResponseWriter, r *http.Request) {
+	values, err := decodeParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.run(w, r, r.PathValue("id"), values)
+}
+
+// run validates the params of the command and sends it to the devices addressed by the path,
+// waiting for every device to acknowledge it.
+func (s *Server) run(w http.ResponseWriter, r *http.Request, id string, values map[string]string) {
+	cmd, ok := command.Find(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown command %q", id))
+		return
+	}
+	if cmd.Type == command.CommandTypeEffect {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is an effect, use /effects/%s", id, id))
+		return
+	}
+	if cmd.Type == command.CommandTypeRoutine {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("%s is a routine, run it from the TUI, the CLI or a schedule", id))
+		return
+	}
+	params, err := cmd.ParseParams(values)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	devices, ok := s.targets(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	deliver := func(serial ldevice.Serial, msg *protocol.Message) error {
+		return controller.Deliver(ctx, s.c, serial, s.policy, msg)
+	}
+
+	var fn func(ldevice.Device) error
+	var done func() error
+	switch cmd.Type {
+	case command.CommandTypeScene, command.CommandTypeZones, command.CommandTypeFirmware:
+		fn, done, err = cmd.DeviceHandler(s.c, deliver, params...)
+	default:
+		fn, err = s.setter(ctx, cmd, deliver, params)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	results := s.forEach(devices, force(r), controller.StatusDelivered.String(), fn)
+	if done != nil {
+		if err := done(); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	s.writeResults(w, results)
+}
+
+// setter returns a function delivering the message of the command to a device and, when verifying, reading back its state.
+func (s *Server) setter(ctx context.Context, cmd command.Item, deliver command.SendFunc, params []command.ParamItem) (func(ldevice.Device) error, error) {
+	if _, err := cmd.Handler(params...); err != nil {
+		return nil, err
+	}
+	var expect *controller.Expectation
+	if s.verify && cmd.Expect != nil {
+		if e := cmd.Expect(params...); !e.IsZero() {
+			expect = &e
+		}
+	}
+	return func(d ldevice.Device) error {
+		msg, err := cmd.Handler(params...)
+		if err != nil {
+			return err
+		}
+		if err := deliver(d.Serial, msg); err != nil || expect == nil {
+			return err
+		}
+		ctx, cancel := context.WithTimeout(ctx, expect.Transition+s.policy.Timeout)
+		defer cancel()
+		return controller.Verify(ctx, s.c, d.Serial, *expect)
+	}, nil
+}
+
+// startEffect starts the effect on the matrix devices, replacing any effect already running on them.
+func (s *Server) startEffect(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	cmd, ok := command.Find(id)
+	if !ok || cmd.Type != command.CommandTypeEffect {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown effect %q", id))
+		return
+	}
+	values, err := decodeParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	params, err := cmd.ParseParams(values)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	devices, ok := s.targets(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeResults(w, s.forEach(devices, force(r), statusStarted, func(d ldevice.Device) error {
+		if d.LightType != ldevice.LightTypeMatrix {
+			return errors.New("not a matrix device")
+		}
+		send := func(msg *protocol.Message) error {
+			return s.c.Send(d.Serial, msg)
+		}
+
+		// The effect starts outside the lock, which only guards swapping it with the effect already running.
+		stopped, err := cmd.StartMatrixEffect(d.MatrixProperties, send, params...)
+		if err != nil {
+			return err
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if e, ok := s.effects[d.Serial]; ok {
+			e.stopped.Store(true)
+			s.publishEffect(EventEffectStopped, d, e.id)
+		}
+		s.effects[d.Serial] = effect{id: id, stopped: stopped}
+		s.publishEffect(EventEffectStarted, d, id)
+		return nil
+	}))
+}
+
+// stopEffect stops the effect on the devices it is running on.
+func (s *Server) stopEffect(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	devices, ok := s.targets(w, r)
+	if !ok {
+		return
+	}
+
+	s.writeResults(w, s.forEach(devices, true, statusStopped, func(d ldevice.Device) error {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e, ok := s.effects[d.Serial]
+		if !ok || e.id != id || e.stopped.Load() {
+			return fmt.Errorf("%s not running", id)
+		}
+		e.stopped.Store(true)
+		delete(s.effects, d.Serial)
+		s.publishEffect(EventEffectStopped, d, id)
+		return nil
+	}))
+}
+
+// streamEvents streams the changes of the devices as server-sent events, optionally filtered by the target query param.
+// Every online device is sent as discovered when the stream starts.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	target := r.URL.Query().Get("target")
+	match := func(e Event) bool {
+		return target == "" || device.Match(e.device, target)
+	}
+
+	events, unsubscribe := s.events.subscribe()
+	defer unsubscribe()
+	s.mu.Lock()
+	snapshot := Diff(nil, s.snapshot, time.Now())
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range snapshot {
+		if match(e) {
+			writeEvent(w, e)
+		}
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case e := <-events:
+			if !match(e) {
+				continue
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *Server) watch(period time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		s.refresh()
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// refresh diffs the online devices against the previous snapshot and publishes the changes,
+// along with the effects which completed since the last refresh.
+func (s *Server) refresh() {
+	devices := slices.DeleteFunc(s.c.GetDevices(), func(d ldevice.Device) bool {
+		return device.Offline(s.health, d.Serial)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events.publish(Diff(s.snapshot, devices, time.Now())...)
+	s.snapshot = devices
+	for serial, e := range s.effects {
+		if !e.stopped.Load() {
+			continue
+		}
+		delete(s.effects, serial)
+		if i := slices.IndexFunc(devices, func(d ldevice.Device) bool { return d.Serial == serial }); i >= 0 {
+			s.publishEffect(EventEffectStopped, devices[i], e.id)
+		}
+	}
+}
+
+// publishEffect publishes an effect event for the device.
+func (s *Server) publishEffect(typ string, d ldevice.Device, id string) {
+	e := newEvent(typ, d, time.Now())
+	e.Effect = id
+	s.events.publish(e)
+}
+
+// targets returns the devices addressed by the target in the path, writing an error when none is found.
+func (s *Server) targets(w http.ResponseWriter, r *http.Request) ([]ldevice.Device, bool) {
+	target := r.PathValue("target")
+	devices := device.Filter(s.c.GetDevices(), target)
+	if len(devices) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w matching %q", controller.ErrDeviceNotFound, target))
+		return nil, false
+	}
+	return devices, true
+}
+
+// forEach runs fn for all devices concurrently and returns the result for each,
+// skipping devices known to be offline unless forced.
+func (s *Server) forEach(devices []ldevice.Device, force bool, status string, fn func(ldevice.Device) error) []Result {
+	results := make([]Result, len(devices))
+	var wg sync.WaitGroup
+	for i, d := range devices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if !force && device.Offline(s.health, d.Serial) {
+				err = controller.ErrOffline
+			} else {
+				err = fn(d)
+			}
+
+			results[i] = Result{Serial: d.Serial.String(), Label: d.Label, Status: status}
+			if err != nil {
+				results[i].Status = controller.StatusOf(err).String()
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// writeResults writes the results, with status 502 when the command failed on any device.
+func (s *Server) writeResults(w http.ResponseWriter, results []Result) {
+	code := http.StatusOK
+	for _, r := range results {
+		if r.Error != "" {
+			code = http.StatusBadGateway
+		}
+	}
+	writeJSON(w, code, map[string][]Result{"results": results})
+}
+
+// force reports whether the request is sent to devices known to be offline, e.g. ?force=true.
+func force(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+	return v
+}
+
+// decode decodes the JSON body of the request into v, allowing an empty body.
+func decode(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid body: %w", err)
+	}
+	return nil
+}
+
+// decodeParams decodes command params from a JSON object keyed by param name into the raw values
+// accepted when editing params, e.g. {"colors": ["red", "blue"]} into "red,blue".
+func decodeParams(r *http.Request) (map[string]string, error) {
+	// Numbers are kept as written, as float64 would turn e.g. 1000000 into 1e+06.
+	var body map[string]any
+	dec := json.NewDecoder(r.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid body: %w", err)
+	}
+	values := make(map[string]string, len(body))
+	for name, v := range body {
+		switch v := v.(type) {
+		case nil:
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = paramValue(item)
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			values[name] = paramValue(v)
+		}
+	}
+	return values, nil
+}
+
+func paramValue(v any) string {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
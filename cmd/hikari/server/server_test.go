@@ -0,0 +1,334 @@
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/config"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/controller"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/device"
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/testdevice"
+	ldevice "github.com/alessio-palumbo/lifxlan-go/pkg/device"
+)
+
+var (
+	kitchen = testdevice.Kitchen
+	tiles   = testdevice.Tiles
+)
+
+func TestServer(t *testing.T) {
+	testCases := map[string]struct {
+		setup        func(f *controller.Fake)
+		method       string
+		path         string
+		body         string
+		wantCode     int
+		wantLabels   []string
+		wantStatuses []string
+		wantSent     int
+		wantErr      string
+	}{
+		"list devices": {
+			method:     http.MethodGet,
+			path:       "/devices",
+			wantCode:   http.StatusOK,
+			wantLabels: []string{"Kitchen", "Tiles"},
+		},
+		"list devices in group": {
+			method:     http.MethodGet,
+			path:       "/devices?target=group:downstairs",
+			wantCode:   http.StatusOK,
+			wantLabels: []string{"Kitchen"},
+		},
+		"get device by serial": {
+			method:     http.MethodGet,
+			path:       "/devices/d073d5000003",
+			wantCode:   http.StatusOK,
+			wantLabels: []string{"Tiles"},
+		},
+		"get unknown device": {
+			method:   http.MethodGet,
+			path:     "/devices/Pantry",
+			wantCode: http.StatusNotFound,
+			wantErr:  `device not found matching "Pantry"`,
+		},
+		"power on all": {
+			method:       http.MethodPost,
+			path:         "/devices/all/power",
+			body:         `{"on": true}`,
+			wantCode:     http.StatusOK,
+			wantStatuses: []string{"delivered", "delivered"},
+			wantSent:     2,
+		},
+		"power without state": {
+			method:   http.MethodPost,
+			path:     "/devices/all/power",
+			body:     `{}`,
+			wantCode: http.StatusBadRequest,
+			wantErr:  "on must be set",
+		},
+		"set color of group": {
+			method:       http.MethodPost,
+			path:         "/devices/group:Living Room/color",
+			body:         `{"hue": 120, "saturation": 100, "brightness": 50}`,
+			wantCode:     http.StatusOK,
+			wantStatuses: []string{"delivered"},
+			wantSent:     1,
+		},
+		"invalid color": {
+			method:   http.MethodPost,
+			path:     "/devices/Kitchen/color",
+			body:     `{"hue": 400}`,
+			wantCode: http.StatusBadRequest,
+			wantErr:  "hue:",
+		},
+		"command from registry": {
+			method:       http.MethodPost,
+			path:         "/devices/Kitchen/commands/set_brightness",
+			body:         `{"brightness": 20, "duration": 2}`,
+			wantCode:     http.StatusOK,
+			wantStatuses: []string{"delivered"},
+			wantSent:     1,
+		},
+		"unknown command": {
+			method:   http.MethodPost,
+			path:     "/devices/Kitchen/commands/dance",
+			wantCode: http.StatusNotFound,
+			wantErr:  `unknown command "dance"`,
+		},
+		"unacknowledged command": {
+			setup:        func(f *controller.Fake) { f.Drop(kitchen.Serial, -1) },
+			method:       http.MethodPost,
+			path:         "/devices/all/power",
+			body:         `{"on": false}`,
+			wantCode:     http.StatusBadGateway,
+			wantStatuses: []string{"timed out", "delivered"},
+			wantSent:     4,
+		},
+		"start effect": {
+			method:       http.MethodPost,
+			path:         "/devices/all/effects/snake_effect",
+			body:         `{"color": "red", "cycles": 1}`,
+			wantCode:     http.StatusBadGateway,
+			wantStatuses: []string{"failed", "started"},
+		},
+		"stop effect not running": {
+			method:       http.MethodDelete,
+			path:         "/devices/Tiles/effects/snake_effect",
+			wantCode:     http.StatusBadGateway,
+			wantStatuses: []string{"failed"},
+		},
+		"effect as command": {
+			method:   http.MethodPost,
+			path:     "/devices/Tiles/commands/snake_effect",
+			body:     `{"color": "red"}`,
+			wantCode: http.StatusBadRequest,
+			wantErr:  "snake_effect is an effect",
+		},
+		"routine as command": {
+			method:   http.MethodPost,
+			path:     "/devices/Kitchen/commands/routine",
+			body:     `{"length": "30m"}`,
+			wantCode: http.StatusBadRequest,
+			wantErr:  "routine is a routine",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			f := controller.NewFake(kitchen, tiles)
+			if tc.setup != nil {
+				tc.setup(f)
+			}
+			r := controller.NewRecorder(f)
+			s := newTestServer(r)
+			defer s.Close()
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(tc.method, strings.ReplaceAll(tc.path, " ", "%20"), strings.NewReader(tc.body)))
+
+			if w.Code != tc.wantCode {
+				t.Errorf("Code does not match: got %d, want %d: %s", w.Code, tc.wantCode, w.Body)
+			}
+			var body struct {
+				Error   string   `json:"error"`
+				Results []Result `json:"results"`
+			}
+			switch {
+			case tc.wantLabels != nil:
+				var records []device.Record
+				if strings.HasPrefix(w.Body.String(), "{") {
+					records = make([]device.Record, 1)
+					json.Unmarshal(w.Body.Bytes(), &records[0])
+				} else {
+					json.Unmarshal(w.Body.Bytes(), &records)
+				}
+				var labels []string
+				for _, r := range records {
+					labels = append(labels, r.Label)
+				}
+				if !slices.Equal(labels, tc.wantLabels) {
+					t.Errorf("Devices do not match: got %v, want %v", labels, tc.wantLabels)
+				}
+			default:
+				if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+					t.Fatalf("Failed to decode body %s: %v", w.Body, err)
+				}
+			}
+			if !strings.HasPrefix(body.Error, tc.wantErr) {
+				t.Errorf("Error does not match: got %q, want %q", body.Error, tc.wantErr)
+			}
+			var statuses []string
+			for _, r := range body.Results {
+				statuses = append(statuses, r.Status)
+			}
+			if !slices.Equal(statuses, tc.wantStatuses) {
+				t.Errorf("Statuses do not match: got %v, want %v", statuses, tc.wantStatuses)
+			}
+			if got := len(r.Calls()); got != tc.wantSent {
+				t.Errorf("Sent messages do not match: got %d, want %d", got, tc.wantSent)
+			}
+		})
+	}
+}
+
+// offlineHealth reports the offline device as offline and every other device as online.
+type offlineHealth struct {
+	controller.Controller
+	offline ldevice.Serial
+}
+
+func (c offlineHealth) Health(serial ldevice.Serial) (controller.Health, bool) {
+	return controller.Health{Online: serial != c.offline}, true
+}
+
+func TestServerOffline(t *testing.T) {
+	testCases := map[string]struct {
+		path         string
+		wantStatuses []string
+	}{
+		"offline device skipped": {
+			path:         "/devices/all/power",
+			wantStatuses: []string{"delivered", "offline"},
+		},
+		"forced send": {
+			path:         "/devices/all/power?force=true",
+			wantStatuses: []string{"delivered", "delivered"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServer(offlineHealth{controller.NewFake(kitchen, tiles), tiles.Serial})
+			defer s.Close()
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(`{"on": true}`)))
+
+			var body struct {
+				Results []Result `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Failed to decode body %s: %v", w.Body, err)
+			}
+			var statuses []string
+			for _, r := range body.Results {
+				statuses = append(statuses, r.Status)
+			}
+			if !slices.Equal(statuses, tc.wantStatuses) {
+				t.Errorf("Statuses do not match: got %v, want %v", statuses, tc.wantStatuses)
+			}
+		})
+	}
+}
+
+func TestReplaceEffect(t *testing.T) {
+	s := newTestServer(controller.NewFake(tiles))
+	defer s.Close()
+
+	// Both requests start their effect concurrently, only one of them is left running.
+	var wg sync.WaitGroup
+	for _, id := range []string{"snake_effect", "worm_effect"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices/Tiles/effects/"+id, strings.NewReader(`{"color": "red"}`)))
+			if w.Code != http.StatusOK {
+				t.Errorf("Code of %s does not match: got %d, want %d: %s", id, w.Code, http.StatusOK, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	first := s.effects[tiles.Serial]
+	s.mu.Unlock()
+	if first.id != "snake_effect" && first.id != "worm_effect" {
+		t.Fatalf("Running effect does not match: got %q, want snake_effect or worm_effect", first.id)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/devices/Tiles/effects/snake_effect", strings.NewReader(`{"color": "blue"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Code does not match: got %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if !first.stopped.Load() {
+		t.Error("Expected the replaced effect to be stopped")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.effects[tiles.Serial]; e.id != "snake_effect" || e.stopped == first.stopped {
+		t.Errorf("Running effect does not match: got %s, want a new snake_effect", e.id)
+	}
+}
+
+func TestDecodeParams(t *testing.T) {
+	testCases := map[string]struct {
+		body string
+		want map[string]string
+	}{
+		"large integer": {
+			body: `{"period": 1000000}`,
+			want: map[string]string{"period": "1000000"},
+		},
+		"fraction": {
+			body: `{"duration": 1.5}`,
+			want: map[string]string{"duration": "1.5"},
+		},
+		"list": {
+			body: `{"colors": ["red", 2000000], "cycles": null}`,
+			want: map[string]string{"colors": "red,2000000"},
+		},
+		"empty body": {
+			want: map[string]string{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, err := decodeParams(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tc.want) {
+				t.Errorf("Params do not match: got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func newTestServer(c controller.Controller) *Server {
+	cfg := config.Default()
+	cfg.DeviceRefreshPeriod = 0
+	cfg.SendTimeout = config.Duration(10 * time.Millisecond)
+	cfg.SendBackoff = config.Duration(time.Millisecond)
+	return New(c, cfg)
+}
@@ -0,0 +1,42 @@
+package sim
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Config is the format of simulator config files:
+//
+//	{
+//	  "devices": [
+//	    {"label": "Kitchen", "kind": "bulb", "group": "Downstairs", "location": "Home"},
+//	    {"label": "TV Strip", "kind": "strip", "zones": 16, "group": "Living Room", "location": "Home"},
+//	    {"label": "Tiles", "kind": "matrix", "tiles": 5, "width": 8, "height": 8, "group": "Living Room", "location": "Home"}
+//	  ]
+//	}
+type Config struct {
+	Devices []DeviceConfig `json:"devices"`
+}
+
+// ReadConfig decodes a simulator config.
+func ReadConfig(r io.Reader) (Config, error) {
+	var c Config
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return Config{}, err
+	}
+	for i := range c.Devices {
+		if err := c.Devices[i].validate(); err != nil {
+			return Config{}, err
+		}
+	}
+	return c, nil
+}
+
+// DefaultConfig returns a bulb, a strip and a matrix chain.
+func DefaultConfig() Config {
+	return Config{Devices: []DeviceConfig{
+		{Label: "Sim Bulb", Kind: KindBulb, Group: "Sim Room", Location: "Sim Home"},
+		{Label: "Sim Strip", Kind: KindStrip, Zones: 16, Group: "Sim Room", Location: "Sim Home"},
+		{Label: "Sim Tiles", Kind: KindMatrix, Tiles: 5, Width: 8, Height: 8, Group: "Sim Room", Location: "Sim Home"},
+	}}
+}
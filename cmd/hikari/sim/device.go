@@ -0,0 +1,329 @@
+package sim
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/lan"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/enums"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// Kind is the kind of a virtual device.
+type Kind string
+
+const (
+	KindBulb   Kind = "bulb"
+	KindStrip  Kind = "strip"
+	KindMatrix Kind = "matrix"
+)
+
+// Product IDs reported by virtual devices, matching the LIFX product registry.
+const (
+	productBulb   = 27 // LIFX A19
+	productStrip  = 32 // LIFX Z
+	productMatrix = 55 // LIFX Tile
+)
+
+const (
+	vendorLIFX       = 1
+	firmwareMajor    = 3
+	firmwareMinor    = 70
+	tileColors       = 64
+	zonesPerState    = 8
+	maxExtendedZones = 82
+	maxChainLength   = 16
+	defaultKelvin    = 3500
+)
+
+// DeviceConfig describes a virtual device.
+type DeviceConfig struct {
+	// Serial is the hex encoded serial, e.g. d073d5000001. It is assigned by the server when empty.
+	Serial   string `json:"serial,omitempty"`
+	Label    string `json:"label"`
+	Group    string `json:"group,omitempty"`
+	Location string `json:"location,omitempty"`
+	Kind     Kind   `json:"kind"`
+	// Zones is the number of zones of a strip.
+	Zones int `json:"zones,omitempty"`
+	// Tiles is the chain length of a matrix, each tile being Width x Height pixels.
+	Tiles  int `json:"tiles,omitempty"`
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+func (c *DeviceConfig) validate() error {
+	switch c.Kind {
+	case KindBulb:
+	case KindStrip:
+		if c.Zones <= 0 || c.Zones > 255 {
+			return fmt.Errorf("%s: zones must be between 1 and 255", c.Label)
+		}
+	case KindMatrix:
+		if c.Tiles <= 0 || c.Tiles > maxChainLength {
+			return fmt.Errorf("%s: tiles must be between 1 and %d", c.Label, maxChainLength)
+		}
+		if c.Width <= 0 || c.Height <= 0 || c.Width*c.Height > tileColors {
+			return fmt.Errorf("%s: tiles must have at most %d pixels", c.Label, tileColors)
+		}
+	default:
+		return fmt.Errorf("%s: unknown kind %q", c.Label, c.Kind)
+	}
+	return nil
+}
+
+// State is a snapshot of the state of a virtual device.
+type State struct {
+	Serial string
+	Label  string
+	Power  uint16
+	Color  packets.LightHsbk
+	Zones  []packets.LightHsbk
+	Tiles  [][tileColors]packets.LightHsbk
+}
+
+// device is a virtual device answering LIFX LAN messages.
+type device struct {
+	config DeviceConfig
+	target [8]byte
+	port   uint32
+
+	mu    sync.Mutex
+	label string
+	power uint16
+	color packets.LightHsbk
+	zones []packets.LightHsbk
+	tiles [][tileColors]packets.LightHsbk
+}
+
+func newDevice(c DeviceConfig, port uint32) (*device, error) {
+	target, err := lan.ParseSerial(c.Serial)
+	if err != nil {
+		return nil, err
+	}
+	d := &device{
+		config: c,
+		target: target,
+		port:   port,
+		label:  c.Label,
+		color:  packets.LightHsbk{Kelvin: defaultKelvin},
+	}
+	switch c.Kind {
+	case KindStrip:
+		d.zones = make([]packets.LightHsbk, c.Zones)
+	case KindMatrix:
+		d.tiles = make([][tileColors]packets.LightHsbk, c.Tiles)
+	}
+	d.setAll(d.color)
+	return d, nil
+}
+
+func (d *device) state() State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := State{
+		Serial: d.config.Serial,
+		Label:  d.label,
+		Power:  d.power,
+		Color:  d.color,
+		Zones:  append([]packets.LightHsbk(nil), d.zones...),
+		Tiles:  append([][tileColors]packets.LightHsbk(nil), d.tiles...),
+	}
+	return s
+}
+
+// handle applies the message to the device and returns its responses, nil if the message is not supported.
+// get reports whether the message is a query, which is always answered regardless of the res_required flag.
+func (d *device) handle(p packets.Payload) (responses []packets.Payload, get bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch p := p.(type) {
+	case *packets.DeviceGetService:
+		return one(&packets.DeviceStateService{Service: enums.DeviceServiceDEVICESERVICEUDP, Port: d.port}), true
+	case *packets.DeviceGetHostFirmware:
+		return one(d.firmware()), true
+	case *packets.DeviceGetVersion:
+		return one(d.version()), true
+	case *packets.DeviceGetLabel:
+		return one(d.stateLabel()), true
+	case *packets.DeviceSetLabel:
+		d.label = cString(p.Label[:])
+		return one(d.stateLabel()), false
+	case *packets.DeviceGetLocation:
+		s := &packets.DeviceStateLocation{Location: id(d.config.Location)}
+		copy(s.Label[:], d.config.Location)
+		return one(s), true
+	case *packets.DeviceGetGroup:
+		s := &packets.DeviceStateGroup{Group: id(d.config.Group)}
+		copy(s.Label[:], d.config.Group)
+		return one(s), true
+	case *packets.DeviceEchoRequest:
+		return one(&packets.DeviceEchoResponse{Payload: p.Payload}), true
+	case *packets.DeviceGetPower:
+		return one(&packets.DeviceStatePower{Level: d.power}), true
+	case *packets.DeviceSetPower:
+		d.power = p.Level
+		return one(&packets.DeviceStatePower{Level: d.power}), false
+	case *packets.LightGetPower:
+		return one(&packets.LightStatePower{Level: d.power}), true
+	case *packets.LightSetPower:
+		d.power = p.Level
+		return one(&packets.LightStatePower{Level: d.power}), false
+	case *packets.LightGet:
+		return one(d.lightState()), true
+	case *packets.LightSetColor:
+		d.setAll(p.Color)
+		return one(d.lightState()), false
+	}
+
+	switch d.config.Kind {
+	case KindStrip:
+		return d.handleMultiZone(p)
+	case KindMatrix:
+		return d.handleMatrix(p)
+	}
+	return nil, false
+}
+
+func (d *device) handleMultiZone(p packets.Payload) ([]packets.Payload, bool) {
+	switch p := p.(type) {
+	case *packets.MultiZoneGetColorZones:
+		return d.stateZones(int(p.StartIndex), int(p.EndIndex)), true
+	case *packets.MultiZoneSetColorZones:
+		for i := int(p.StartIndex); i <= int(p.EndIndex) && i < len(d.zones); i++ {
+			d.zones[i] = p.Color
+		}
+		return d.stateZones(int(p.StartIndex), int(p.EndIndex)), false
+	case *packets.MultiZoneExtendedGetColorZones:
+		return one(d.stateExtendedZones()), true
+	case *packets.MultiZoneExtendedSetColorZones:
+		for i := range int(p.ColorsCount) {
+			if z := int(p.Index) + i; z < len(d.zones) && i < maxExtendedZones {
+				d.zones[z] = p.Colors[i]
+			}
+		}
+		return one(d.stateExtendedZones()), false
+	}
+	return nil, false
+}
+
+func (d *device) handleMatrix(p packets.Payload) ([]packets.Payload, bool) {
+	switch p := p.(type) {
+	case *packets.TileGetDeviceChain:
+		s := &packets.TileStateDeviceChain{TileDevicesCount: uint8(len(d.tiles))}
+		for i := range d.tiles {
+			s.TileDevices[i] = packets.TileStateDevice{
+				Width:         uint8(d.config.Width),
+				Height:        uint8(d.config.Height),
+				DeviceVersion: *d.version(),
+				Firmware:      *d.firmware(),
+			}
+		}
+		return one(s), true
+	case *packets.TileGet64:
+		responses := []packets.Payload{}
+		for i := int(p.TileIndex); i < int(p.TileIndex)+int(p.Length) && i < len(d.tiles); i++ {
+			responses = append(responses, &packets.TileState64{
+				TileIndex: uint8(i),
+				Rect:      packets.TileBufferRect{Width: uint8(d.config.Width)},
+				Colors:    d.tiles[i],
+			})
+		}
+		return responses, true
+	case *packets.TileSet64:
+		width := max(int(p.Rect.Width), 1)
+		for i := int(p.TileIndex); i < int(p.TileIndex)+int(p.Length) && i < len(d.tiles); i++ {
+			for j, c := range p.Colors {
+				x, y := int(p.Rect.X)+j%width, int(p.Rect.Y)+j/width
+				if x < d.config.Width && y < d.config.Height {
+					d.tiles[i][y*d.config.Width+x] = c
+				}
+			}
+		}
+		return []packets.Payload{}, false
+	}
+	return nil, false
+}
+
+// setAll sets the color of the device and of all of its zones and pixels. It must be called with mu held.
+func (d *device) setAll(c packets.LightHsbk) {
+	d.color = c
+	for i := range d.zones {
+		d.zones[i] = c
+	}
+	for i := range d.tiles {
+		for j := range d.tiles[i] {
+			d.tiles[i][j] = c
+		}
+	}
+}
+
+func (d *device) lightState() *packets.LightState {
+	s := &packets.LightState{Color: d.color, Power: d.power}
+	copy(s.Label[:], d.label)
+	return s
+}
+
+func (d *device) stateLabel() *packets.DeviceStateLabel {
+	s := &packets.DeviceStateLabel{}
+	copy(s.Label[:], d.label)
+	return s
+}
+
+func (d *device) stateZones(start, end int) []packets.Payload {
+	var responses []packets.Payload
+	end = min(end, len(d.zones)-1)
+	for i := start - start%zonesPerState; i <= end; i += zonesPerState {
+		s := &packets.MultiZoneStateMultiZone{Count: uint8(len(d.zones)), Index: uint8(i)}
+		copy(s.Colors[:], d.zones[i:])
+		responses = append(responses, s)
+	}
+	return responses
+}
+
+func (d *device) stateExtendedZones() *packets.MultiZoneExtendedStateMultiZone {
+	s := &packets.MultiZoneExtendedStateMultiZone{
+		Count:       uint16(len(d.zones)),
+		ColorsCount: uint8(min(len(d.zones), maxExtendedZones)),
+	}
+	copy(s.Colors[:], d.zones)
+	return s
+}
+
+func (d *device) version() *packets.DeviceStateVersion {
+	product := uint32(productBulb)
+	switch d.config.Kind {
+	case KindStrip:
+		product = productStrip
+	case KindMatrix:
+		product = productMatrix
+	}
+	return &packets.DeviceStateVersion{Vendor: vendorLIFX, Product: product}
+}
+
+func (d *device) firmware() *packets.DeviceStateHostFirmware {
+	return &packets.DeviceStateHostFirmware{VersionMajor: firmwareMajor, VersionMinor: firmwareMinor}
+}
+
+func one(p packets.Payload) []packets.Payload {
+	return []packets.Payload{p}
+}
+
+// id returns a stable location or group ID derived from its label.
+func id(label string) [16]byte {
+	var b [16]byte
+	sum := sha256.Sum256([]byte(label))
+	copy(b[:], sum[:])
+	return b
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,158 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/lan"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+// DefaultAddr listens on the LIFX port on all interfaces, so that devices are discovered by broadcast.
+var DefaultAddr = fmt.Sprintf(":%d", lan.DefaultPort)
+
+const (
+	maxMessageSize = 2048
+	maxMessages    = 1024
+	serialPrefix   = "d073d5"
+)
+
+// Message is a message received by a virtual device.
+type Message struct {
+	Serial  string
+	Payload packets.Payload
+}
+
+// Server answers the LIFX LAN protocol on UDP on behalf of a set of virtual devices.
+// Bound to the default port on all interfaces, its devices are discovered like real ones.
+type Server struct {
+	conn    *net.UDPConn
+	devices []*device
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer listens on addr, e.g. ":56700", and creates the configured devices.
+// Devices without a serial are assigned one in order, starting at d073d5000001.
+func NewServer(addr string, configs []DeviceConfig) (*Server, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{conn: conn}
+	port := uint32(conn.LocalAddr().(*net.UDPAddr).Port)
+	seen := make(map[string]bool)
+	for i, c := range configs {
+		if c.Serial == "" {
+			c.Serial = fmt.Sprintf("%s%06x", serialPrefix, i+1)
+		}
+		if err := c.validate(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		d, err := newDevice(c, port)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if seen[c.Serial] {
+			conn.Close()
+			return nil, fmt.Errorf("duplicate serial %s", c.Serial)
+		}
+		seen[c.Serial] = true
+		s.devices = append(s.devices, d)
+	}
+	return s, nil
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() *net.UDPAddr {
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Serve answers messages until the server is closed.
+func (s *Server) Serve() error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		h, payload, err := lan.Decode(buf[:n])
+		if err != nil {
+			continue
+		}
+		for _, d := range s.devices {
+			if h.Tagged || h.Target == [8]byte{} || h.Target == d.target {
+				s.reply(addr, h, d, payload)
+			}
+		}
+	}
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.conn.Close()
+}
+
+// Devices returns the current state of all devices.
+func (s *Server) Devices() []State {
+	states := make([]State, len(s.devices))
+	for i, d := range s.devices {
+		states[i] = d.state()
+	}
+	return states
+}
+
+// Messages returns the last messages received, excluding discovery.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) reply(addr *net.UDPAddr, h lan.Header, d *device, payload packets.Payload) {
+	if _, ok := payload.(*packets.DeviceGetService); !ok {
+		s.mu.Lock()
+		s.messages = append(s.messages, Message{Serial: d.config.Serial, Payload: payload})
+		if len(s.messages) > maxMessages {
+			s.messages = s.messages[len(s.messages)-maxMessages:]
+		}
+		s.mu.Unlock()
+	}
+
+	responses, get := d.handle(payload)
+	resp := lan.Header{Source: h.Source, Target: d.target, Sequence: h.Sequence}
+	if h.AckRequired {
+		s.send(addr, resp, &packets.DeviceAcknowledgement{})
+	}
+	if responses == nil && (get || h.ResRequired) {
+		responses = one(&packets.DeviceStateUnhandled{UnhandledType: h.Type})
+	}
+	if !get && !h.ResRequired {
+		return
+	}
+	for _, r := range responses {
+		s.send(addr, resp, r)
+	}
+}
+
+func (s *Server) send(addr *net.UDPAddr, h lan.Header, payload packets.Payload) {
+	b, err := lan.Encode(h, payload)
+	if err != nil {
+		return
+	}
+	_, _ = s.conn.WriteToUDP(b, addr)
+}
@@ -0,0 +1,128 @@
+package sim
+
+import (
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alessio-palumbo/hikari/cmd/hikari/internal/lan"
+	"github.com/alessio-palumbo/lifxprotocol-go/gen/protocol/packets"
+)
+
+func TestServer(t *testing.T) {
+	s, err := NewServer("127.0.0.1:0", DefaultConfig().Devices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve()
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	red := packets.LightHsbk{Hue: 0, Saturation: 65535, Brightness: 65535, Kelvin: 3500}
+	testCases := map[string]struct {
+		serial    string
+		payload   packets.Payload
+		ack       bool
+		wantTypes []uint16
+		wantCheck func(t *testing.T, responses []packets.Payload)
+	}{
+		"get label": {
+			serial:    "d073d5000001",
+			payload:   &packets.DeviceGetLabel{},
+			wantTypes: []uint16{uint16(packets.PayloadTypeDeviceStateLabel)},
+			wantCheck: func(t *testing.T, responses []packets.Payload) {
+				if got := cString(responses[0].(*packets.DeviceStateLabel).Label[:]); got != "Sim Bulb" {
+					t.Errorf("Label does not match: got %s", got)
+				}
+			},
+		},
+		"set color with ack": {
+			serial:    "d073d5000001",
+			payload:   &packets.LightSetColor{Color: red},
+			ack:       true,
+			wantTypes: []uint16{uint16(packets.PayloadTypeDeviceAcknowledgement)},
+		},
+		"get strip zones": {
+			serial:    "d073d5000002",
+			payload:   &packets.MultiZoneGetColorZones{StartIndex: 0, EndIndex: 255},
+			wantTypes: []uint16{uint16(packets.PayloadTypeMultiZoneStateMultiZone), uint16(packets.PayloadTypeMultiZoneStateMultiZone)},
+		},
+		"get tile colors": {
+			serial:    "d073d5000003",
+			payload:   &packets.TileGet64{Length: 5, Rect: packets.TileBufferRect{Width: 8}},
+			wantTypes: slices.Repeat([]uint16{uint16(packets.PayloadTypeTileState64)}, 5),
+		},
+		"multizone on a bulb": {
+			serial:    "d073d5000001",
+			payload:   &packets.MultiZoneGetColorZones{EndIndex: 255},
+			wantTypes: []uint16{uint16(packets.PayloadTypeDeviceStateUnhandled)},
+		},
+	}
+
+	var seq uint8
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			target, err := lan.ParseSerial(tc.serial)
+			if err != nil {
+				t.Fatal(err)
+			}
+			seq++
+			h := lan.Header{Source: 2, Target: target, Sequence: seq, AckRequired: tc.ack, ResRequired: !tc.ack}
+			responses := exchange(t, conn, s.Addr(), h, tc.payload, len(tc.wantTypes))
+
+			var gotTypes []uint16
+			for _, r := range responses {
+				gotTypes = append(gotTypes, r.PayloadType())
+			}
+			if !slices.Equal(gotTypes, tc.wantTypes) {
+				t.Fatalf("Responses do not match: got %v, want %v", gotTypes, tc.wantTypes)
+			}
+			if tc.wantCheck != nil {
+				tc.wantCheck(t, responses)
+			}
+		})
+	}
+
+	if got := s.Devices()[0].Color; got != red {
+		t.Errorf("Expected bulb color to be set, got %+v", got)
+	}
+	if got := len(s.Messages()); got != len(testCases) {
+		t.Errorf("Expected %d recorded messages, got %d", len(testCases), got)
+	}
+}
+
+// exchange sends a message to the server and returns the first count responses to it.
+func exchange(t *testing.T, conn *net.UDPConn, addr *net.UDPAddr, h lan.Header, payload packets.Payload, count int) []packets.Payload {
+	t.Helper()
+	b, err := lan.Encode(h, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.WriteToUDP(b, addr); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 2048)
+	var responses []packets.Payload
+	for len(responses) < count {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatalf("Expected %d responses, got %d: %v", count, len(responses), err)
+		}
+		resp, p, err := lan.Decode(buf[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Sequence == h.Sequence {
+			responses = append(responses, p)
+		}
+	}
+	return responses
+}
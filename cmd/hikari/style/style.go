@@ -2,72 +2,77 @@ package style
 
 import "github.com/charmbracelet/lipgloss"
 
+// Styles of the TUI, set from the current theme by Apply.
 var (
-	SelectedTextColor   = lipgloss.AdaptiveColor{Light: "#ee6ff8", Dark: "#ee6ff8"}
-	SelectedBorderColor = lipgloss.AdaptiveColor{Light: "#f793ff", Dark: "#ad58b4"}
-	ListColor           = lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"}
-	StatusColor         = lipgloss.Color("#888888")
-	HelpColor           = lipgloss.Color("#626262")
-	TitleBackground     = lipgloss.Color("#5f5fd7")
-	TitleColor          = lipgloss.Color("#ffffd5")
-	ListTitleColor      = lipgloss.Color("#aa38c7")
-	ActionActiveColor   = lipgloss.Color("#008eff")
-	TODO1Color          = lipgloss.Color("#874bfd")
-	TODO2Color          = lipgloss.Color("#ee6ff8")
-	TODO3Color          = lipgloss.Color("#58b7ff")
+	ListSelected   lipgloss.Style
+	ListItem       lipgloss.Style
+	ActionSelected lipgloss.Style
+	ActionActive   lipgloss.Style
+	ActionBlurred  lipgloss.Style
+	Status         lipgloss.Style
+	Help           lipgloss.Style
+	HelpKey        lipgloss.Style
+	HelpOverlay    lipgloss.Style
+	Spinner        lipgloss.Style
+	Title          lipgloss.Style
+	ListTitle      lipgloss.Style
+	SelectedDevice lipgloss.Style
+	SelectedBorder lipgloss.Style
+	Offline        lipgloss.Style
 )
 
-var (
-	ListSelected = lipgloss.NewStyle().
-			Bold(true).
-			Border(lipgloss.Border{Left: "┃"}, false, false, false, true).
-			BorderForeground(SelectedBorderColor).
-			Foreground(SelectedTextColor).
-			PaddingLeft(1)
+func init() {
+	Apply(defaultTheme())
+}
 
-	ListItem = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(ListColor).
-			PaddingLeft(2)
+// Apply sets every style of the package from the theme.
+func Apply(t Theme) {
+	ListSelected = t.style("list_selected", lipgloss.NewStyle().
+		Bold(true).
+		Border(lipgloss.Border{Left: "┃"}, false, false, false, true).
+		PaddingLeft(1))
 
-	ActionSelected = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(SelectedTextColor)
+	ListItem = t.style("list_item", lipgloss.NewStyle().
+		Bold(true).
+		PaddingLeft(2))
 
-	ActionActive = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(ActionActiveColor)
+	ActionSelected = t.style("action_selected", lipgloss.NewStyle().
+		Bold(true))
 
-	ActionBlurred = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(ListColor).
-			Faint(true)
+	ActionActive = t.style("action_active", lipgloss.NewStyle().
+		Bold(true))
 
-	Status = lipgloss.NewStyle().Foreground(StatusColor)
+	ActionBlurred = t.style("action_blurred", lipgloss.NewStyle().
+		Bold(true).
+		Faint(true))
 
-	Help = lipgloss.NewStyle().Foreground(HelpColor)
+	Status = t.style("status", lipgloss.NewStyle())
 
-	Spinner = lipgloss.NewStyle().
-		Bold(true).
-		Foreground(TitleBackground)
-
-	Title = lipgloss.NewStyle().
-		Background(TitleBackground).
-		Foreground(TitleColor).
-		Padding(0, 1)
-
-	ListTitle = lipgloss.NewStyle().
-			Background(ListTitleColor).
-			Foreground(TitleColor).
-			Padding(0, 1).
-			MarginLeft(2)
-
-	SelectedDevice = lipgloss.NewStyle().
-			Bold(true).
-			Foreground(ListColor)
-
-	SelectedBorder = lipgloss.NewStyle().
-			Border(lipgloss.NormalBorder(), false, false, true, false).
-			BorderForeground(SelectedBorderColor).
-			MarginLeft(2)
-)
+	Help = t.style("help", lipgloss.NewStyle())
+
+	HelpKey = t.style("help_key", lipgloss.NewStyle())
+
+	HelpOverlay = t.style("help_overlay", lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		Padding(0, 1))
+
+	Spinner = t.style("spinner", lipgloss.NewStyle().
+		Bold(true))
+
+	Title = t.style("title", lipgloss.NewStyle().
+		Padding(0, 1))
+
+	ListTitle = t.style("list_title", lipgloss.NewStyle().
+		Padding(0, 1).
+		MarginLeft(2))
+
+	SelectedDevice = t.style("selected_device", lipgloss.NewStyle().
+		Bold(true))
+
+	SelectedBorder = t.style("selected_border", lipgloss.NewStyle().
+		Border(lipgloss.NormalBorder(), false, false, true, false).
+		MarginLeft(2))
+
+	Offline = t.style("offline", lipgloss.NewStyle().
+		Faint(true))
+}
@@ -0,0 +1,248 @@
+package style
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// Built-in themes.
+const (
+	Dark         = "dark"
+	Light        = "light"
+	HighContrast = "high-contrast"
+	Monochrome   = "monochrome"
+)
+
+const (
+	appDir    = "hikari"
+	themesDir = "themes"
+	themeExt  = ".json"
+)
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Colors are the colors of a style, empty colors are left unset.
+// A color is either a hex value, e.g. "#ee6ff8", or an ANSI color number from 0 to 255.
+type Colors struct {
+	Foreground string `json:"foreground,omitempty"`
+	Background string `json:"background,omitempty"`
+	Border     string `json:"border,omitempty"`
+}
+
+// Theme holds the colors of the styles of the package keyed by style name, e.g. "list_selected".
+// Theme files extend the built-in theme in Base and only need to hold the styles they change:
+//
+//	{
+//	  "base": "dark",
+//	  "styles": {
+//	    "title": {"foreground": "#ffffff", "background": "#d70000"},
+//	    "list_selected": {"foreground": "#ff5f5f", "border": "#d70000"}
+//	  }
+//	}
+type Theme struct {
+	Base   string            `json:"base,omitempty"`
+	Styles map[string]Colors `json:"styles"`
+}
+
+// palette is the set of colors a built-in theme is derived from.
+type palette struct {
+	selectedText, selectedBorder, list, status, help, titleBackground, title, listTitle, actionActive string
+}
+
+var themes = map[string]palette{
+	Dark: {
+		selectedText:    "#ee6ff8",
+		selectedBorder:  "#ad58b4",
+		list:            "#dddddd",
+		status:          "#888888",
+		help:            "#626262",
+		titleBackground: "#5f5fd7",
+		title:           "#ffffd5",
+		listTitle:       "#aa38c7",
+		actionActive:    "#008eff",
+	},
+	Light: {
+		selectedText:    "#ee6ff8",
+		selectedBorder:  "#f793ff",
+		list:            "#1a1a1a",
+		status:          "#888888",
+		help:            "#626262",
+		titleBackground: "#5f5fd7",
+		title:           "#ffffd5",
+		listTitle:       "#aa38c7",
+		actionActive:    "#008eff",
+	},
+	HighContrast: {
+		selectedText:    "11",
+		selectedBorder:  "11",
+		list:            "15",
+		status:          "15",
+		help:            "7",
+		titleBackground: "12",
+		title:           "0",
+		listTitle:       "13",
+		actionActive:    "14",
+	},
+	Monochrome: {},
+}
+
+// Themes returns the names of the built-in themes.
+func Themes() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Use loads and applies the theme with the given name, see Load. An empty name selects
+// the dark or light theme depending on the terminal background. The monochrome theme is
+// used instead when NO_COLOR is set or the terminal does not support colors.
+func Use(name string) error {
+	if os.Getenv("NO_COLOR") != "" || lipgloss.ColorProfile() == termenv.Ascii {
+		name = Monochrome
+	}
+	if name == "" {
+		name = Light
+		if lipgloss.HasDarkBackground() {
+			name = Dark
+		}
+	}
+
+	t, err := Load(name)
+	if err != nil {
+		return err
+	}
+	if name == Monochrome {
+		// Also drop the colors rendered outside of the package, e.g. device colors.
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	Apply(t)
+	return nil
+}
+
+// Load returns the built-in theme with the given name. Otherwise name is the path of a theme file
+// if it ends in .json, or the name of a theme file in the themes directory of the user config directory,
+// e.g. $XDG_CONFIG_HOME/hikari/themes/<name>.json on Linux.
+func Load(name string) (Theme, error) {
+	if p, ok := themes[name]; ok {
+		return p.theme(name), nil
+	}
+
+	path := name
+	if !strings.HasSuffix(name, themeExt) {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return Theme{}, err
+		}
+		path = filepath.Join(dir, appDir, themesDir, name+themeExt)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Theme{}, fmt.Errorf("unknown theme %s: %w", name, err)
+	}
+
+	var t Theme
+	if err := json.Unmarshal(b, &t); err != nil {
+		return Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := t.extend(); err != nil {
+		return Theme{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// extend validates the theme and fills the styles it does not set from its base theme.
+func (t *Theme) extend() error {
+	if t.Base == "" {
+		t.Base = Dark
+	}
+	base, ok := themes[t.Base]
+	if !ok {
+		return fmt.Errorf("unknown base theme %s, must be one of %s", t.Base, strings.Join(Themes(), ", "))
+	}
+
+	styles := base.theme(t.Base).Styles
+	for name, c := range t.Styles {
+		b, ok := styles[name]
+		if !ok {
+			return fmt.Errorf("unknown style %s", name)
+		}
+		for _, v := range []string{c.Foreground, c.Background, c.Border} {
+			if err := validateColor(v); err != nil {
+				return fmt.Errorf("style %s: %w", name, err)
+			}
+		}
+		styles[name] = Colors{
+			Foreground: cmp.Or(c.Foreground, b.Foreground),
+			Background: cmp.Or(c.Background, b.Background),
+			Border:     cmp.Or(c.Border, b.Border),
+		}
+	}
+	t.Styles = styles
+	return nil
+}
+
+// theme returns the styles derived from the palette.
+func (p palette) theme(name string) Theme {
+	return Theme{
+		Base: name,
+		Styles: map[string]Colors{
+			"list_selected":   {Foreground: p.selectedText, Border: p.selectedBorder},
+			"list_item":       {Foreground: p.list},
+			"action_selected": {Foreground: p.selectedText},
+			"action_active":   {Foreground: p.actionActive},
+			"action_blurred":  {Foreground: p.list},
+			"status":          {Foreground: p.status},
+			"help":            {Foreground: p.help},
+			"help_key":        {Foreground: p.status},
+			"help_overlay":    {Border: p.selectedBorder},
+			"spinner":         {Foreground: p.titleBackground},
+			"title":           {Foreground: p.title, Background: p.titleBackground},
+			"list_title":      {Foreground: p.title, Background: p.listTitle},
+			"selected_device": {Foreground: p.list},
+			"selected_border": {Border: p.selectedBorder},
+			"offline":         {Foreground: p.help},
+		},
+	}
+}
+
+// style returns s with the colors of the named style.
+func (t Theme) style(name string, s lipgloss.Style) lipgloss.Style {
+	c := t.Styles[name]
+	if c.Foreground != "" {
+		s = s.Foreground(lipgloss.Color(c.Foreground))
+	}
+	if c.Background != "" {
+		s = s.Background(lipgloss.Color(c.Background))
+	}
+	if c.Border != "" {
+		s = s.BorderForeground(lipgloss.Color(c.Border))
+	}
+	return s
+}
+
+func defaultTheme() Theme {
+	return themes[Dark].theme(Dark)
+}
+
+func validateColor(v string) error {
+	if v == "" || hexColor.MatchString(v) {
+		return nil
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 && n <= 255 {
+		return nil
+	}
+	return fmt.Errorf("invalid color %q", v)
+}
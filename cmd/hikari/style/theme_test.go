@@ -0,0 +1,67 @@
+package style
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := map[string]struct {
+		file      string
+		wantStyle string
+		want      Colors
+		wantErr   bool
+	}{
+		"overrides base style": {
+			file:      `{"base": "light", "styles": {"title": {"background": "#d70000"}}}`,
+			wantStyle: "title",
+			want:      Colors{Foreground: "#ffffd5", Background: "#d70000"},
+		},
+		"keeps base styles": {
+			file:      `{"base": "high-contrast", "styles": {"title": {"background": "1"}}}`,
+			wantStyle: "list_item",
+			want:      Colors{Foreground: "15"},
+		},
+		"defaults to dark base": {
+			file:      `{"styles": {}}`,
+			wantStyle: "list_item",
+			want:      Colors{Foreground: "#dddddd"},
+		},
+		"unknown base": {
+			file:    `{"base": "solarized"}`,
+			wantErr: true,
+		},
+		"unknown style": {
+			file:    `{"styles": {"footer": {"foreground": "#ffffff"}}}`,
+			wantErr: true,
+		},
+		"invalid color": {
+			file:    `{"styles": {"title": {"foreground": "red"}}}`,
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "theme.json")
+			if err := os.WriteFile(path, []byte(tc.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			theme, err := Load(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := theme.Styles[tc.wantStyle]; got != tc.want {
+				t.Errorf("Style %s does not match: got %+v, want %+v", tc.wantStyle, got, tc.want)
+			}
+		})
+	}
+}